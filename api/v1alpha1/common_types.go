@@ -0,0 +1,232 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType is the type of a condition reported in the status of a dynamic role
+type ConditionType string
+
+const (
+	// ConditionReady is True when the generated role matches the most recently computed rules
+	ConditionReady ConditionType = "Ready"
+	// ConditionDegraded is True when the most recent attempt to compute or write the generated role failed
+	ConditionDegraded ConditionType = "Degraded"
+	// ConditionDiscoveryStale is True when the rules refer to API groups that could not be discovered, whose resources are taken from an earlier discovery
+	ConditionDiscoveryStale ConditionType = "DiscoveryStale"
+	// ConditionNonResourceURLsNarrowed is True when a deny rule only covered part of a granted nonResourceURL pattern, which was narrowed down to the URLs the API server serves
+	ConditionNonResourceURLsNarrowed ConditionType = "NonResourceURLsNarrowed"
+)
+
+const (
+	// ReasonRoleReconciled is used when the generated role was computed and written successfully
+	ReasonRoleReconciled = "RoleReconciled"
+	// ReasonReconcileFailed is used when the generated role could not be computed or written
+	ReasonReconcileFailed = "ReconcileFailed"
+	// ReasonInheritedRoleMissing is used when a role listed in `inherit` does not exist
+	ReasonInheritedRoleMissing = "InheritedRoleMissing"
+	// ReasonInheritanceCycle is used when dynamic roles inherit from each other in a loop
+	ReasonInheritanceCycle = "InheritanceCycle"
+	// ReasonBindingReconciled is used when the generated binding was resolved and written successfully
+	ReasonBindingReconciled = "BindingReconciled"
+	// ReasonRoleRefMissing is used when the dynamic role referenced by a dynamic binding does not exist
+	ReasonRoleRefMissing = "RoleRefMissing"
+	// ReasonPreviewing is used when the rules were computed in Preview mode and the generated role was left unchanged
+	ReasonPreviewing = "Previewing"
+	// ReasonNotControlled is used when an object of the generated name already exists and is not controlled by the dynamic resource, which leaves it untouched
+	ReasonNotControlled = "NotControlled"
+	// ReasonAPIGroupsStale is used when API groups the rules refer to could not be discovered
+	ReasonAPIGroupsStale = "APIGroupsStale"
+	// ReasonDiscoveryComplete is used when every API group the rules refer to was discovered
+	ReasonDiscoveryComplete = "DiscoveryComplete"
+	// ReasonPartialNonResourceURLDeny is used when a deny rule only covered part of a granted nonResourceURL pattern
+	ReasonPartialNonResourceURLDeny = "PartialNonResourceURLDeny"
+	// ReasonNonResourceURLsKept is used when every granted nonResourceURL pattern was either kept or denied as a whole
+	ReasonNonResourceURLsKept = "NonResourceURLsKept"
+)
+
+// RoleMode selects whether the computed rules of a dynamic role are written to its generated role
+// +kubebuilder:validation:Enum=Enforce;Preview
+type RoleMode string
+
+const (
+	// ModeEnforce writes the computed rules to the generated role; it is the default
+	ModeEnforce RoleMode = "Enforce"
+	// ModePreview publishes the computed rules and how they differ from the generated role in status, without changing the generated role
+	ModePreview RoleMode = "Preview"
+)
+
+// Precedence selects whether the allow or the deny rules of a dynamic role win when both match a permission
+// +kubebuilder:validation:Enum=AllowOverrides;DenyOverrides
+type Precedence string
+
+const (
+	// PrecedenceAllowOverrides applies the deny rules to the inherited permissions only, then adds the allow rules; it is the default
+	PrecedenceAllowOverrides Precedence = "AllowOverrides"
+	// PrecedenceDenyOverrides applies the deny rules after the allow rules, so that an allow rule cannot re-grant a denied permission
+	PrecedenceDenyOverrides Precedence = "DenyOverrides"
+)
+
+// Condition describes one aspect of the state of a dynamic role
+type Condition struct {
+	Type               ConditionType          `json:"type"`
+	Status             metav1.ConditionStatus `json:"status"`
+	ObservedGeneration int64                  `json:"observedGeneration,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+}
+
+// ComputedRoleStatus is the observed state shared by DynamicRoles and DynamicClusterRoles
+type ComputedRoleStatus struct {
+	// ObservedGeneration is the generation of the spec that the status was computed from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// GeneratedRoleName is the name of the Role or ClusterRole created from this object
+	GeneratedRoleName string `json:"generatedRoleName,omitempty"`
+	// RuleCount is the number of rules in the generated role
+	RuleCount int `json:"ruleCount,omitempty"`
+	// InheritedRoles is the list of roles that were resolved and inherited from when the rules were last computed
+	InheritedRoles []InheritedRole `json:"inheritedRoles,omitempty"`
+	// DiscoveryVersion is the version of the operator's snapshot of the cluster's API resources that the rules were computed from
+	DiscoveryVersion int64 `json:"discoveryVersion,omitempty"`
+	// Preview holds the rules computed in Preview mode, and is cleared once the spec is enforced
+	Preview *RulePreview `json:"preview,omitempty"`
+	// Provenance lists which inherited roles, deny and allow rules granted or removed each permission, when spec.provenance is set
+	Provenance []PermissionProvenance `json:"provenance,omitempty"`
+	// ProvenanceOmitted is the number of histories left out of provenance to keep the status small; `dynamic-rbac explain` explains any permission
+	ProvenanceOmitted int `json:"provenanceOmitted,omitempty"`
+	// LastError is the message of the most recent error, cleared once the role is reconciled successfully
+	LastError string `json:"lastError,omitempty"`
+	// Conditions describe the current state of the generated role
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// RulePreview describes the rules computed in Preview mode and how enforcing them would change the generated role
+type RulePreview struct {
+	// Rules are the rules the generated role would have if the spec was enforced
+	Rules []v1.PolicyRule `json:"rules,omitempty"`
+	// Added are the permissions that enforcing the spec would grant, compacted into as few rules as possible
+	Added []v1.PolicyRule `json:"added,omitempty"`
+	// Removed are the permissions that enforcing the spec would revoke, compacted into as few rules as possible
+	Removed []v1.PolicyRule `json:"removed,omitempty"`
+	// PermissionsAdded is the number of individual permissions, i.e. a verb on a single resource, that would be granted
+	PermissionsAdded int `json:"permissionsAdded,omitempty"`
+	// PermissionsRemoved is the number of individual permissions that would be revoked
+	PermissionsRemoved int `json:"permissionsRemoved,omitempty"`
+	// RulesOmitted is the number of rules left out of added, removed and rules to keep the status small; `dynamic-rbac compute` prints every rule
+	RulesOmitted int `json:"rulesOmitted,omitempty"`
+}
+
+// PermissionProvenance groups the permissions that were granted and removed by the same sources, in the same order
+type PermissionProvenance struct {
+	// Rules are the permissions sharing this history, compacted into as few rules as possible
+	Rules []v1.PolicyRule `json:"rules"`
+	// History lists the sources in the order they were applied, e.g. `granted by ClusterRole/admin`, `removed by deny[0]`
+	History []string `json:"history"`
+	// Granted is true if the permissions are in the generated role, i.e. the last source granted them
+	Granted bool `json:"granted"`
+}
+
+// SetCondition adds or updates a condition, only moving its transition time when its status changes
+func (s *ComputedRoleStatus) SetCondition(condition Condition) {
+	s.Conditions = setCondition(s.Conditions, condition)
+}
+
+// GetCondition returns the condition of the given type, or nil if it has not been set
+func (s *ComputedRoleStatus) GetCondition(conditionType ConditionType) *Condition {
+	return getCondition(s.Conditions, conditionType)
+}
+
+// RoleReference names the dynamic role whose generated role a dynamic binding grants
+type RoleReference struct {
+	// Kind is either DynamicRole or DynamicClusterRole
+	Kind string `json:"kind"`
+	// Name of the dynamic role; a DynamicRole is looked up in the binding's namespace
+	Name string `json:"name"`
+}
+
+// SubjectSelector selects the subjects a dynamic binding grants its role to, either by name or, for ServiceAccounts, by label selector
+type SubjectSelector struct {
+	// Kind is one of User, Group or ServiceAccount
+	Kind string `json:"kind"`
+	// Name of the user, group or service account; for ServiceAccounts, exactly one of name and labelSelector must be set
+	Name string `json:"name,omitempty"`
+	// Namespace of the service accounts, defaulting to the binding's namespace
+	Namespace string `json:"namespace,omitempty"`
+	// LabelSelector selects every ServiceAccount whose labels match, instead of a single service account selected by name
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	// NamespaceSelector selects ServiceAccounts in every namespace whose labels match, instead of a single namespace
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// ComputedBindingStatus is the observed state shared by DynamicRoleBindings and DynamicClusterRoleBindings
+type ComputedBindingStatus struct {
+	// ObservedGeneration is the generation of the spec that the status was computed from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// GeneratedBindingName is the name of the RoleBinding or ClusterRoleBinding created from this object
+	GeneratedBindingName string `json:"generatedBindingName,omitempty"`
+	// SubjectCount is the number of subjects in the generated binding
+	SubjectCount int `json:"subjectCount,omitempty"`
+	// Subjects is the list of subjects that were resolved when the binding was last reconciled
+	Subjects []v1.Subject `json:"subjects,omitempty"`
+	// LastError is the message of the most recent error, cleared once the binding is reconciled successfully
+	LastError string `json:"lastError,omitempty"`
+	// Conditions describe the current state of the generated binding
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// SetCondition adds or updates a condition, only moving its transition time when its status changes
+func (s *ComputedBindingStatus) SetCondition(condition Condition) {
+	s.Conditions = setCondition(s.Conditions, condition)
+}
+
+// GetCondition returns the condition of the given type, or nil if it has not been set
+func (s *ComputedBindingStatus) GetCondition(conditionType ConditionType) *Condition {
+	return getCondition(s.Conditions, conditionType)
+}
+
+func setCondition(conditions []Condition, condition Condition) []Condition {
+	for i, existing := range conditions {
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		conditions[i] = condition
+		return conditions
+	}
+	if condition.LastTransitionTime.IsZero() {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	return append(conditions, condition)
+}
+
+func getCondition(conditions []Condition, conditionType ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
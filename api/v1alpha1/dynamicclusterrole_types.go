@@ -28,17 +28,38 @@ import (
 type DynamicClusterRoleSpec struct {
 	Inherit *[]InheritedRole `json:"inherit,omitempty"`
 	Allow   *[]v1.PolicyRule `json:"allow,omitempty"`
-	Deny    *[]v1.PolicyRule `json:"deny,omitempty"`
+	// Deny removes the denied verbs from the inherited and allowed permissions. RBAC cannot express "every URL except these",
+	// so a granted nonResourceURL pattern that a deny rule only partly covers, e.g. `*` against a deny of `/metrics`, is narrowed down to
+	// the URLs the API server serves, dropping any other URL it matched; the NonResourceURLsNarrowed condition lists such patterns
+	Deny *[]v1.PolicyRule `json:"deny,omitempty"`
+	// DenySubresources makes deny rules that name a parent resource (e.g. pods) also deny all of its subresources (e.g. pods/exec)
+	DenySubresources bool `json:"denySubresources,omitempty"`
+	// Precedence is AllowOverrides, the default, to apply the deny rules before the allow rules, or DenyOverrides to apply them after
+	Precedence Precedence `json:"precedence,omitempty"`
+	// Compact regroups the generated rules so that resources and API groups sharing the same verbs are listed in a single rule, instead of one rule per resource
+	Compact bool `json:"compact,omitempty"`
+	// Mode is Enforce, the default, to write the computed rules to the generated role, or Preview to only publish them in status for review
+	Mode RoleMode `json:"mode,omitempty"`
+	// Provenance publishes in status which inherited roles, deny and allow rules granted or removed each permission, for auditing
+	Provenance bool `json:"provenance,omitempty"`
+	// NamespaceSelector stamps the computed rules as a Role into every namespace whose labels match, instead of creating a ClusterRole
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
 }
 
 // DynamicClusterRoleStatus defines the observed state of DynamicClusterRole
 type DynamicClusterRoleStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	ComputedRoleStatus `json:",inline"`
+	// Namespaces lists the namespaces a Role was stamped into when a namespaceSelector is set
+	Namespaces []string `json:"namespaces,omitempty"`
+	// SkippedNamespaces lists the selected namespaces holding a Role of the same name that this DynamicClusterRole does not control, which was left untouched
+	SkippedNamespaces []string `json:"skippedNamespaces,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Rules",type=integer,JSONPath=`.status.ruleCount`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 // +kubebuilder:resource:scope=Cluster
 
 // DynamicClusterRole is the Schema for the dynamicclusterroles API
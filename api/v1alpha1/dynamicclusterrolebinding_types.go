@@ -0,0 +1,67 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+// DynamicClusterRoleBindingSpec defines the desired state of DynamicClusterRoleBinding
+type DynamicClusterRoleBindingSpec struct {
+	// RoleRef is the DynamicClusterRole whose generated role is granted
+	RoleRef RoleReference `json:"roleRef"`
+	// Subjects select the users, groups and service accounts the role is granted to
+	Subjects []SubjectSelector `json:"subjects,omitempty"`
+}
+
+// DynamicClusterRoleBindingStatus defines the observed state of DynamicClusterRoleBinding
+type DynamicClusterRoleBindingStatus struct {
+	ComputedBindingStatus `json:",inline"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Role",type=string,JSONPath=`.spec.roleRef.name`
+// +kubebuilder:printcolumn:name="Subjects",type=integer,JSONPath=`.status.subjectCount`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:resource:scope=Cluster
+
+// DynamicClusterRoleBinding is the Schema for the dynamicclusterrolebindings API
+type DynamicClusterRoleBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DynamicClusterRoleBindingSpec   `json:"spec,omitempty"`
+	Status DynamicClusterRoleBindingStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DynamicClusterRoleBindingList contains a list of DynamicClusterRoleBinding
+type DynamicClusterRoleBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DynamicClusterRoleBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DynamicClusterRoleBinding{}, &DynamicClusterRoleBindingList{})
+}
@@ -0,0 +1,65 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DynamicRBACPolicySpec defines the guardrails applied to the rules of every DynamicRole and DynamicClusterRole
+type DynamicRBACPolicySpec struct {
+	// Deny removes permissions from every generated role, after the inherit, allow and deny rules of its dynamic role have been applied
+	Deny []rbacv1.PolicyRule `json:"deny,omitempty"`
+	// MaxVerbs limits the verbs that generated roles can grant on the resources each entry matches
+	MaxVerbs []VerbLimit `json:"maxVerbs,omitempty"`
+}
+
+// VerbLimit is the most that a generated role can grant on the resources it matches
+type VerbLimit struct {
+	// APIGroups are the API groups of the limited resources, and accept the same patterns as allow and deny rules
+	APIGroups []string `json:"apiGroups"`
+	// Resources are the limited resources, and accept the same patterns as allow and deny rules
+	Resources []string `json:"resources"`
+	// Verbs are the only verbs that can be granted on the limited resources, and accept verb aliases such as read
+	Verbs []string `json:"verbs"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DynamicRBACPolicy is the Schema for the dynamicrbacpolicies API
+type DynamicRBACPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DynamicRBACPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DynamicRBACPolicyList contains a list of DynamicRBACPolicy
+type DynamicRBACPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DynamicRBACPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DynamicRBACPolicy{}, &DynamicRBACPolicyList{})
+}
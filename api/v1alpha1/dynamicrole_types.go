@@ -29,22 +29,41 @@ type DynamicRoleSpec struct {
 	Inherit *[]InheritedRole `json:"inherit,omitempty"`
 	Allow   *[]v1.PolicyRule `json:"allow,omitempty"`
 	Deny    *[]v1.PolicyRule `json:"deny,omitempty"`
+	// DenySubresources makes deny rules that name a parent resource (e.g. pods) also deny all of its subresources (e.g. pods/exec)
+	DenySubresources bool `json:"denySubresources,omitempty"`
+	// Precedence is AllowOverrides, the default, to apply the deny rules before the allow rules, or DenyOverrides to apply them after
+	Precedence Precedence `json:"precedence,omitempty"`
+	// Compact regroups the generated rules so that resources and API groups sharing the same verbs are listed in a single rule, instead of one rule per resource
+	Compact bool `json:"compact,omitempty"`
+	// Mode is Enforce, the default, to write the computed rules to the generated role, or Preview to only publish them in status for review
+	Mode RoleMode `json:"mode,omitempty"`
+	// Provenance publishes in status which inherited roles, deny and allow rules granted or removed each permission, for auditing
+	Provenance bool `json:"provenance,omitempty"`
 }
 
+// InheritedRole references a role whose rules are inherited, either by name or by label selector
 type InheritedRole struct {
-	Name      string `json:"name"`
+	// Name of the role to inherit from; exactly one of name and labelSelector must be set
+	Name string `json:"name,omitempty"`
+	// Kind is one of ClusterRole, Role, DynamicClusterRole or DynamicRole
 	Kind      string `json:"kind"`
 	Namespace string `json:"namespace,omitempty"`
+	// LabelSelector inherits from every ClusterRole or Role whose labels match, instead of a single role selected by name
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	// NamespaceSelector inherits from Roles in every namespace whose labels match, instead of a single namespace; only used with labelSelector
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
 }
 
 // DynamicRoleStatus defines the observed state of DynamicRole
 type DynamicRoleStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	ComputedRoleStatus `json:",inline"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Rules",type=integer,JSONPath=`.status.ruleCount`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // DynamicRole is the Schema for the dynamicroles API
 type DynamicRole struct {
@@ -0,0 +1,66 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+// DynamicRoleBindingSpec defines the desired state of DynamicRoleBinding
+type DynamicRoleBindingSpec struct {
+	// RoleRef is the DynamicRole or DynamicClusterRole whose generated role is granted
+	RoleRef RoleReference `json:"roleRef"`
+	// Subjects select the users, groups and service accounts the role is granted to
+	Subjects []SubjectSelector `json:"subjects,omitempty"`
+}
+
+// DynamicRoleBindingStatus defines the observed state of DynamicRoleBinding
+type DynamicRoleBindingStatus struct {
+	ComputedBindingStatus `json:",inline"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Role",type=string,JSONPath=`.spec.roleRef.name`
+// +kubebuilder:printcolumn:name="Subjects",type=integer,JSONPath=`.status.subjectCount`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DynamicRoleBinding is the Schema for the dynamicrolebindings API
+type DynamicRoleBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DynamicRoleBindingSpec   `json:"spec,omitempty"`
+	Status DynamicRoleBindingStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DynamicRoleBindingList contains a list of DynamicRoleBinding
+type DynamicRoleBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DynamicRoleBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DynamicRoleBinding{}, &DynamicRoleBindingList{})
+}
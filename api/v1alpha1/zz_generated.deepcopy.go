@@ -22,16 +22,101 @@ package v1alpha1
 
 import (
 	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComputedBindingStatus) DeepCopyInto(out *ComputedBindingStatus) {
+	*out = *in
+	if in.Subjects != nil {
+		in, out := &in.Subjects, &out.Subjects
+		*out = make([]v1.Subject, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComputedBindingStatus.
+func (in *ComputedBindingStatus) DeepCopy() *ComputedBindingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ComputedBindingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComputedRoleStatus) DeepCopyInto(out *ComputedRoleStatus) {
+	*out = *in
+	if in.InheritedRoles != nil {
+		in, out := &in.InheritedRoles, &out.InheritedRoles
+		*out = make([]InheritedRole, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Preview != nil {
+		in, out := &in.Preview, &out.Preview
+		*out = new(RulePreview)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Provenance != nil {
+		in, out := &in.Provenance, &out.Provenance
+		*out = make([]PermissionProvenance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComputedRoleStatus.
+func (in *ComputedRoleStatus) DeepCopy() *ComputedRoleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ComputedRoleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DynamicClusterRole) DeepCopyInto(out *DynamicClusterRole) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicClusterRole.
@@ -52,6 +137,104 @@ func (in *DynamicClusterRole) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicClusterRoleBinding) DeepCopyInto(out *DynamicClusterRoleBinding) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicClusterRoleBinding.
+func (in *DynamicClusterRoleBinding) DeepCopy() *DynamicClusterRoleBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicClusterRoleBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DynamicClusterRoleBinding) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicClusterRoleBindingList) DeepCopyInto(out *DynamicClusterRoleBindingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DynamicClusterRoleBinding, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicClusterRoleBindingList.
+func (in *DynamicClusterRoleBindingList) DeepCopy() *DynamicClusterRoleBindingList {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicClusterRoleBindingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DynamicClusterRoleBindingList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicClusterRoleBindingSpec) DeepCopyInto(out *DynamicClusterRoleBindingSpec) {
+	*out = *in
+	out.RoleRef = in.RoleRef
+	if in.Subjects != nil {
+		in, out := &in.Subjects, &out.Subjects
+		*out = make([]SubjectSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicClusterRoleBindingSpec.
+func (in *DynamicClusterRoleBindingSpec) DeepCopy() *DynamicClusterRoleBindingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicClusterRoleBindingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicClusterRoleBindingStatus) DeepCopyInto(out *DynamicClusterRoleBindingStatus) {
+	*out = *in
+	in.ComputedBindingStatus.DeepCopyInto(&out.ComputedBindingStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicClusterRoleBindingStatus.
+func (in *DynamicClusterRoleBindingStatus) DeepCopy() *DynamicClusterRoleBindingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicClusterRoleBindingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DynamicClusterRoleList) DeepCopyInto(out *DynamicClusterRoleList) {
 	*out = *in
@@ -93,7 +276,9 @@ func (in *DynamicClusterRoleSpec) DeepCopyInto(out *DynamicClusterRoleSpec) {
 		if **in != nil {
 			in, out := *in, *out
 			*out = make([]InheritedRole, len(*in))
-			copy(*out, *in)
+			for i := range *in {
+				(*in)[i].DeepCopyInto(&(*out)[i])
+			}
 		}
 	}
 	if in.Allow != nil {
@@ -118,6 +303,11 @@ func (in *DynamicClusterRoleSpec) DeepCopyInto(out *DynamicClusterRoleSpec) {
 			}
 		}
 	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicClusterRoleSpec.
@@ -133,6 +323,17 @@ func (in *DynamicClusterRoleSpec) DeepCopy() *DynamicClusterRoleSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DynamicClusterRoleStatus) DeepCopyInto(out *DynamicClusterRoleStatus) {
 	*out = *in
+	in.ComputedRoleStatus.DeepCopyInto(&out.ComputedRoleStatus)
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SkippedNamespaces != nil {
+		in, out := &in.SkippedNamespaces, &out.SkippedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicClusterRoleStatus.
@@ -145,13 +346,100 @@ func (in *DynamicClusterRoleStatus) DeepCopy() *DynamicClusterRoleStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicRBACPolicy) DeepCopyInto(out *DynamicRBACPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicRBACPolicy.
+func (in *DynamicRBACPolicy) DeepCopy() *DynamicRBACPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicRBACPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DynamicRBACPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicRBACPolicyList) DeepCopyInto(out *DynamicRBACPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DynamicRBACPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicRBACPolicyList.
+func (in *DynamicRBACPolicyList) DeepCopy() *DynamicRBACPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicRBACPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DynamicRBACPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicRBACPolicySpec) DeepCopyInto(out *DynamicRBACPolicySpec) {
+	*out = *in
+	if in.Deny != nil {
+		in, out := &in.Deny, &out.Deny
+		*out = make([]v1.PolicyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MaxVerbs != nil {
+		in, out := &in.MaxVerbs, &out.MaxVerbs
+		*out = make([]VerbLimit, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicRBACPolicySpec.
+func (in *DynamicRBACPolicySpec) DeepCopy() *DynamicRBACPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicRBACPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DynamicRole) DeepCopyInto(out *DynamicRole) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicRole.
@@ -172,6 +460,104 @@ func (in *DynamicRole) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicRoleBinding) DeepCopyInto(out *DynamicRoleBinding) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicRoleBinding.
+func (in *DynamicRoleBinding) DeepCopy() *DynamicRoleBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicRoleBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DynamicRoleBinding) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicRoleBindingList) DeepCopyInto(out *DynamicRoleBindingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DynamicRoleBinding, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicRoleBindingList.
+func (in *DynamicRoleBindingList) DeepCopy() *DynamicRoleBindingList {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicRoleBindingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DynamicRoleBindingList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicRoleBindingSpec) DeepCopyInto(out *DynamicRoleBindingSpec) {
+	*out = *in
+	out.RoleRef = in.RoleRef
+	if in.Subjects != nil {
+		in, out := &in.Subjects, &out.Subjects
+		*out = make([]SubjectSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicRoleBindingSpec.
+func (in *DynamicRoleBindingSpec) DeepCopy() *DynamicRoleBindingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicRoleBindingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicRoleBindingStatus) DeepCopyInto(out *DynamicRoleBindingStatus) {
+	*out = *in
+	in.ComputedBindingStatus.DeepCopyInto(&out.ComputedBindingStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicRoleBindingStatus.
+func (in *DynamicRoleBindingStatus) DeepCopy() *DynamicRoleBindingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicRoleBindingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DynamicRoleList) DeepCopyInto(out *DynamicRoleList) {
 	*out = *in
@@ -213,7 +599,9 @@ func (in *DynamicRoleSpec) DeepCopyInto(out *DynamicRoleSpec) {
 		if **in != nil {
 			in, out := *in, *out
 			*out = make([]InheritedRole, len(*in))
-			copy(*out, *in)
+			for i := range *in {
+				(*in)[i].DeepCopyInto(&(*out)[i])
+			}
 		}
 	}
 	if in.Allow != nil {
@@ -253,6 +641,7 @@ func (in *DynamicRoleSpec) DeepCopy() *DynamicRoleSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DynamicRoleStatus) DeepCopyInto(out *DynamicRoleStatus) {
 	*out = *in
+	in.ComputedRoleStatus.DeepCopyInto(&out.ComputedRoleStatus)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicRoleStatus.
@@ -268,6 +657,16 @@ func (in *DynamicRoleStatus) DeepCopy() *DynamicRoleStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InheritedRole) DeepCopyInto(out *InheritedRole) {
 	*out = *in
+	if in.LabelSelector != nil {
+		in, out := &in.LabelSelector, &out.LabelSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InheritedRole.
@@ -279,3 +678,136 @@ func (in *InheritedRole) DeepCopy() *InheritedRole {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PermissionProvenance) DeepCopyInto(out *PermissionProvenance) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]v1.PolicyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PermissionProvenance.
+func (in *PermissionProvenance) DeepCopy() *PermissionProvenance {
+	if in == nil {
+		return nil
+	}
+	out := new(PermissionProvenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RoleReference) DeepCopyInto(out *RoleReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoleReference.
+func (in *RoleReference) DeepCopy() *RoleReference {
+	if in == nil {
+		return nil
+	}
+	out := new(RoleReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RulePreview) DeepCopyInto(out *RulePreview) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]v1.PolicyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Added != nil {
+		in, out := &in.Added, &out.Added
+		*out = make([]v1.PolicyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Removed != nil {
+		in, out := &in.Removed, &out.Removed
+		*out = make([]v1.PolicyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RulePreview.
+func (in *RulePreview) DeepCopy() *RulePreview {
+	if in == nil {
+		return nil
+	}
+	out := new(RulePreview)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubjectSelector) DeepCopyInto(out *SubjectSelector) {
+	*out = *in
+	if in.LabelSelector != nil {
+		in, out := &in.LabelSelector, &out.LabelSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubjectSelector.
+func (in *SubjectSelector) DeepCopy() *SubjectSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(SubjectSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VerbLimit) DeepCopyInto(out *VerbLimit) {
+	*out = *in
+	if in.APIGroups != nil {
+		in, out := &in.APIGroups, &out.APIGroups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Verbs != nil {
+		in, out := &in.Verbs, &out.Verbs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VerbLimit.
+func (in *VerbLimit) DeepCopy() *VerbLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(VerbLimit)
+	in.DeepCopyInto(out)
+	return out
+}
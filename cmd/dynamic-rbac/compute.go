@@ -0,0 +1,158 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/controllers"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// compute prints the roles generated from every dynamic role in the input files
+// The input files stand in for the cluster: inherited roles and selected namespaces are looked up among them
+func compute(args []string) error {
+	flags := flag.NewFlagSet("compute", flag.ExitOnError)
+	discoveryPath := flags.String("discovery", "", "The file holding the cluster's API resources, as printed by `dynamic-rbac discover`.")
+	defaultNamespace := flags.String("namespace", "default", "The namespace of input objects that do not specify one.")
+	var paths fileList
+	flags.Var(&paths, "f", "A YAML file holding DynamicRoles, DynamicClusterRoles and the objects they refer to; can be repeated, - reads stdin.")
+	flags.Parse(args)
+	if *discoveryPath == "" || len(paths) == 0 {
+		return fmt.Errorf("both -discovery and -f are required")
+	}
+
+	c, discovery, in, err := load(*discoveryPath, paths, *defaultNamespace)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(in.dynamicClusterRoles, func(i, j int) bool {
+		return in.dynamicClusterRoles[i].Name < in.dynamicClusterRoles[j].Name
+	})
+	sort.Slice(in.dynamicRoles, func(i, j int) bool {
+		if in.dynamicRoles[i].Namespace != in.dynamicRoles[j].Namespace {
+			return in.dynamicRoles[i].Namespace < in.dynamicRoles[j].Namespace
+		}
+		return in.dynamicRoles[i].Name < in.dynamicRoles[j].Name
+	})
+
+	failed := 0
+	for _, dynamicClusterRole := range in.dynamicClusterRoles {
+		spec := dynamicClusterRole.Spec
+		if !validate("DynamicClusterRole "+dynamicClusterRole.Name, helpers.ClusterRole, spec.Inherit, spec.Allow, spec.Deny, discovery) {
+			failed++
+			continue
+		}
+		outputs, err := computeDynamicClusterRole(c, discovery, dynamicClusterRole)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: DynamicClusterRole %s: %v\n", dynamicClusterRole.Name, err)
+			failed++
+			continue
+		}
+		for _, output := range outputs {
+			if err := printObject(output); err != nil {
+				return err
+			}
+		}
+	}
+	for _, dynamicRole := range in.dynamicRoles {
+		spec := dynamicRole.Spec
+		if !validate(fmt.Sprintf("DynamicRole %s/%s", dynamicRole.Namespace, dynamicRole.Name), helpers.Role, spec.Inherit, spec.Allow, spec.Deny, discovery) {
+			failed++
+			continue
+		}
+		role, _, err := controllers.ComputeDynamicRole(c, discovery, helpers.NewDependencies(), dynamicRole, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: DynamicRole %s/%s: %v\n", dynamicRole.Namespace, dynamicRole.Name, err)
+			failed++
+			continue
+		}
+		role.TypeMeta = typeMeta("Role")
+		if err := printObject(role); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d dynamic roles could not be computed", failed)
+	}
+	return nil
+}
+
+// validate reports the problems the validating webhook would reject a dynamic role for, and the warnings it would return, on stderr
+func validate(description string, roleType helpers.RoleType, inherit *[]rbacv1alpha1.InheritedRole, allow *[]v1.PolicyRule, deny *[]v1.PolicyRule, discovery *helpers.DiscoverySnapshot) bool {
+	warnings, errs := helpers.ValidateDynamicRoleSpec(roleType, field.NewPath("spec"), inherit, allow, deny, discovery)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s: %s\n", description, warning)
+	}
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", description, err)
+	}
+	return len(errs) == 0
+}
+
+// computeDynamicClusterRole returns the ClusterRole generated from a DynamicClusterRole, or the Roles it stamps into the selected namespaces of the input
+func computeDynamicClusterRole(c client.Client, discovery *helpers.DiscoverySnapshot, dynamicClusterRole *rbacv1alpha1.DynamicClusterRole) ([]runtime.Object, error) {
+	clusterRole, _, err := controllers.ComputeDynamicClusterRole(c, discovery, helpers.NewDependencies(), dynamicClusterRole, nil)
+	if err != nil {
+		return nil, err
+	}
+	if dynamicClusterRole.Spec.NamespaceSelector == nil {
+		clusterRole.TypeMeta = typeMeta("ClusterRole")
+		return []runtime.Object{clusterRole}, nil
+	}
+	namespaces, err := controllers.SelectedNamespaces(c, dynamicClusterRole)
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		fmt.Fprintf(os.Stderr, "warning: DynamicClusterRole %s: no Namespace in the input matches its namespaceSelector\n", dynamicClusterRole.Name)
+	}
+	outputs := []runtime.Object{}
+	for _, namespace := range namespaces {
+		role := controllers.StampedRole(dynamicClusterRole, namespace, clusterRole.Rules)
+		role.TypeMeta = typeMeta("Role")
+		outputs = append(outputs, role)
+	}
+	return outputs, nil
+}
+
+// typeMeta returns the apiVersion and kind of an RBAC object, which are not set on objects built in code
+func typeMeta(kind string) metav1.TypeMeta {
+	return metav1.TypeMeta{APIVersion: v1.SchemeGroupVersion.String(), Kind: kind}
+}
+
+// printObject prints an object as a YAML document
+func printObject(object runtime.Object) error {
+	data, err := yaml.Marshal(object)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("---\n%s", data)
+	return nil
+}
@@ -0,0 +1,231 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+const testDiscovery = `
+- groupVersion: v1
+  resources:
+  - name: pods
+    namespaced: true
+    kind: Pod
+    verbs: [get, list, delete]
+  - name: secrets
+    namespaced: true
+    kind: Secret
+    verbs: [get, list, delete]
+- groupVersion: apps/v1
+  resources:
+  - name: deployments
+    namespaced: true
+    kind: Deployment
+    verbs: [get, list, delete]
+`
+
+const testInput = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: view
+rules:
+- apiGroups: [""]
+  resources: [pods, secrets]
+  verbs: [get, list]
+---
+apiVersion: rbac.redhatcop.redhat.io/v1alpha1
+kind: DynamicClusterRole
+metadata:
+  name: reader
+spec:
+  inherit:
+  - kind: ClusterRole
+    name: view
+  deny:
+  - apiGroups: [""]
+    resources: [secrets]
+    verbs: ["*"]
+---
+apiVersion: rbac.redhatcop.redhat.io/v1alpha1
+kind: DynamicClusterRole
+metadata:
+  name: tenant
+spec:
+  mode: Preview
+  namespaceSelector:
+    matchLabels:
+      tenant: "yes"
+  allow:
+  - apiGroups: [apps]
+    resources: [deployments]
+    verbs: [get]
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a
+  labels:
+    tenant: "yes"
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: other
+---
+apiVersion: rbac.redhatcop.redhat.io/v1alpha1
+kind: DynamicRole
+metadata:
+  name: developer
+spec:
+  allow:
+  - apiGroups: [""]
+    resources: [pods]
+    verbs: [delete]
+`
+
+// writeTestFiles writes the discovery document and the input files of a test into a temporary directory, returning their paths
+func writeTestFiles(t *testing.T, inputs ...string) (string, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	discoveryPath := filepath.Join(dir, "discovery.yaml")
+	if err := ioutil.WriteFile(discoveryPath, []byte(testDiscovery), 0644); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for i, input := range inputs {
+		path := filepath.Join(dir, string(rune('a'+i))+".yaml")
+		if err := ioutil.WriteFile(path, []byte(input), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return discoveryPath, paths
+}
+
+// captureStdout returns what run printed on stdout
+func captureStdout(t *testing.T, run func() error) (string, error) {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	output := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(reader)
+		output <- string(data)
+	}()
+	runErr := run()
+	os.Stdout = stdout
+	writer.Close()
+	return <-output, runErr
+}
+
+// generatedRole is the part of a printed Role or ClusterRole that the tests look at
+type generatedRole struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Rules []v1.PolicyRule `json:"rules"`
+}
+
+func parseGeneratedRoles(t *testing.T, output string) []generatedRole {
+	t.Helper()
+	roles := []generatedRole{}
+	for _, document := range strings.Split(output, "---\n") {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+		role := generatedRole{}
+		if err := yaml.Unmarshal([]byte(document), &role); err != nil {
+			t.Fatalf("could not parse the output document %q: %v", document, err)
+		}
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+func TestCompute(t *testing.T) {
+	discoveryPath, paths := writeTestFiles(t, testInput)
+	output, err := captureStdout(t, func() error {
+		return compute([]string{"-discovery", discoveryPath, "-f", paths[0], "-namespace", "team-a"})
+	})
+	if err != nil {
+		t.Fatalf("compute() error = %v", err)
+	}
+	roles := parseGeneratedRoles(t, output)
+
+	want := []struct {
+		kind      string
+		namespace string
+		name      string
+		rules     []v1.PolicyRule
+	}{
+		{kind: "ClusterRole", name: "reader", rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}}},
+		{kind: "Role", namespace: "team-a", name: "tenant", rules: []v1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}}}},
+		{kind: "Role", namespace: "team-a", name: "developer", rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"delete"}}}},
+	}
+	if len(roles) != len(want) {
+		t.Fatalf("compute() printed %d roles, want %d:\n%s", len(roles), len(want), output)
+	}
+	for i, role := range roles {
+		if role.Kind != want[i].kind || role.Metadata.Namespace != want[i].namespace || role.Metadata.Name != want[i].name {
+			t.Errorf("role %d is %s %s/%s, want %s %s/%s", i, role.Kind, role.Metadata.Namespace, role.Metadata.Name, want[i].kind, want[i].namespace, want[i].name)
+		}
+		if got := helpers.NormalizePolicyRules(role.Rules); !reflect.DeepEqual(got, helpers.NormalizePolicyRules(want[i].rules)) {
+			t.Errorf("%s %s has rules %v, want %v", role.Kind, role.Metadata.Name, role.Rules, want[i].rules)
+		}
+	}
+}
+
+func TestComputeReportsInvalidDynamicRoles(t *testing.T) {
+	invalid := `
+apiVersion: rbac.redhatcop.redhat.io/v1alpha1
+kind: DynamicClusterRole
+metadata:
+  name: broken
+spec:
+  inherit:
+  - kind: Role
+    name: developer
+`
+	discoveryPath, paths := writeTestFiles(t, testInput, invalid)
+	output, err := captureStdout(t, func() error {
+		return compute([]string{"-discovery", discoveryPath, "-f", paths[0], "-f", paths[1], "-namespace", "team-a"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 dynamic roles could not be computed") {
+		t.Errorf("compute() error = %v, want 1 dynamic role not computed", err)
+	}
+	if roles := parseGeneratedRoles(t, output); len(roles) != 3 {
+		t.Errorf("compute() printed %d roles, want the 3 valid ones to be printed anyway", len(roles))
+	}
+}
@@ -0,0 +1,53 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/discovery"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// discover prints the API resources of the cluster in the current kubeconfig, for use as the discovery document of `dynamic-rbac compute`
+func discover(args []string) error {
+	flags := flag.NewFlagSet("discover", flag.ExitOnError)
+	flags.Parse(args)
+
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+	_, resourceLists, err := helpers.DiscoverClusterResources(config)
+	if discovery.IsGroupDiscoveryFailedError(err) {
+		// The operator retains the resources of these groups from an earlier discovery, which is not available here
+		fmt.Fprintf(os.Stderr, "warning: %v; their resources are missing from the output\n", err)
+	} else if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(resourceLists)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/controllers"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// explain prints which inherited roles, deny and allow rules of a dynamic role granted or removed a verb on a resource or nonResourceURL
+func explain(args []string) error {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	discoveryPath := flags.String("discovery", "", "The file holding the cluster's API resources, as printed by `dynamic-rbac discover`.")
+	defaultNamespace := flags.String("namespace", "default", "The namespace of input objects that do not specify one.")
+	var paths fileList
+	flags.Var(&paths, "f", "A YAML file holding DynamicRoles, DynamicClusterRoles and the objects they refer to; can be repeated, - reads stdin.")
+	role := flags.String("role", "", "The dynamic role to explain, as DynamicClusterRole/<name> or DynamicRole/[<namespace>/]<name>.")
+	verb := flags.String("verb", "", "The verb to explain.")
+	apiGroup := flags.String("group", "", "The API group of the resource; empty for the core group.")
+	resource := flags.String("resource", "", "The resource to explain, e.g. secrets or pods/exec.")
+	resourceName := flags.String("resource-name", "", "The name of a single object of the resource.")
+	nonResourceURL := flags.String("non-resource-url", "", "The nonResourceURL to explain, instead of a resource.")
+	flags.Parse(args)
+	if *discoveryPath == "" || len(paths) == 0 || *role == "" || *verb == "" {
+		return fmt.Errorf("-discovery, -f, -role and -verb are required")
+	}
+	if (*resource == "") == (*nonResourceURL == "") {
+		return fmt.Errorf("exactly one of -resource and -non-resource-url is required")
+	}
+
+	c, discovery, in, err := load(*discoveryPath, paths, *defaultNamespace)
+	if err != nil {
+		return err
+	}
+	provenance := helpers.NewProvenance()
+	kind, name := splitRole(*role, *defaultNamespace)
+	found := false
+	switch kind {
+	case "DynamicClusterRole":
+		for _, dynamicClusterRole := range in.dynamicClusterRoles {
+			if dynamicClusterRole.Name == name {
+				found = true
+				if _, _, err := controllers.ComputeDynamicClusterRole(c, discovery, helpers.NewDependencies(), dynamicClusterRole, provenance); err != nil {
+					return err
+				}
+			}
+		}
+	case "DynamicRole":
+		for _, dynamicRole := range in.dynamicRoles {
+			if dynamicRole.Namespace+"/"+dynamicRole.Name == name {
+				found = true
+				if _, _, err := controllers.ComputeDynamicRole(c, discovery, helpers.NewDependencies(), dynamicRole, provenance); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("-role must start with DynamicClusterRole/ or DynamicRole/")
+	}
+	if !found {
+		return fmt.Errorf("%s not found in the input files", *role)
+	}
+
+	var explanations []helpers.Explanation
+	subject := fmt.Sprintf("%s %s", *verb, *nonResourceURL)
+	if *nonResourceURL != "" {
+		explanations = provenance.ExplainNonResourceURL(*nonResourceURL, *verb)
+	} else {
+		explanations = provenance.Explain(*apiGroup, *resource, *resourceName, *verb)
+		subject = fmt.Sprintf("%s %s", *verb, describeResource(*apiGroup, *resource, *resourceName))
+	}
+
+	granted := false
+	for _, explanation := range explanations {
+		fmt.Println(helpers.DescribePolicyRule(explanation.Rule))
+		for _, step := range explanation.Steps {
+			if step.Rule != nil {
+				fmt.Printf("  %s: %s\n", step, helpers.DescribePolicyRule(*step.Rule))
+			} else {
+				fmt.Printf("  %s\n", step)
+			}
+		}
+		granted = granted || explanation.Granted
+	}
+	if len(explanations) == 0 {
+		fmt.Printf("%s: no inherited role or allow rule grants %s\n", kind+"/"+name, subject)
+	}
+	if granted {
+		fmt.Printf("%s/%s can %s\n", kind, name, subject)
+	} else {
+		fmt.Printf("%s/%s cannot %s\n", kind, name, subject)
+	}
+	return nil
+}
+
+// splitRole splits a -role value into a kind and a name, putting a DynamicRole without a namespace into defaultNamespace
+func splitRole(role string, defaultNamespace string) (string, string) {
+	parts := strings.SplitN(role, "/", 2)
+	if len(parts) < 2 {
+		return role, ""
+	}
+	if parts[0] == "DynamicRole" && !strings.Contains(parts[1], "/") {
+		return parts[0], defaultNamespace + "/" + parts[1]
+	}
+	return parts[0], parts[1]
+}
+
+// describeResource formats a resource the way kubectl does, e.g. `secrets/db-password` or `deployments.apps`
+func describeResource(apiGroup string, resource string, resourceName string) string {
+	description := resource
+	if apiGroup != "" {
+		description = fmt.Sprintf("%s.%s", resource, apiGroup)
+	}
+	if resourceName != "" {
+		description = fmt.Sprintf("%s/%s", description, resourceName)
+	}
+	return description
+}
@@ -0,0 +1,85 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	discoveryPath, paths := writeTestFiles(t, testInput)
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "granted",
+			args: []string{"-role", "DynamicClusterRole/reader", "-verb", "get", "-resource", "pods"},
+			want: []string{"ClusterRole/view", "DynamicClusterRole/reader can get pods"},
+		},
+		{
+			name: "removed by a deny rule",
+			args: []string{"-role", "DynamicClusterRole/reader", "-verb", "get", "-resource", "secrets"},
+			want: []string{"ClusterRole/view", "deny[0]", "DynamicClusterRole/reader cannot get secrets"},
+		},
+		{
+			name: "never granted",
+			args: []string{"-role", "DynamicRole/developer", "-verb", "get", "-resource", "deployments", "-group", "apps"},
+			want: []string{"no inherited role or allow rule grants get deployments.apps", "DynamicRole/team-a/developer cannot get deployments.apps"},
+		},
+		{
+			name:    "unknown dynamic role",
+			args:    []string{"-role", "DynamicRole/missing", "-verb", "get", "-resource", "pods"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"-discovery", discoveryPath, "-f", paths[0], "-namespace", "team-a"}, test.args...)
+			output, err := captureStdout(t, func() error { return explain(args) })
+			if (err != nil) != test.wantErr {
+				t.Fatalf("explain() error = %v, wantErr %v", err, test.wantErr)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(output, want) {
+					t.Errorf("explain() printed\n%s\nwant it to mention %q", output, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitRole(t *testing.T) {
+	tests := []struct {
+		role     string
+		wantKind string
+		wantName string
+	}{
+		{role: "DynamicClusterRole/reader", wantKind: "DynamicClusterRole", wantName: "reader"},
+		{role: "DynamicRole/developer", wantKind: "DynamicRole", wantName: "default/developer"},
+		{role: "DynamicRole/team-a/developer", wantKind: "DynamicRole", wantName: "team-a/developer"},
+		{role: "reader", wantKind: "reader"},
+	}
+	for _, test := range tests {
+		if kind, name := splitRole(test.role, "default"); kind != test.wantKind || name != test.wantName {
+			t.Errorf("splitRole(%q) = %q, %q, want %q, %q", test.role, kind, name, test.wantKind, test.wantName)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// input holds the objects read from the input files
+type input struct {
+	// objects are every object read, which dynamic roles can inherit from or select
+	objects             []runtime.Object
+	dynamicRoles        []*rbacv1alpha1.DynamicRole
+	dynamicClusterRoles []*rbacv1alpha1.DynamicClusterRole
+}
+
+// load reads the discovery file and the input files, and returns a client serving the input objects in place of a cluster
+func load(discoveryPath string, paths []string, defaultNamespace string) (client.Client, *helpers.DiscoverySnapshot, *input, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := rbacv1alpha1.AddToScheme(scheme); err != nil {
+		return nil, nil, nil, err
+	}
+	discovery, err := readDiscovery(discoveryPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	in, err := readInput(scheme, paths, defaultNamespace)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return fake.NewFakeClientWithScheme(scheme, in.objects...), discovery, in, nil
+}
+
+// readInput decodes every YAML or JSON document in the given files, with "-" standing for stdin
+// Namespaced objects without a namespace are put into defaultNamespace, and dynamic roles in Preview mode are computed as if they were enforced
+func readInput(scheme *runtime.Scheme, paths []string, defaultNamespace string) (*input, error) {
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	in := &input{}
+	for _, path := range paths {
+		documents, err := readDocuments(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, document := range documents {
+			object, gvk, err := decoder.Decode(document, nil, nil)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			accessor, err := meta.Accessor(object)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			switch typed := object.(type) {
+			case *rbacv1alpha1.DynamicRole:
+				typed.Spec.Mode = rbacv1alpha1.ModeEnforce
+				in.dynamicRoles = append(in.dynamicRoles, typed)
+			case *rbacv1alpha1.DynamicClusterRole:
+				typed.Spec.Mode = rbacv1alpha1.ModeEnforce
+				in.dynamicClusterRoles = append(in.dynamicClusterRoles, typed)
+			}
+			if accessor.GetNamespace() == "" && namespaced(gvk.Kind) {
+				accessor.SetNamespace(defaultNamespace)
+			}
+			in.objects = append(in.objects, object)
+		}
+	}
+	return in, nil
+}
+
+// namespaced returns true for the kinds read from the input files that live in a namespace
+func namespaced(kind string) bool {
+	switch kind {
+	case "DynamicRole", "DynamicRoleBinding", "Role", "RoleBinding", "ServiceAccount":
+		return true
+	}
+	return false
+}
+
+// readDocuments splits a file into its YAML documents, skipping empty ones
+func readDocuments(path string) ([][]byte, error) {
+	var file io.Reader = os.Stdin
+	if path != "-" {
+		opened, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer opened.Close()
+		file = opened
+	}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(file))
+	documents := [][]byte{}
+	for {
+		document, err := reader.Read()
+		if err == io.EOF {
+			return documents, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(bytes.TrimSpace(document)) == 0 {
+			continue
+		}
+		documents = append(documents, document)
+	}
+}
+
+// readDiscovery reads a discovery document, the list of API resources printed by `dynamic-rbac discover`, into a discovery snapshot
+func readDiscovery(path string) (*helpers.DiscoverySnapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	resourceLists := []*metav1.APIResourceList{}
+	if err := yaml.Unmarshal(data, &resourceLists); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &helpers.DiscoverySnapshot{Rules: helpers.APIResourcesToExpandedRules(resourceLists)}, nil
+}
@@ -0,0 +1,73 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// dynamic-rbac computes the roles generated from DynamicRoles and DynamicClusterRoles without a cluster, using the same code as the operator
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const usage = `Usage:
+  dynamic-rbac compute -discovery <file> -f <file> [-f <file>...] [-namespace <namespace>]
+      Prints the Roles and ClusterRoles generated from the DynamicRoles and DynamicClusterRoles in the input files.
+      The input files may also contain the ClusterRoles, Roles and Namespaces they inherit from or select.
+  dynamic-rbac explain -discovery <file> -f <file> [-f <file>...] -role <kind>/<name> -verb <verb> (-resource <resource> [-group <group>] [-resource-name <name>] | -non-resource-url <url>)
+      Prints which inherited roles, deny and allow rules of a dynamic role granted or removed a verb, and whether the role ends up with it.
+      -role is DynamicClusterRole/<name> or DynamicRole/[<namespace>/]<name>.
+  dynamic-rbac discover
+      Prints the cluster's API resources, as used by -discovery, from the cluster in the current kubeconfig.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "compute":
+		err = compute(os.Args[2:])
+	case "explain":
+		err = explain(os.Args[2:])
+	case "discover":
+		err = discover(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// fileList collects the values of a flag that can be repeated
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	helpers "github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// APIServiceReconciler reconciles an APIService object
+// Aggregated APIs, e.g. metrics.k8s.io, add or remove resources from discovery when their APIService is created, deleted or changes availability
+type APIServiceReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Cache    *helpers.ResourceCache
+	Queue    *RecomputeQueue
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=apiregistration.k8s.io,resources=apiservices,verbs=get;list;watch
+
+func (r *APIServiceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	_ = context.Background()
+	_ = r.Log.WithValues("apiservice", req.NamespacedName)
+
+	instance := &unstructured.Unstructured{}
+	instance.SetGroupVersionKind(helpers.APIServiceGVK)
+	err := r.Client.Get(context.TODO(), req.NamespacedName, instance)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			// Error reading the object - requeue the request.
+			return reconcile.Result{}, err
+		}
+		// Request object not found, could have been deleted after reconcile request.
+		known, wasAvailable := r.Cache.DeleteAPIService(req.Name)
+		if known && !wasAvailable {
+			r.Log.Info("Unavailable APIService deleted - reconciliation is not required")
+			return reconcile.Result{}, nil
+		}
+		r.Log.Info("APIService deleted - recomputation of affected dynamic roles is required")
+		return RefreshDiscoveryAndRecompute("APIService", r.Client, r.Log, r.Cache, r.Queue, r.Recorder)
+	}
+
+	available := helpers.APIServiceAvailable(instance)
+	if !r.Cache.SetAPIServiceAvailable(instance.GetName(), available) {
+		r.Log.Info("APIService is in cache and its availability is unchanged - reconciliation is not required")
+		return reconcile.Result{}, nil
+	}
+	r.Log.Info("APIService is new or its availability changed - recomputation of affected dynamic roles is required", "available", available)
+
+	return RefreshDiscoveryAndRecompute("APIService", r.Client, r.Log, r.Cache, r.Queue, r.Recorder)
+}
+
+func (r *APIServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	apiService := &unstructured.Unstructured{}
+	apiService.SetGroupVersionKind(helpers.APIServiceGVK)
+	return ctrl.NewControllerManagedBy(mgr).
+		For(apiService).
+		Complete(r)
+}
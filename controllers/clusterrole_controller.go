@@ -18,12 +18,17 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/go-logr/logr"
 	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	rbacv1 "k8s.io/api/rbac/v1"
 )
@@ -31,9 +36,11 @@ import (
 // ClusterRoleReconciler reconciles a ClusterRole object
 type ClusterRoleReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-	Cache  *helpers.ResourceCache
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Cache    *helpers.ResourceCache
+	Queue    *RecomputeQueue
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=clusterroles,verbs=get;list;watch;create;update;patch;delete
@@ -43,15 +50,26 @@ func (r *ClusterRoleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	_ = context.Background()
 	_ = r.Log.WithValues("clusterrole", req.NamespacedName)
 
-	result := ctrl.Result{}
-	var err error
+	dependants := r.Cache.Dependencies.DependantsOfClusterRole(req.Name)
 
-	if _, exists := r.Cache.WatchedClusterRoles[req.NamespacedName]; exists {
-		r.Log.Info("A cluster role referenced by a dynamic resource has been updated - reconciling now")
-		result, err = UpdateAllDynamicResources(r.Client, r.Log, r.Scheme, r.Cache)
+	clusterRole := &rbacv1.ClusterRole{}
+	err := r.Client.Get(context.TODO(), req.NamespacedName, clusterRole)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		// A deleted cluster role may have matched a label selector of a dynamic resource, and its labels are no longer known
+		dependants = append(dependants, r.Cache.Dependencies.DependantsOfDeletedClusterRole()...)
+	} else {
+		dependants = append(dependants, r.Cache.Dependencies.DependantsOfClusterRoleLabels(labels.Set(clusterRole.Labels))...)
 	}
 
-	return result, err
+	if len(dependants) > 0 {
+		r.Log.Info(fmt.Sprintf("A cluster role inherited by %d dynamic resources has been updated - recomputing them now", len(dependants)))
+		r.Queue.Enqueue("ClusterRole", dependants)
+	}
+
+	return reconcile.Result{}, nil
 }
 
 func (r *ClusterRoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// ComputeDynamicRole computes the Role generated from a DynamicRole without writing it, and records what its rules were computed from in dependencies
+// It is shared by the DynamicRole controller and the offline `dynamic-rbac compute` command; provenance may be nil
+func ComputeDynamicRole(c client.Client, discovery *helpers.DiscoverySnapshot, dependencies *helpers.Dependencies, dynamicRole *rbacv1alpha1.DynamicRole, provenance *helpers.Provenance) (*v1.Role, []rbacv1alpha1.InheritedRole, error) {
+	spec := dynamicRole.Spec
+	timer := prometheus.NewTimer(buildPolicyRulesDuration.WithLabelValues(dependantKindDynamicRole))
+	rules, inheritedRoles, err := helpers.BuildPolicyRules(helpers.BuildContext{Client: c, Discovery: discovery, Dependencies: dependencies, Provenance: provenance}, helpers.DynamicRoleLink(dynamicRole.Namespace, dynamicRole.Name), helpers.Role, dynamicRole.Namespace, helpers.DynamicRoleRuleSpec(&spec))
+	timer.ObserveDuration()
+	if err != nil {
+		return nil, nil, err
+	}
+	outputRules := *rules
+	if spec.Compact {
+		outputRules = helpers.CompactPolicyRules(outputRules)
+	}
+	return &v1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dynamicRole.Name,
+			Namespace: dynamicRole.Namespace,
+			Annotations: map[string]string{
+				"managed-by": "dynamic-rbac-operator",
+			},
+		},
+		Rules: outputRules,
+	}, inheritedRoles, nil
+}
+
+// ComputeDynamicClusterRole computes the ClusterRole generated from a DynamicClusterRole without writing it, and records what its rules were computed from in dependencies
+// It is shared by the DynamicClusterRole controller and the offline `dynamic-rbac compute` command; provenance may be nil
+func ComputeDynamicClusterRole(c client.Client, discovery *helpers.DiscoverySnapshot, dependencies *helpers.Dependencies, dynamicClusterRole *rbacv1alpha1.DynamicClusterRole, provenance *helpers.Provenance) (*v1.ClusterRole, []rbacv1alpha1.InheritedRole, error) {
+	spec := dynamicClusterRole.Spec
+	timer := prometheus.NewTimer(buildPolicyRulesDuration.WithLabelValues(dependantKindDynamicClusterRole))
+	rules, inheritedRoles, err := helpers.BuildPolicyRules(helpers.BuildContext{Client: c, Discovery: discovery, Dependencies: dependencies, Provenance: provenance}, helpers.DynamicClusterRoleLink(dynamicClusterRole.Name), helpers.ClusterRole, "", helpers.DynamicClusterRoleRuleSpec(&spec))
+	timer.ObserveDuration()
+	if err != nil {
+		return nil, nil, err
+	}
+	outputRules := *rules
+	if spec.Compact {
+		outputRules = helpers.CompactPolicyRules(outputRules)
+	}
+	return &v1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: dynamicClusterRole.Name,
+			Annotations: map[string]string{
+				"managed-by": "dynamic-rbac-operator",
+			},
+		},
+		Rules: outputRules,
+	}, inheritedRoles, nil
+}
+
+// StampedRole returns the Role that a DynamicClusterRole with a namespaceSelector stamps into a namespace, with the rules of its computed ClusterRole
+// nonResourceURLs are dropped, because namespaced Roles cannot grant them
+func StampedRole(dynamicClusterRole *rbacv1alpha1.DynamicClusterRole, namespace string, rules []v1.PolicyRule) *v1.Role {
+	return &v1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dynamicClusterRole.Name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				DynamicClusterRoleLabel: dynamicClusterRole.Name,
+			},
+			Annotations: map[string]string{
+				"managed-by": "dynamic-rbac-operator",
+			},
+		},
+		Rules: helpers.StripNonResourceURLs(rules),
+	}
+}
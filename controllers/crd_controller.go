@@ -18,12 +18,12 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/go-logr/logr"
-	crdv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -34,19 +34,22 @@ import (
 // CustomResourceDefinitionReconciler reconciles a CustomResourceDefinition object
 type CustomResourceDefinitionReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-	Cache  *helpers.ResourceCache
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Cache    *helpers.ResourceCache
+	Queue    *RecomputeQueue
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicroles,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicroles/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch
 
 func (r *CustomResourceDefinitionReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	_ = context.Background()
-	_ = r.Log.WithValues("dynamicrole", req.NamespacedName)
+	_ = r.Log.WithValues("customresourcedefinition", req.NamespacedName)
 
-	instance := &crdv1beta1.CustomResourceDefinition{}
+	instance := &crdv1.CustomResourceDefinition{}
 	crdWasDeleted := false
 	err := r.Client.Get(context.TODO(), req.NamespacedName, instance)
 	if err != nil {
@@ -60,42 +63,21 @@ func (r *CustomResourceDefinitionReconciler) Reconcile(req ctrl.Request) (ctrl.R
 	}
 
 	if !crdWasDeleted {
-		crdJSON, _ := json.Marshal(instance.Spec)
-		if _, ok := r.Cache.CRDs[instance.Name]; ok {
-			r.Cache.CRDs[instance.Name] = string(crdJSON)
-			r.Log.Info("CRD is in cache - reconciliation is not required")
+		if !r.Cache.SetCRDFingerprint(instance.Name, helpers.CRDFingerprint(instance)) {
+			r.Log.Info("CRD is in cache and its served resources are unchanged - reconciliation is not required")
 			return reconcile.Result{}, nil
 		}
-		r.Cache.CRDs[instance.Name] = string(crdJSON)
-		r.Log.Info("CRD not previously seen - reconciliation of all computed roles is required")
+		r.Log.Info("CRD is new or its served resources changed - recomputation of affected dynamic roles is required")
 	} else {
-		delete(r.Cache.CRDs, req.Name)
-		r.Log.Info("CRD deleted - reconciliation of all computed roles is required")
+		r.Cache.DeleteCRD(req.Name)
+		r.Log.Info("CRD deleted - recomputation of affected dynamic roles is required")
 	}
 
-	// Refresh policy cache
-	config, err := ctrl.GetConfig()
-	if err != nil {
-		return reconcile.Result{}, err
-	}
-	_, apiResourceList, err := helpers.DiscoverClusterResources(config)
-	if err != nil {
-		return reconcile.Result{}, err
-	}
-	allPossibleRules := helpers.APIResourcesToExpandedRules(apiResourceList)
-	r.Cache.AllPolicies = &allPossibleRules
-	r.Log.Info("Rebuilt cluster policy cache")
-
-	// Recompute everything using the newly-refreshed cache
-	result, err := UpdateAllDynamicResources(r.Client, r.Log, r.Scheme, r.Cache)
-
-	r.Log.Info("All computed roles have been reconciled")
-
-	return result, err
+	return RefreshDiscoveryAndRecompute("CustomResourceDefinition", r.Client, r.Log, r.Cache, r.Queue, r.Recorder)
 }
 
 func (r *CustomResourceDefinitionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&crdv1beta1.CustomResourceDefinition{}).
+		For(&crdv1.CustomResourceDefinition{}).
 		Complete(r)
 }
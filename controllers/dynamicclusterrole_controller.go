@@ -21,14 +21,20 @@ import (
 	"fmt"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
 	helpers "github.com/redhat-cop/dynamic-rbac-operator/helpers"
@@ -37,13 +43,19 @@ import (
 // DynamicClusterRoleReconciler reconciles a DynamicClusterRole object
 type DynamicClusterRoleReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-	Cache  *helpers.ResourceCache
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Cache    *helpers.ResourceCache
+	Queue    *RecomputeQueue
+	Recorder record.EventRecorder
+
+	// MaxConcurrentReconciles is the number of objects computed concurrently; the shared cache is safe for any value
+	MaxConcurrentReconciles int
 }
 
 // +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicclusterroles,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicclusterroles/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 func (r *DynamicClusterRoleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	_ = context.Background()
@@ -54,38 +66,95 @@ func (r *DynamicClusterRoleReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
+			// Dynamic roles inheriting from it need to report that it is missing
+			r.Cache.Dependencies.Remove(dynamicClusterRoleDependant(req.Name))
+			dynamicRoles.WithLabelValues(dependantKindDynamicClusterRole).Set(float64(r.Cache.Dependencies.Count(dependantKindDynamicClusterRole)))
+			generatedRuleCounts.delete(dependantKindDynamicClusterRole, "", req.Name)
+			r.Queue.Enqueue(dependantKindDynamicClusterRole, r.Cache.Dependencies.DependantsOfDynamicClusterRole(req.Name))
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
 
-	return ReconcileDynamicClusterRole(instance, r.Client, r.Scheme, r.Log, r.Cache)
+	specChanged := instance.Status.ObservedGeneration != instance.Generation
+	result, err := ReconcileDynamicClusterRole(instance, r.Client, r.Scheme, r.Log, r.Cache, r.Recorder)
+	if specChanged {
+		// Dynamic roles inheriting from this one are computed from its spec, so they only need to be recomputed when the spec changes
+		r.Queue.Enqueue(dependantKindDynamicClusterRole, r.Cache.Dependencies.DependantsOfDynamicClusterRole(req.Name))
+	}
+	return result, err
 }
 
-func ReconcileDynamicClusterRole(dynamicClusterRole *rbacv1alpha1.DynamicClusterRole, client client.Client, scheme *runtime.Scheme, logger logr.Logger, cache *helpers.ResourceCache) (ctrl.Result, error) {
-	rules, err := helpers.BuildPolicyRules(client, *cache, helpers.ClusterRole, "", dynamicClusterRole.Spec.Inherit, dynamicClusterRole.Spec.Allow, dynamicClusterRole.Spec.Deny)
+func ReconcileDynamicClusterRole(dynamicClusterRole *rbacv1alpha1.DynamicClusterRole, client client.Client, scheme *runtime.Scheme, logger logr.Logger, cache *helpers.ResourceCache, recorder record.EventRecorder) (ctrl.Result, error) {
+	discovery := cache.Discovery()
+	dependencies := helpers.NewDependencies()
+	var provenance *helpers.Provenance
+	if dynamicClusterRole.Spec.Provenance {
+		provenance = helpers.NewProvenance()
+	}
+	outputRole, inheritedRoles, err := ComputeDynamicClusterRole(client, discovery, dependencies, dynamicClusterRole, provenance)
+	cache.Dependencies.Set(dynamicClusterRoleDependant(dynamicClusterRole.Name), dependencies)
+	recordDiscoveryStaleness(&dynamicClusterRole.Status.ComputedRoleStatus, dynamicClusterRole.Generation, dependencies.StaleAPIGroups(discovery))
+	narrowedURLs := dependencies.NarrowedURLs()
+	if dynamicClusterRole.Spec.NamespaceSelector != nil {
+		// Roles stamped into namespaces do not grant nonResourceURLs at all
+		narrowedURLs = nil
+	}
+	recordNonResourceURLNarrowing(&dynamicClusterRole.Status.ComputedRoleStatus, dynamicClusterRole.Generation, narrowedURLs)
+	dynamicRoles.WithLabelValues(dependantKindDynamicClusterRole).Set(float64(cache.Dependencies.Count(dependantKindDynamicClusterRole)))
 	if err != nil {
-		return reconcile.Result{}, err
+		return reconcileFailed(client, recorder, dynamicClusterRole, &dynamicClusterRole.Status.ComputedRoleStatus, dynamicClusterRole.Generation, logger, buildFailureReason(err), err)
 	}
+	recordRulesComputed(recorder, dynamicClusterRole, outputRole.Rules, inheritedRoles)
+	dynamicClusterRole.Status.Provenance, dynamicClusterRole.Status.ProvenanceOmitted = provenance.LimitedSummary()
 
-	outputRole := &v1.ClusterRole{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: dynamicClusterRole.Name,
-			Annotations: map[string]string{
-				"managed-by": "dynamic-rbac-operator",
-			},
-		},
-		Rules: *rules,
+	if dynamicClusterRole.Spec.Mode == rbacv1alpha1.ModePreview {
+		generatedRules, err := helpers.GeneratedClusterRoleRules(client, dynamicClusterRole)
+		if err != nil {
+			return reconcileFailed(client, recorder, dynamicClusterRole, &dynamicClusterRole.Status.ComputedRoleStatus, dynamicClusterRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+		}
+		kind, computedRules := "ClusterRole", outputRole.Rules
+		if dynamicClusterRole.Spec.NamespaceSelector != nil {
+			kind, computedRules = "Roles", helpers.StripNonResourceURLs(outputRole.Rules)
+		}
+		return reconcilePreview(client, recorder, dynamicClusterRole, &dynamicClusterRole.Status.ComputedRoleStatus, dynamicClusterRole.Generation, logger, kind, generatedRules, computedRules, inheritedRoles, discovery.Version)
+	}
+
+	if dynamicClusterRole.Spec.NamespaceSelector != nil {
+		return reconcileNamespacedRoles(dynamicClusterRole, helpers.StripNonResourceURLs(outputRole.Rules), inheritedRoles, discovery.Version, client, scheme, logger, recorder)
 	}
 
 	if err := controllerutil.SetControllerReference(dynamicClusterRole, outputRole, scheme); err != nil {
-		return reconcile.Result{}, err
+		return reconcileFailed(client, recorder, dynamicClusterRole, &dynamicClusterRole.Status.ComputedRoleStatus, dynamicClusterRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
 	}
 
 	logger.Info(fmt.Sprintf("Computed role with %d rules.", len(outputRole.Rules)))
 	logger.Info("Creating or Updating Role")
-	err = helpers.CreateOrUpdateClusterRole(outputRole, client)
+	// A ClusterRole was only generated before if the roles were not stamped into namespaces instead
+	expected := dynamicClusterRole.Status.GeneratedRoleName != "" && len(dynamicClusterRole.Status.Namespaces) == 0
+	previousRules, existed, drifted, err := helpers.CreateOrUpdateClusterRole(outputRole, expected, client)
+	if err != nil {
+		return reconcileFailed(client, recorder, dynamicClusterRole, &dynamicClusterRole.Status.ComputedRoleStatus, dynamicClusterRole.Generation, logger, writeFailureReason(err), err)
+	}
+	if drifted {
+		recordDriftCorrected(recorder, dynamicClusterRole, "ClusterRole", outputRole.Name)
+	}
+
+	recordRoleWritten(recorder, dynamicClusterRole, "ClusterRole", outputRole.Name, previousRules, existed, outputRole.Rules)
+	generatedRuleCounts.set(dependantKindDynamicClusterRole, "", dynamicClusterRole.Name, len(outputRole.Rules))
+
+	// Remove the Roles left behind if a namespaceSelector has been dropped from the spec
+	deleted, err := deleteNamespacedRoles(dynamicClusterRole, client, nil)
+	if err != nil {
+		return reconcileFailed(client, recorder, dynamicClusterRole, &dynamicClusterRole.Status.ComputedRoleStatus, dynamicClusterRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+	}
+	recordRolesStamped(recorder, dynamicClusterRole, dynamicClusterRole.Name, 0, 0, deleted)
+
+	recordReconcileSuccess(&dynamicClusterRole.Status.ComputedRoleStatus, dynamicClusterRole.Generation, outputRole.Name, len(outputRole.Rules), inheritedRoles, discovery.Version)
+	dynamicClusterRole.Status.Namespaces = nil
+	dynamicClusterRole.Status.SkippedNamespaces = nil
+	err = client.Status().Update(context.TODO(), dynamicClusterRole)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -95,6 +164,13 @@ func ReconcileDynamicClusterRole(dynamicClusterRole *rbacv1alpha1.DynamicCluster
 
 func (r *DynamicClusterRoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&rbacv1alpha1.DynamicClusterRole{}).
+		For(&rbacv1alpha1.DynamicClusterRole{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Owns(&v1.ClusterRole{}).
+		Owns(&v1.Role{}).
+		Watches(&source.Kind{Type: &corev1.Namespace{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: dynamicClusterRolesForNamespace(r.Client, r.Log)},
+			builder.WithPredicates(labelsChangedPredicate)).
+		Watches(&source.Channel{Source: r.Queue.DynamicClusterRoles}, &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
@@ -0,0 +1,159 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	helpers "github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// DynamicClusterRoleBindingReconciler reconciles a DynamicClusterRoleBinding object
+type DynamicClusterRoleBindingReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicclusterrolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicclusterrolebindings/status,verbs=get;update;patch
+
+func (r *DynamicClusterRoleBindingReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	_ = context.Background()
+	_ = r.Log.WithValues("dynamicclusterrolebinding", req.NamespacedName)
+
+	instance := &rbacv1alpha1.DynamicClusterRoleBinding{}
+	err := r.Client.Get(context.TODO(), req.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, could have been deleted after reconcile request.
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	return ReconcileDynamicClusterRoleBinding(instance, r.Client, r.Scheme, r.Log, r.Recorder)
+}
+
+func ReconcileDynamicClusterRoleBinding(dynamicClusterRoleBinding *rbacv1alpha1.DynamicClusterRoleBinding, client client.Client, scheme *runtime.Scheme, logger logr.Logger, recorder record.EventRecorder) (ctrl.Result, error) {
+	status := &dynamicClusterRoleBinding.Status.ComputedBindingStatus
+
+	roleRef, err := helpers.ResolveRoleRef(client, dynamicClusterRoleBinding.Spec.RoleRef, "")
+	if err != nil {
+		return bindingReconcileFailed(client, recorder, dynamicClusterRoleBinding, status, dynamicClusterRoleBinding.Generation, logger, bindingFailureReason(err), err)
+	}
+	subjects, err := helpers.ResolveSubjects(client, dynamicClusterRoleBinding.Spec.Subjects, "")
+	if err != nil {
+		return bindingReconcileFailed(client, recorder, dynamicClusterRoleBinding, status, dynamicClusterRoleBinding.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+	}
+
+	outputBinding := &v1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: dynamicClusterRoleBinding.Name,
+			Annotations: map[string]string{
+				"managed-by": "dynamic-rbac-operator",
+			},
+		},
+		RoleRef:  roleRef,
+		Subjects: subjects,
+	}
+
+	if err := controllerutil.SetControllerReference(dynamicClusterRoleBinding, outputBinding, scheme); err != nil {
+		return bindingReconcileFailed(client, recorder, dynamicClusterRoleBinding, status, dynamicClusterRoleBinding.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+	}
+
+	logger.Info(fmt.Sprintf("Resolved binding with %d subjects.", len(outputBinding.Subjects)))
+	logger.Info("Creating or Updating ClusterRoleBinding")
+	previousSubjects, existed, err := helpers.CreateOrUpdateClusterRoleBinding(outputBinding, client)
+	if err != nil {
+		return bindingReconcileFailed(client, recorder, dynamicClusterRoleBinding, status, dynamicClusterRoleBinding.Generation, logger, writeFailureReason(err), err)
+	}
+
+	recordBindingWritten(recorder, dynamicClusterRoleBinding, "ClusterRoleBinding", outputBinding.Name, previousSubjects, existed, outputBinding.Subjects)
+
+	recordBindingSuccess(status, dynamicClusterRoleBinding.Generation, outputBinding.Name, outputBinding.Subjects)
+	err = client.Status().Update(context.TODO(), dynamicClusterRoleBinding)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// dynamicClusterRoleBindingsFor maps an event to the DynamicClusterRoleBindings for which matches returns true
+func dynamicClusterRoleBindingsFor(c client.Client, log logr.Logger, matches func(handler.MapObject, *rbacv1alpha1.DynamicClusterRoleBinding) bool) handler.ToRequestsFunc {
+	return func(object handler.MapObject) []reconcile.Request {
+		dynamicClusterRoleBindings := &rbacv1alpha1.DynamicClusterRoleBindingList{}
+		err := c.List(context.TODO(), dynamicClusterRoleBindings)
+		if err != nil {
+			log.Error(err, "could not list DynamicClusterRoleBindings", "object", object.Meta.GetName())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for i := range dynamicClusterRoleBindings.Items {
+			dynamicClusterRoleBinding := &dynamicClusterRoleBindings.Items[i]
+			if !matches(object, dynamicClusterRoleBinding) {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: dynamicClusterRoleBinding.Name}})
+		}
+		return requests
+	}
+}
+
+func (r *DynamicClusterRoleBindingReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&rbacv1alpha1.DynamicClusterRoleBinding{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&v1.ClusterRoleBinding{}).
+		Watches(&source.Kind{Type: &corev1.ServiceAccount{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: dynamicClusterRoleBindingsFor(r.Client, r.Log, func(_ handler.MapObject, binding *rbacv1alpha1.DynamicClusterRoleBinding) bool {
+				return selectsServiceAccountsByLabel(binding.Spec.Subjects)
+			})},
+			builder.WithPredicates(labelsChangedPredicate)).
+		Watches(&source.Kind{Type: &corev1.Namespace{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: dynamicClusterRoleBindingsFor(r.Client, r.Log, func(_ handler.MapObject, binding *rbacv1alpha1.DynamicClusterRoleBinding) bool {
+				return selectsNamespacesByLabel(binding.Spec.Subjects)
+			})},
+			builder.WithPredicates(labelsChangedPredicate)).
+		Watches(&source.Kind{Type: &rbacv1alpha1.DynamicClusterRole{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: dynamicClusterRoleBindingsFor(r.Client, r.Log, func(role handler.MapObject, binding *rbacv1alpha1.DynamicClusterRoleBinding) bool {
+				return binding.Spec.RoleRef.Kind == "DynamicClusterRole" && binding.Spec.RoleRef.Name == role.Meta.GetName()
+			})},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,64 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+)
+
+// DynamicRBACPolicyReconciler reconciles a DynamicRBACPolicy object
+type DynamicRBACPolicyReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	Cache  *helpers.ResourceCache
+	Queue  *RecomputeQueue
+}
+
+// +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicrbacpolicies,verbs=get;list;watch
+
+func (r *DynamicRBACPolicyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	_ = context.Background()
+	_ = r.Log.WithValues("dynamicrbacpolicy", req.NamespacedName)
+
+	// Policies apply to every dynamic role, so any change to one recomputes all of them
+	dependants := r.Cache.Dependencies.Dependants()
+	if len(dependants) > 0 {
+		r.Log.Info(fmt.Sprintf("Dynamic RBAC policy %s has been updated - recomputing %d dynamic resources now", req.Name, len(dependants)))
+		r.Queue.Enqueue("DynamicRBACPolicy", dependants)
+	}
+
+	return reconcile.Result{}, nil
+}
+
+func (r *DynamicRBACPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&rbacv1alpha1.DynamicRBACPolicy{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -23,12 +23,17 @@ import (
 	"github.com/go-logr/logr"
 	v1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
 	helpers "github.com/redhat-cop/dynamic-rbac-operator/helpers"
@@ -37,13 +42,19 @@ import (
 // DynamicRoleReconciler reconciles a DynamicRole object
 type DynamicRoleReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-	Cache  *helpers.ResourceCache
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Cache    *helpers.ResourceCache
+	Queue    *RecomputeQueue
+	Recorder record.EventRecorder
+
+	// MaxConcurrentReconciles is the number of objects computed concurrently; the shared cache is safe for any value
+	MaxConcurrentReconciles int
 }
 
 // +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicroles,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicroles/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *DynamicRoleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	_ = context.Background()
@@ -54,39 +65,70 @@ func (r *DynamicRoleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
+			// Dynamic roles inheriting from it need to report that it is missing
+			r.Cache.Dependencies.Remove(dynamicRoleDependant(req.Namespace, req.Name))
+			dynamicRoles.WithLabelValues(dependantKindDynamicRole).Set(float64(r.Cache.Dependencies.Count(dependantKindDynamicRole)))
+			generatedRuleCounts.delete(dependantKindDynamicRole, req.Namespace, req.Name)
+			r.Queue.Enqueue(dependantKindDynamicRole, r.Cache.Dependencies.DependantsOfDynamicRole(req.NamespacedName))
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
 
-	return ReconcileDynamicRole(instance, r.Client, r.Scheme, r.Log, r.Cache)
+	specChanged := instance.Status.ObservedGeneration != instance.Generation
+	result, err := ReconcileDynamicRole(instance, r.Client, r.Scheme, r.Log, r.Cache, r.Recorder)
+	if specChanged {
+		// Dynamic roles inheriting from this one are computed from its spec, so they only need to be recomputed when the spec changes
+		r.Queue.Enqueue(dependantKindDynamicRole, r.Cache.Dependencies.DependantsOfDynamicRole(req.NamespacedName))
+	}
+	return result, err
 }
 
-func ReconcileDynamicRole(dynamicRole *rbacv1alpha1.DynamicRole, client client.Client, scheme *runtime.Scheme, logger logr.Logger, cache *helpers.ResourceCache) (ctrl.Result, error) {
-	rules, err := helpers.BuildPolicyRules(client, *cache, helpers.Role, dynamicRole.Namespace, dynamicRole.Spec.Inherit, dynamicRole.Spec.Allow, dynamicRole.Spec.Deny)
+func ReconcileDynamicRole(dynamicRole *rbacv1alpha1.DynamicRole, client client.Client, scheme *runtime.Scheme, logger logr.Logger, cache *helpers.ResourceCache, recorder record.EventRecorder) (ctrl.Result, error) {
+	discovery := cache.Discovery()
+	dependencies := helpers.NewDependencies()
+	var provenance *helpers.Provenance
+	if dynamicRole.Spec.Provenance {
+		provenance = helpers.NewProvenance()
+	}
+	outputRole, inheritedRoles, err := ComputeDynamicRole(client, discovery, dependencies, dynamicRole, provenance)
+	cache.Dependencies.Set(dynamicRoleDependant(dynamicRole.Namespace, dynamicRole.Name), dependencies)
+	recordDiscoveryStaleness(&dynamicRole.Status.ComputedRoleStatus, dynamicRole.Generation, dependencies.StaleAPIGroups(discovery))
+	dynamicRoles.WithLabelValues(dependantKindDynamicRole).Set(float64(cache.Dependencies.Count(dependantKindDynamicRole)))
 	if err != nil {
-		return reconcile.Result{}, err
+		return reconcileFailed(client, recorder, dynamicRole, &dynamicRole.Status.ComputedRoleStatus, dynamicRole.Generation, logger, buildFailureReason(err), err)
 	}
+	recordRulesComputed(recorder, dynamicRole, outputRole.Rules, inheritedRoles)
+	dynamicRole.Status.Provenance, dynamicRole.Status.ProvenanceOmitted = provenance.LimitedSummary()
 
-	outputRole := &v1.Role{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      dynamicRole.Name,
-			Namespace: dynamicRole.Namespace,
-			Annotations: map[string]string{
-				"managed-by": "dynamic-rbac-operator",
-			},
-		},
-		Rules: *rules,
+	if dynamicRole.Spec.Mode == rbacv1alpha1.ModePreview {
+		generatedRules, err := helpers.GeneratedRoleRules(client, dynamicRole)
+		if err != nil {
+			return reconcileFailed(client, recorder, dynamicRole, &dynamicRole.Status.ComputedRoleStatus, dynamicRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+		}
+		return reconcilePreview(client, recorder, dynamicRole, &dynamicRole.Status.ComputedRoleStatus, dynamicRole.Generation, logger, "Role", generatedRules, outputRole.Rules, inheritedRoles, discovery.Version)
 	}
 
 	if err := controllerutil.SetControllerReference(dynamicRole, outputRole, scheme); err != nil {
-		return reconcile.Result{}, err
+		return reconcileFailed(client, recorder, dynamicRole, &dynamicRole.Status.ComputedRoleStatus, dynamicRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
 	}
 
 	logger.Info(fmt.Sprintf("Computed role with %d rules.", len(outputRole.Rules)))
 	logger.Info("Creating or Updating Role")
-	err = helpers.CreateOrUpdateRole(outputRole, client)
+	previousRules, existed, drifted, err := helpers.CreateOrUpdateRole(outputRole, dynamicRole.Status.GeneratedRoleName != "", client)
+	if err != nil {
+		return reconcileFailed(client, recorder, dynamicRole, &dynamicRole.Status.ComputedRoleStatus, dynamicRole.Generation, logger, writeFailureReason(err), err)
+	}
+	if drifted {
+		recordDriftCorrected(recorder, dynamicRole, "Role", outputRole.Name)
+	}
+
+	recordRoleWritten(recorder, dynamicRole, "Role", outputRole.Name, previousRules, existed, outputRole.Rules)
+	generatedRuleCounts.set(dependantKindDynamicRole, dynamicRole.Namespace, dynamicRole.Name, len(outputRole.Rules))
+
+	recordReconcileSuccess(&dynamicRole.Status.ComputedRoleStatus, dynamicRole.Generation, outputRole.Name, len(outputRole.Rules), inheritedRoles, discovery.Version)
+	err = client.Status().Update(context.TODO(), dynamicRole)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -96,6 +138,9 @@ func ReconcileDynamicRole(dynamicRole *rbacv1alpha1.DynamicRole, client client.C
 
 func (r *DynamicRoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&rbacv1alpha1.DynamicRole{}).
+		For(&rbacv1alpha1.DynamicRole{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Owns(&v1.Role{}).
+		Watches(&source.Channel{Source: r.Queue.DynamicRoles}, &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
@@ -0,0 +1,186 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	helpers "github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// DynamicRoleBindingReconciler reconciles a DynamicRoleBinding object
+type DynamicRoleBindingReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicrolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=dynamicrolebindings/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
+
+func (r *DynamicRoleBindingReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	_ = context.Background()
+	_ = r.Log.WithValues("dynamicrolebinding", req.NamespacedName)
+
+	instance := &rbacv1alpha1.DynamicRoleBinding{}
+	err := r.Client.Get(context.TODO(), req.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, could have been deleted after reconcile request.
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	return ReconcileDynamicRoleBinding(instance, r.Client, r.Scheme, r.Log, r.Recorder)
+}
+
+func ReconcileDynamicRoleBinding(dynamicRoleBinding *rbacv1alpha1.DynamicRoleBinding, client client.Client, scheme *runtime.Scheme, logger logr.Logger, recorder record.EventRecorder) (ctrl.Result, error) {
+	status := &dynamicRoleBinding.Status.ComputedBindingStatus
+
+	roleRef, err := helpers.ResolveRoleRef(client, dynamicRoleBinding.Spec.RoleRef, dynamicRoleBinding.Namespace)
+	if err != nil {
+		return bindingReconcileFailed(client, recorder, dynamicRoleBinding, status, dynamicRoleBinding.Generation, logger, bindingFailureReason(err), err)
+	}
+	subjects, err := helpers.ResolveSubjects(client, dynamicRoleBinding.Spec.Subjects, dynamicRoleBinding.Namespace)
+	if err != nil {
+		return bindingReconcileFailed(client, recorder, dynamicRoleBinding, status, dynamicRoleBinding.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+	}
+
+	outputBinding := &v1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dynamicRoleBinding.Name,
+			Namespace: dynamicRoleBinding.Namespace,
+			Annotations: map[string]string{
+				"managed-by": "dynamic-rbac-operator",
+			},
+		},
+		RoleRef:  roleRef,
+		Subjects: subjects,
+	}
+
+	if err := controllerutil.SetControllerReference(dynamicRoleBinding, outputBinding, scheme); err != nil {
+		return bindingReconcileFailed(client, recorder, dynamicRoleBinding, status, dynamicRoleBinding.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+	}
+
+	logger.Info(fmt.Sprintf("Resolved binding with %d subjects.", len(outputBinding.Subjects)))
+	logger.Info("Creating or Updating RoleBinding")
+	previousSubjects, existed, err := helpers.CreateOrUpdateRoleBinding(outputBinding, client)
+	if err != nil {
+		return bindingReconcileFailed(client, recorder, dynamicRoleBinding, status, dynamicRoleBinding.Generation, logger, writeFailureReason(err), err)
+	}
+
+	recordBindingWritten(recorder, dynamicRoleBinding, "RoleBinding", outputBinding.Name, previousSubjects, existed, outputBinding.Subjects)
+
+	recordBindingSuccess(status, dynamicRoleBinding.Generation, outputBinding.Name, outputBinding.Subjects)
+	err = client.Status().Update(context.TODO(), dynamicRoleBinding)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// dynamicRoleBindingsFor maps an event to the DynamicRoleBindings for which matches returns true
+func dynamicRoleBindingsFor(c client.Client, log logr.Logger, matches func(handler.MapObject, *rbacv1alpha1.DynamicRoleBinding) bool) handler.ToRequestsFunc {
+	return func(object handler.MapObject) []reconcile.Request {
+		dynamicRoleBindings := &rbacv1alpha1.DynamicRoleBindingList{}
+		err := c.List(context.TODO(), dynamicRoleBindings)
+		if err != nil {
+			log.Error(err, "could not list DynamicRoleBindings", "object", object.Meta.GetName())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for i := range dynamicRoleBindings.Items {
+			dynamicRoleBinding := &dynamicRoleBindings.Items[i]
+			if !matches(object, dynamicRoleBinding) {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: dynamicRoleBinding.Name, Namespace: dynamicRoleBinding.Namespace}})
+		}
+		return requests
+	}
+}
+
+// selectsServiceAccountsByLabel returns true if any subject selects ServiceAccounts by label, so that new or relabelled ServiceAccounts change the binding
+func selectsServiceAccountsByLabel(subjects []rbacv1alpha1.SubjectSelector) bool {
+	for _, subject := range subjects {
+		if subject.Kind == v1.ServiceAccountKind && subject.LabelSelector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsNamespacesByLabel returns true if any subject selects ServiceAccounts by namespace selector, so that new or relabelled namespaces change the binding
+func selectsNamespacesByLabel(subjects []rbacv1alpha1.SubjectSelector) bool {
+	for _, subject := range subjects {
+		if subject.Kind == v1.ServiceAccountKind && subject.NamespaceSelector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *DynamicRoleBindingReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&rbacv1alpha1.DynamicRoleBinding{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&v1.RoleBinding{}).
+		Watches(&source.Kind{Type: &corev1.ServiceAccount{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: dynamicRoleBindingsFor(r.Client, r.Log, func(_ handler.MapObject, binding *rbacv1alpha1.DynamicRoleBinding) bool {
+				return selectsServiceAccountsByLabel(binding.Spec.Subjects)
+			})},
+			builder.WithPredicates(labelsChangedPredicate)).
+		Watches(&source.Kind{Type: &corev1.Namespace{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: dynamicRoleBindingsFor(r.Client, r.Log, func(_ handler.MapObject, binding *rbacv1alpha1.DynamicRoleBinding) bool {
+				return selectsNamespacesByLabel(binding.Spec.Subjects)
+			})},
+			builder.WithPredicates(labelsChangedPredicate)).
+		Watches(&source.Kind{Type: &rbacv1alpha1.DynamicRole{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: dynamicRoleBindingsFor(r.Client, r.Log, func(role handler.MapObject, binding *rbacv1alpha1.DynamicRoleBinding) bool {
+				return binding.Spec.RoleRef.Kind == "DynamicRole" && binding.Spec.RoleRef.Name == role.Meta.GetName() && binding.Namespace == role.Meta.GetNamespace()
+			})},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &rbacv1alpha1.DynamicClusterRole{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: dynamicRoleBindingsFor(r.Client, r.Log, func(role handler.MapObject, binding *rbacv1alpha1.DynamicRoleBinding) bool {
+				return binding.Spec.RoleRef.Kind == "DynamicClusterRole" && binding.Spec.RoleRef.Name == role.Meta.GetName()
+			})},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+const (
+	// EventReasonRulesComputed is recorded when the rules of a dynamic role have been computed
+	EventReasonRulesComputed = "RulesComputed"
+	// EventReasonRoleCreated is recorded when the generated role did not exist and has been created
+	EventReasonRoleCreated = "RoleCreated"
+	// EventReasonRoleUpdated is recorded when the rules of the generated role have changed
+	EventReasonRoleUpdated = "RoleUpdated"
+	// EventReasonDiscoveryFailed is recorded on every dynamic role when the cluster's API resources could not be discovered
+	EventReasonDiscoveryFailed = "DiscoveryFailed"
+	// EventReasonRolesStamped is recorded when the Roles stamped into namespaces by a namespaceSelector have been created, updated or deleted
+	EventReasonRolesStamped = "RolesStamped"
+	// EventReasonBindingCreated is recorded when the generated binding did not exist and has been created
+	EventReasonBindingCreated = "BindingCreated"
+	// EventReasonBindingUpdated is recorded when the subjects or role of the generated binding have changed
+	EventReasonBindingUpdated = "BindingUpdated"
+	// EventReasonPreviewComputed is recorded when the rules of a dynamic role in Preview mode have been computed without changing its generated role
+	EventReasonPreviewComputed = "PreviewComputed"
+	// EventReasonDriftCorrected is recorded when the rules of a generated role had been changed outside of the operator and have been restored
+	EventReasonDriftCorrected = "DriftCorrected"
+)
+
+// buildFailureReason classifies an error returned while computing a dynamic role's rules
+func buildFailureReason(err error) string {
+	if errors.IsNotFound(err) {
+		return rbacv1alpha1.ReasonInheritedRoleMissing
+	}
+	if helpers.IsInheritanceCycle(err) {
+		return rbacv1alpha1.ReasonInheritanceCycle
+	}
+	return rbacv1alpha1.ReasonReconcileFailed
+}
+
+// writeFailureReason classifies an error returned while writing a generated role or binding
+func writeFailureReason(err error) string {
+	if helpers.IsNotControlled(err) {
+		return rbacv1alpha1.ReasonNotControlled
+	}
+	return rbacv1alpha1.ReasonReconcileFailed
+}
+
+// bindingFailureReason classifies an error returned while resolving a dynamic binding's role
+func bindingFailureReason(err error) string {
+	if errors.IsNotFound(err) {
+		return rbacv1alpha1.ReasonRoleRefMissing
+	}
+	return rbacv1alpha1.ReasonReconcileFailed
+}
+
+// recordRulesComputed records an event summarising the rules computed for a dynamic role
+func recordRulesComputed(recorder record.EventRecorder, owner runtime.Object, rules []rbacv1.PolicyRule, inheritedRoles []rbacv1alpha1.InheritedRole) {
+	recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonRulesComputed, "Computed %d rules from %d inherited roles", len(rules), len(inheritedRoles))
+}
+
+// recordRoleWritten records an event when a generated role has been created or its rules have changed
+func recordRoleWritten(recorder record.EventRecorder, owner runtime.Object, kind string, name string, previousRules []rbacv1.PolicyRule, existed bool, currentRules []rbacv1.PolicyRule) {
+	if !existed {
+		recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonRoleCreated, "Created %s %s with %d rules", kind, name, len(currentRules))
+		return
+	}
+	added, removed := helpers.DiffPolicyRules(previousRules, currentRules)
+	if added == 0 && removed == 0 {
+		return
+	}
+	recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonRoleUpdated, "Updated %s %s: %d permissions added, %d permissions removed", kind, name, added, removed)
+}
+
+// recordPreviewComputed records an event summarising how enforcing a dynamic role in Preview mode would change its generated role
+func recordPreviewComputed(recorder record.EventRecorder, owner runtime.Object, kind string, preview *rbacv1alpha1.RulePreview) {
+	recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonPreviewComputed, "Previewed %d rules: enforcing them would add %d and remove %d permissions of the generated %s", len(preview.Rules), preview.PermissionsAdded, preview.PermissionsRemoved, kind)
+}
+
+// recordDriftCorrected records an event and counts a correction when the rules of a generated role had been changed outside of the operator
+func recordDriftCorrected(recorder record.EventRecorder, owner runtime.Object, kind string, name string) {
+	driftCorrections.WithLabelValues(kind).Inc()
+	recorder.Eventf(owner, corev1.EventTypeWarning, EventReasonDriftCorrected, "Restored the rules of %s %s, which had been changed outside of the operator", kind, name)
+}
+
+// recordRolesStamped records a single event summarising the changes to the Roles stamped into namespaces, rather than one event per namespace
+func recordRolesStamped(recorder record.EventRecorder, owner runtime.Object, name string, created int, updated int, deleted int) {
+	if created == 0 && updated == 0 && deleted == 0 {
+		return
+	}
+	recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonRolesStamped, "Role %s: %d created, %d updated, %d deleted", name, created, updated, deleted)
+}
+
+// recordBindingWritten records an event when a generated binding has been created or its subjects have changed
+func recordBindingWritten(recorder record.EventRecorder, owner runtime.Object, kind string, name string, previousSubjects []rbacv1.Subject, existed bool, currentSubjects []rbacv1.Subject) {
+	if !existed {
+		recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonBindingCreated, "Created %s %s with %d subjects", kind, name, len(currentSubjects))
+		return
+	}
+	added, removed := helpers.DiffSubjects(previousSubjects, currentSubjects)
+	if added == 0 && removed == 0 {
+		return
+	}
+	recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonBindingUpdated, "Updated %s %s: %d subjects added, %d subjects removed", kind, name, added, removed)
+}
+
+// recordEventOnAllDynamicResources records the same event on every DynamicRole and DynamicClusterRole, for problems that affect all of them
+func recordEventOnAllDynamicResources(c client.Client, recorder record.EventRecorder, log logr.Logger, eventType string, reason string, message string) {
+	dynamicRoleList := &rbacv1alpha1.DynamicRoleList{}
+	if err := c.List(context.TODO(), dynamicRoleList); err != nil {
+		log.Error(err, "could not list Dynamic Roles")
+	}
+	for i := range dynamicRoleList.Items {
+		recorder.Event(&dynamicRoleList.Items[i], eventType, reason, message)
+	}
+	dynamicClusterRoleList := &rbacv1alpha1.DynamicClusterRoleList{}
+	if err := c.List(context.TODO(), dynamicClusterRoleList); err != nil {
+		log.Error(err, "could not list Dynamic Cluster Roles")
+	}
+	for i := range dynamicClusterRoleList.Items {
+		recorder.Event(&dynamicClusterRoleList.Items[i], eventType, reason, message)
+	}
+}
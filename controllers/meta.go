@@ -1,48 +1,52 @@
 package controllers
 
 import (
-	"context"
+	"fmt"
 
 	"github.com/go-logr/logr"
-	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-// UpdateAllDynamicResources loops through all DynamicRoles and DynamicClusterRoles and updates their rules/specs as required based on current cache info
-func UpdateAllDynamicResources(client client.Client, log logr.Logger, scheme *runtime.Scheme, cache *helpers.ResourceCache) (ctrl.Result, error) {
-	// Clear the watched roles cache maps since we're about to recreate them anyway - gets rid of anything we used to care about but no longer need
-	cache.WatchedRoles = map[types.NamespacedName]bool{}
-	cache.WatchedClusterRoles = map[types.NamespacedName]bool{}
-
-	dynamicRoleList := &rbacv1alpha1.DynamicRoleList{}
-	err := client.List(context.TODO(), dynamicRoleList)
+// RefreshDiscoveryAndRecompute rebuilds the cluster policy cache from discovery and then enqueues the dynamic roles whose rules refer to an API group that changed
+// It is used whenever a CRD or APIService, the source, changes the set of resources the API server serves
+func RefreshDiscoveryAndRecompute(source string, client client.Client, log logr.Logger, cache *helpers.ResourceCache, queue *RecomputeQueue, recorder record.EventRecorder) (ctrl.Result, error) {
+	config, err := ctrl.GetConfig()
 	if err != nil {
-		log.Error(err, "could not list Dynamic Roles")
 		return reconcile.Result{}, err
 	}
-	for _, dynamicRole := range dynamicRoleList.Items {
-		_, err := ReconcileDynamicRole(&dynamicRole, client, scheme, log, cache)
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-	}
-	dynamicClusterRoleList := &rbacv1alpha1.DynamicClusterRoleList{}
-	err = client.List(context.TODO(), dynamicClusterRoleList)
+	previous, current, err := cache.RefreshDiscovery(func() ([]rbacv1.PolicyRule, []string, error) {
+		timer := prometheus.NewTimer(discoveryRefreshDuration)
+		defer timer.ObserveDuration()
+		return helpers.DiscoverPolicyRules(config)
+	})
 	if err != nil {
-		log.Error(err, "could not list Dynamic Cluster Roles")
+		reconcileErrors.WithLabelValues(EventReasonDiscoveryFailed).Inc()
+		recordEventOnAllDynamicResources(client, recorder, log, corev1.EventTypeWarning, EventReasonDiscoveryFailed, fmt.Sprintf("Could not refresh the cluster's API resources, rules are computed from the previous discovery: %v", err))
 		return reconcile.Result{}, err
 	}
-	for _, dynamicClusterRole := range dynamicClusterRoleList.Items {
-		_, err := ReconcileDynamicClusterRole(&dynamicClusterRole, client, scheme, log, cache)
-		if err != nil {
-			return reconcile.Result{}, err
-		}
+	log.Info("Rebuilt cluster policy cache", "version", current.Version)
+	staleAPIGroups.Set(float64(len(current.StaleGroups)))
+	if len(current.StaleGroups) > 0 {
+		log.Info("Some API groups could not be discovered - their resources are retained from the previous discovery", "groups", current.StaleGroups)
 	}
-	log.Info("All computed roles have been reconciled")
+
+	// Dynamic roles referring to a group that became stale or was discovered again need to update their DiscoveryStale condition
+	changedGroups := helpers.ChangedAPIGroups(previous.Rules, current.Rules)
+	changedGroups = append(changedGroups, helpers.ChangedStaleGroups(previous, current)...)
+	if len(changedGroups) == 0 {
+		log.Info("No API group changed - recomputation is not required")
+		return reconcile.Result{}, nil
+	}
+	dependants := cache.Dependencies.DependantsOfAPIGroups(changedGroups)
+	log.Info(fmt.Sprintf("API groups %v changed - recomputing %d dynamic roles", changedGroups, len(dependants)))
+	queue.Enqueue(source, dependants)
+
 	return reconcile.Result{}, nil
 }
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// driftCorrections counts the generated roles whose rules were changed outside of the operator and have been restored
+	driftCorrections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamic_rbac_drift_corrections_total",
+		Help: "Number of generated Roles and ClusterRoles whose rules were changed outside of the operator and have been restored",
+	}, []string{"kind"})
+
+	// buildPolicyRulesDuration measures how long computing the rules of a dynamic role takes, including the lookups of the roles it inherits from
+	buildPolicyRulesDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dynamic_rbac_build_policy_rules_duration_seconds",
+		Help:    "Time taken to compute the rules of a DynamicRole or DynamicClusterRole",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"kind"})
+
+	// discoveryRefreshDuration measures how long listing the API resources served by the cluster takes
+	discoveryRefreshDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "dynamic_rbac_discovery_refresh_duration_seconds",
+		Help:    "Time taken to refresh the operator's snapshot of the cluster's API resources",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+
+	// generatedRoleRules is the total number of rules in the roles generated from dynamic roles of each kind, see generatedRuleCounts
+	// It is not labelled by dynamic role, so that the number of series does not grow with the number of dynamic roles
+	generatedRoleRules = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dynamic_rbac_generated_role_rules",
+		Help: "Total number of rules in the Roles and ClusterRoles generated from DynamicRoles or DynamicClusterRoles",
+	}, []string{"kind"})
+
+	// dynamicRoles is the number of dynamic roles known to the operator
+	dynamicRoles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dynamic_rbac_dynamic_roles",
+		Help: "Number of DynamicRoles and DynamicClusterRoles known to the operator",
+	}, []string{"kind"})
+
+	// recomputeTriggers counts the dynamic roles enqueued for recomputation, by the kind of object whose change required it
+	recomputeTriggers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamic_rbac_recompute_triggers_total",
+		Help: "Number of dynamic roles recomputed because an object they depend on changed, by the kind of that object",
+	}, []string{"source"})
+
+	// staleAPIGroups is the number of API groups that could not be discovered when discovery was last refreshed
+	staleAPIGroups = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dynamic_rbac_stale_api_groups",
+		Help: "Number of API groups that could not be discovered, whose resources are retained from an earlier discovery",
+	})
+
+	// reconcileErrors counts the errors reported in the status and events of dynamic roles and bindings, and failed discovery refreshes
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamic_rbac_errors_total",
+		Help: "Number of errors computing or writing generated roles and bindings, or refreshing discovery, by reason",
+	}, []string{"reason"})
+)
+
+// ruleCounts tracks the number of rules generated from each dynamic role, which generatedRoleRules sums by kind
+type ruleCounts struct {
+	sync.Mutex
+	counts map[string]map[types.NamespacedName]int
+}
+
+var generatedRuleCounts = &ruleCounts{counts: map[string]map[types.NamespacedName]int{}}
+
+// set records the number of rules generated from a dynamic role, counted once however many namespaces they are stamped into
+func (r *ruleCounts) set(kind string, namespace string, name string, count int) {
+	r.Lock()
+	defer r.Unlock()
+	if r.counts[kind] == nil {
+		r.counts[kind] = map[types.NamespacedName]int{}
+	}
+	r.counts[kind][types.NamespacedName{Namespace: namespace, Name: name}] = count
+	r.publish(kind)
+}
+
+// delete forgets the rules generated from a dynamic role that has been deleted
+func (r *ruleCounts) delete(kind string, namespace string, name string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.counts[kind], types.NamespacedName{Namespace: namespace, Name: name})
+	r.publish(kind)
+}
+
+func (r *ruleCounts) publish(kind string) {
+	total := 0
+	for _, count := range r.counts[kind] {
+		total += count
+	}
+	generatedRoleRules.WithLabelValues(kind).Set(float64(total))
+}
+
+func init() {
+	metrics.Registry.MustRegister(
+		driftCorrections,
+		buildPolicyRulesDuration,
+		discoveryRefreshDuration,
+		generatedRoleRules,
+		dynamicRoles,
+		recomputeTriggers,
+		staleAPIGroups,
+		reconcileErrors,
+	)
+}
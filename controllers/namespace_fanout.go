@@ -0,0 +1,202 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	helpers "github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// DynamicClusterRoleLabel is set on every Role stamped into a namespace by a DynamicClusterRole with a namespaceSelector, with the DynamicClusterRole's name as value
+const DynamicClusterRoleLabel = "rbac.redhatcop.redhat.io/dynamic-cluster-role"
+
+// SelectedNamespaces returns the sorted names of the namespaces that a DynamicClusterRole's namespaceSelector stamps Roles into
+func SelectedNamespaces(c client.Client, dynamicClusterRole *rbacv1alpha1.DynamicClusterRole) ([]string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(dynamicClusterRole.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	namespaceList := &corev1.NamespaceList{}
+	err = c.List(context.TODO(), namespaceList, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := []string{}
+	for _, namespace := range namespaceList.Items {
+		// Roles cannot be created in a namespace that is being deleted, and the namespace takes its roles with it
+		if namespace.Status.Phase == corev1.NamespaceTerminating || namespace.DeletionTimestamp != nil {
+			continue
+		}
+		namespaces = append(namespaces, namespace.Name)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// reconcileNamespacedRoles stamps the computed rules of a DynamicClusterRole as a Role into every namespace matching its namespaceSelector
+// Roles left behind in namespaces that no longer match, and a ClusterRole generated before the selector was set, are deleted
+func reconcileNamespacedRoles(dynamicClusterRole *rbacv1alpha1.DynamicClusterRole, rules []v1.PolicyRule, inheritedRoles []rbacv1alpha1.InheritedRole, discoveryVersion int64, c client.Client, scheme *runtime.Scheme, logger logr.Logger, recorder record.EventRecorder) (ctrl.Result, error) {
+	status := &dynamicClusterRole.Status.ComputedRoleStatus
+
+	namespaces, err := SelectedNamespaces(c, dynamicClusterRole)
+	if err != nil {
+		return reconcileFailed(c, recorder, dynamicClusterRole, status, dynamicClusterRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+	}
+
+	logger.Info(fmt.Sprintf("Computed role with %d rules for %d namespaces.", len(rules), len(namespaces)))
+	created, updated := 0, 0
+	stamped, skipped := []string{}, []string{}
+	for _, namespace := range namespaces {
+		outputRole := StampedRole(dynamicClusterRole, namespace, rules)
+		if err := controllerutil.SetControllerReference(dynamicClusterRole, outputRole, scheme); err != nil {
+			return reconcileFailed(c, recorder, dynamicClusterRole, status, dynamicClusterRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+		}
+		// status.namespaces still lists the namespaces the Role was stamped into by the previous reconciliation
+		expected := false
+		for _, stampedNamespace := range dynamicClusterRole.Status.Namespaces {
+			expected = expected || stampedNamespace == namespace
+		}
+		previousRules, existed, drifted, err := helpers.CreateOrUpdateRole(outputRole, expected, c)
+		if helpers.IsNotControlled(err) {
+			// A Role of the same name that was not stamped by this DynamicClusterRole is never overwritten
+			skipped = append(skipped, namespace)
+			continue
+		}
+		if err != nil {
+			return reconcileFailed(c, recorder, dynamicClusterRole, status, dynamicClusterRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+		}
+		if drifted {
+			recordDriftCorrected(recorder, dynamicClusterRole, "Role", namespace+"/"+outputRole.Name)
+		}
+		stamped = append(stamped, namespace)
+		if !existed {
+			created++
+		} else if added, removed := helpers.DiffPolicyRules(previousRules, rules); added > 0 || removed > 0 {
+			updated++
+		}
+	}
+
+	deleted, err := deleteNamespacedRoles(dynamicClusterRole, c, namespaces)
+	if err != nil {
+		return reconcileFailed(c, recorder, dynamicClusterRole, status, dynamicClusterRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+	}
+	if err := deleteGeneratedClusterRole(dynamicClusterRole, c); err != nil {
+		return reconcileFailed(c, recorder, dynamicClusterRole, status, dynamicClusterRole.Generation, logger, rbacv1alpha1.ReasonReconcileFailed, err)
+	}
+	recordRolesStamped(recorder, dynamicClusterRole, dynamicClusterRole.Name, created, updated, deleted)
+
+	generatedRuleCounts.set(dependantKindDynamicClusterRole, "", dynamicClusterRole.Name, len(rules))
+	recordReconcileSuccess(status, dynamicClusterRole.Generation, dynamicClusterRole.Name, len(rules), inheritedRoles, discoveryVersion)
+	if len(skipped) > 0 {
+		recordRolesNotControlled(recorder, dynamicClusterRole, status, dynamicClusterRole.Generation, dynamicClusterRole.Name, skipped)
+	}
+	dynamicClusterRole.Status.Namespaces = stamped
+	dynamicClusterRole.Status.SkippedNamespaces = skipped
+	err = c.Status().Update(context.TODO(), dynamicClusterRole)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// deleteNamespacedRoles deletes the Roles stamped by a DynamicClusterRole in every namespace except the ones to keep, and returns how many were deleted
+func deleteNamespacedRoles(dynamicClusterRole *rbacv1alpha1.DynamicClusterRole, c client.Client, keep []string) (int, error) {
+	roleList := &v1.RoleList{}
+	err := c.List(context.TODO(), roleList, client.MatchingLabels{DynamicClusterRoleLabel: dynamicClusterRole.Name})
+	if err != nil {
+		return 0, err
+	}
+
+	keepNamespaces := map[string]bool{}
+	for _, namespace := range keep {
+		keepNamespaces[namespace] = true
+	}
+
+	deleted := 0
+	for i := range roleList.Items {
+		role := &roleList.Items[i]
+		if keepNamespaces[role.Namespace] || !metav1.IsControlledBy(role, dynamicClusterRole) {
+			continue
+		}
+		err := c.Delete(context.TODO(), role)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deleteGeneratedClusterRole deletes the ClusterRole generated for a DynamicClusterRole, if it exists and is controlled by it
+func deleteGeneratedClusterRole(dynamicClusterRole *rbacv1alpha1.DynamicClusterRole, c client.Client) error {
+	found := &v1.ClusterRole{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: dynamicClusterRole.Name}, found)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(found, dynamicClusterRole) {
+		return nil
+	}
+	err = c.Delete(context.TODO(), found)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// dynamicClusterRolesForNamespace maps a namespace event to every DynamicClusterRole with a namespaceSelector
+// The namespace is not matched against the selectors here so that a namespace which stopped matching still triggers the removal of its Role
+func dynamicClusterRolesForNamespace(c client.Client, log logr.Logger) handler.ToRequestsFunc {
+	return func(namespace handler.MapObject) []reconcile.Request {
+		dynamicClusterRoles := &rbacv1alpha1.DynamicClusterRoleList{}
+		err := c.List(context.TODO(), dynamicClusterRoles)
+		if err != nil {
+			log.Error(err, "could not list DynamicClusterRoles for namespace", "namespace", namespace.Meta.GetName())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for _, dynamicClusterRole := range dynamicClusterRoles.Items {
+			if dynamicClusterRole.Spec.NamespaceSelector == nil {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: dynamicClusterRole.Name}})
+		}
+		return requests
+	}
+}
@@ -0,0 +1,161 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+)
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbacv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func tenantNamespace(name string, tenant string, phase corev1.NamespacePhase) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"tenant": tenant}},
+		Status:     corev1.NamespaceStatus{Phase: phase},
+	}
+}
+
+func tenantDynamicClusterRole() *rbacv1alpha1.DynamicClusterRole {
+	return &rbacv1alpha1.DynamicClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant-developer", UID: "dcr-uid"},
+		Spec:       rbacv1alpha1.DynamicClusterRoleSpec{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "yes"}}},
+	}
+}
+
+// stampedNamespaces returns the sorted namespaces holding a Role stamped by the DynamicClusterRole
+func stampedNamespaces(t *testing.T, c client.Client, name string) []string {
+	roleList := &v1.RoleList{}
+	if err := c.List(context.TODO(), roleList, client.MatchingLabels{DynamicClusterRoleLabel: name}); err != nil {
+		t.Fatal(err)
+	}
+	namespaces := []string{}
+	for _, role := range roleList.Items {
+		namespaces = append(namespaces, role.Namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+func TestSelectedNamespaces(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(newTestScheme(t),
+		tenantNamespace("team-b", "yes", corev1.NamespaceActive),
+		tenantNamespace("team-a", "yes", corev1.NamespaceActive),
+		tenantNamespace("leaving", "yes", corev1.NamespaceTerminating),
+		tenantNamespace("kube-system", "no", corev1.NamespaceActive),
+	)
+	namespaces, err := SelectedNamespaces(c, tenantDynamicClusterRole())
+	if err != nil {
+		t.Fatalf("SelectedNamespaces() error = %v", err)
+	}
+	if want := []string{"team-a", "team-b"}; !reflect.DeepEqual(namespaces, want) {
+		t.Errorf("SelectedNamespaces() = %q, want %q without the terminating namespace", namespaces, want)
+	}
+}
+
+func TestDeleteNamespacedRoles(t *testing.T) {
+	scheme := newTestScheme(t)
+	dynamicClusterRole := tenantDynamicClusterRole()
+	stamped := func(namespace string, controlled bool) *v1.Role {
+		role := StampedRole(dynamicClusterRole, namespace, nil)
+		if controlled {
+			if err := controllerutil.SetControllerReference(dynamicClusterRole, role, scheme); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return role
+	}
+	otherRole := StampedRole(&rbacv1alpha1.DynamicClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "other"}}, "team-b", nil)
+	c := fake.NewFakeClientWithScheme(scheme, stamped("team-a", true), stamped("team-b", true), stamped("team-c", false), otherRole)
+
+	deleted, err := deleteNamespacedRoles(dynamicClusterRole, c, []string{"team-a"})
+	if err != nil {
+		t.Fatalf("deleteNamespacedRoles() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleteNamespacedRoles() deleted %d Roles, want 1", deleted)
+	}
+	if namespaces, want := stampedNamespaces(t, c, dynamicClusterRole.Name), []string{"team-a", "team-c"}; !reflect.DeepEqual(namespaces, want) {
+		t.Errorf("Roles left in %q, want %q: kept namespaces and Roles it does not control must not be deleted", namespaces, want)
+	}
+	if namespaces := stampedNamespaces(t, c, "other"); len(namespaces) != 1 {
+		t.Errorf("the Role of another DynamicClusterRole was deleted")
+	}
+}
+
+func TestReconcileNamespacedRoles(t *testing.T) {
+	scheme := newTestScheme(t)
+	dynamicClusterRole := tenantDynamicClusterRole()
+	stale := StampedRole(dynamicClusterRole, "former-tenant", nil)
+	if err := controllerutil.SetControllerReference(dynamicClusterRole, stale, scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewFakeClientWithScheme(scheme,
+		dynamicClusterRole,
+		tenantNamespace("team-a", "yes", corev1.NamespaceActive),
+		tenantNamespace("team-b", "yes", corev1.NamespaceActive),
+		tenantNamespace("leaving", "yes", corev1.NamespaceTerminating),
+		tenantNamespace("former-tenant", "no", corev1.NamespaceActive),
+		stale,
+	)
+	rules := []v1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+		{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}},
+	}
+
+	if _, err := reconcileNamespacedRoles(dynamicClusterRole, rules, nil, 1, c, scheme, ctrl.Log.WithName("test"), record.NewFakeRecorder(10)); err != nil {
+		t.Fatalf("reconcileNamespacedRoles() error = %v", err)
+	}
+	want := []string{"team-a", "team-b"}
+	if namespaces := stampedNamespaces(t, c, dynamicClusterRole.Name); !reflect.DeepEqual(namespaces, want) {
+		t.Errorf("Roles stamped into %q, want %q", namespaces, want)
+	}
+	if !reflect.DeepEqual(dynamicClusterRole.Status.Namespaces, want) {
+		t.Errorf("status.namespaces = %q, want %q", dynamicClusterRole.Status.Namespaces, want)
+	}
+	role := &v1.Role{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "team-a", Name: dynamicClusterRole.Name}, role); err != nil {
+		t.Fatal(err)
+	}
+	if len(role.Rules) != 1 || len(role.Rules[0].NonResourceURLs) > 0 {
+		t.Errorf("stamped Role has rules %v, want the nonResourceURLs stripped", role.Rules)
+	}
+}
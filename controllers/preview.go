@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// computePreview compares the rules computed for a dynamic role in Preview mode with the rules of its generated role
+func computePreview(generatedRules []rbacv1.PolicyRule, computedRules []rbacv1.PolicyRule) *rbacv1alpha1.RulePreview {
+	added, removed := helpers.PolicyRuleChanges(generatedRules, computedRules)
+	permissionsAdded, permissionsRemoved := helpers.DiffPolicyRules(generatedRules, computedRules)
+	return &rbacv1alpha1.RulePreview{
+		Rules:              computedRules,
+		Added:              helpers.CompactPolicyRules(added),
+		Removed:            helpers.CompactPolicyRules(removed),
+		PermissionsAdded:   permissionsAdded,
+		PermissionsRemoved: permissionsRemoved,
+	}
+}
+
+// reconcilePreview publishes the rules computed for a dynamic role in Preview mode, and how they differ from its generated role, without touching the generated role
+func reconcilePreview(c client.Client, recorder record.EventRecorder, instance runtime.Object, status *rbacv1alpha1.ComputedRoleStatus, generation int64, logger logr.Logger, kind string, generatedRules []rbacv1.PolicyRule, computedRules []rbacv1.PolicyRule, inheritedRoles []rbacv1alpha1.InheritedRole, discoveryVersion int64) (ctrl.Result, error) {
+	preview := computePreview(generatedRules, computedRules)
+	logger.Info("Computed rules in Preview mode - the generated role is left unchanged", "added", preview.PermissionsAdded, "removed", preview.PermissionsRemoved)
+	recordPreviewComputed(recorder, instance, kind, preview)
+	// The status only holds as many rules as fit in its size limit, the event counts all of them
+	recordPreview(status, generation, helpers.LimitedPreview(preview), inheritedRoles, discoveryVersion)
+	if err := c.Status().Update(context.TODO(), instance); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
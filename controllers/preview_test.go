@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+func TestComputePreview(t *testing.T) {
+	podsRead := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}
+	secretsRead := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list"}}
+	tests := []struct {
+		name        string
+		generated   []rbacv1.PolicyRule
+		computed    []rbacv1.PolicyRule
+		wantAdded   []rbacv1.PolicyRule
+		wantRemoved []rbacv1.PolicyRule
+		wantCounts  [2]int
+	}{
+		{
+			name:      "unchanged",
+			generated: []rbacv1.PolicyRule{podsRead, secretsRead},
+			computed:  []rbacv1.PolicyRule{podsRead, secretsRead},
+		},
+		{
+			name:      "the same permissions grouped differently",
+			generated: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get", "list"}}},
+			computed:  []rbacv1.PolicyRule{podsRead, secretsRead},
+		},
+		{
+			name:       "permissions added",
+			generated:  []rbacv1.PolicyRule{podsRead},
+			computed:   []rbacv1.PolicyRule{podsRead, secretsRead},
+			wantAdded:  []rbacv1.PolicyRule{secretsRead},
+			wantCounts: [2]int{2, 0},
+		},
+		{
+			name:        "permissions added and removed",
+			generated:   []rbacv1.PolicyRule{podsRead, secretsRead},
+			computed:    []rbacv1.PolicyRule{podsRead, {APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "watch"}}},
+			wantAdded:   []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"watch"}}},
+			wantRemoved: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"list"}}},
+			wantCounts:  [2]int{1, 1},
+		},
+		{
+			name:       "generated role not created yet",
+			computed:   []rbacv1.PolicyRule{podsRead},
+			wantAdded:  []rbacv1.PolicyRule{podsRead},
+			wantCounts: [2]int{2, 0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			preview := computePreview(test.generated, test.computed)
+			if !reflect.DeepEqual(preview.Rules, test.computed) {
+				t.Errorf("preview rules = %v, want the computed rules %v", preview.Rules, test.computed)
+			}
+			if len(preview.Added) != len(test.wantAdded) || len(preview.Removed) != len(test.wantRemoved) ||
+				(len(test.wantAdded) > 0 && !reflect.DeepEqual(helpers.NormalizePolicyRules(preview.Added), helpers.NormalizePolicyRules(test.wantAdded))) ||
+				(len(test.wantRemoved) > 0 && !reflect.DeepEqual(helpers.NormalizePolicyRules(preview.Removed), helpers.NormalizePolicyRules(test.wantRemoved))) {
+				t.Errorf("preview added %v and removed %v, want %v and %v", preview.Added, preview.Removed, test.wantAdded, test.wantRemoved)
+			}
+			if counts := [2]int{preview.PermissionsAdded, preview.PermissionsRemoved}; counts != test.wantCounts {
+				t.Errorf("preview counts %d added and %d removed permissions, want %d and %d", counts[0], counts[1], test.wantCounts[0], test.wantCounts[1])
+			}
+		})
+	}
+}
+
+func TestReconcilePreview(t *testing.T) {
+	generatedRules := []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}}
+	computedRules := []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get"}}}
+	dynamicRole := &rbacv1alpha1.DynamicRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "developer", Namespace: "team-a", Generation: 3},
+		Spec:       rbacv1alpha1.DynamicRoleSpec{Mode: rbacv1alpha1.ModePreview},
+	}
+	generatedRole := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "developer", Namespace: "team-a"}, Rules: generatedRules}
+	c := fake.NewFakeClientWithScheme(newTestScheme(t), dynamicRole, generatedRole)
+
+	if _, err := reconcilePreview(c, record.NewFakeRecorder(10), dynamicRole, &dynamicRole.Status.ComputedRoleStatus, dynamicRole.Generation, ctrl.Log.WithName("test"), "Role", generatedRules, computedRules, nil, 1); err != nil {
+		t.Fatalf("reconcilePreview() error = %v", err)
+	}
+
+	found := &rbacv1.Role{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "team-a", Name: "developer"}, found); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found.Rules, generatedRules) {
+		t.Errorf("the generated role was changed to %v in Preview mode", found.Rules)
+	}
+	stored := &rbacv1alpha1.DynamicRole{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "team-a", Name: "developer"}, stored); err != nil {
+		t.Fatal(err)
+	}
+	status := stored.Status.ComputedRoleStatus
+	if status.Preview == nil || status.Preview.PermissionsAdded != 1 || status.Preview.PermissionsRemoved != 0 {
+		t.Fatalf("status.preview = %+v, want 1 permission added", status.Preview)
+	}
+	if status.ObservedGeneration != 3 {
+		t.Errorf("status.observedGeneration = %d, want 3", status.ObservedGeneration)
+	}
+	for _, condition := range status.Conditions {
+		if condition.Type == rbacv1alpha1.ConditionReady && (condition.Status != metav1.ConditionFalse || condition.Reason != rbacv1alpha1.ReasonPreviewing) {
+			t.Errorf("Ready condition = %+v, want False because of %s", condition, rbacv1alpha1.ReasonPreviewing)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// recomputeQueueSize bounds the number of recomputation requests waiting to be picked up by the dynamic role controllers
+const recomputeQueueSize = 1024
+
+// RecomputeQueue delivers the dynamic roles affected by a change to their own reconcilers, which de-duplicate and process them concurrently
+type RecomputeQueue struct {
+	DynamicRoles        chan event.GenericEvent
+	DynamicClusterRoles chan event.GenericEvent
+}
+
+// NewRecomputeQueue returns a queue whose channels are watched by the DynamicRole and DynamicClusterRole controllers
+func NewRecomputeQueue() *RecomputeQueue {
+	return &RecomputeQueue{
+		DynamicRoles:        make(chan event.GenericEvent, recomputeQueueSize),
+		DynamicClusterRoles: make(chan event.GenericEvent, recomputeQueueSize),
+	}
+}
+
+// Enqueue requests the recomputation of every given dynamic role, after a change to an object of the source kind
+func (q *RecomputeQueue) Enqueue(source string, dependants []helpers.Dependant) {
+	recomputeTriggers.WithLabelValues(source).Add(float64(len(dependants)))
+	for _, dependant := range dependants {
+		meta := metav1.ObjectMeta{Name: dependant.Name, Namespace: dependant.Namespace}
+		switch dependant.Kind {
+		case dependantKindDynamicRole:
+			object := &rbacv1alpha1.DynamicRole{ObjectMeta: meta}
+			q.DynamicRoles <- event.GenericEvent{Meta: object, Object: object}
+		case dependantKindDynamicClusterRole:
+			object := &rbacv1alpha1.DynamicClusterRole{ObjectMeta: meta}
+			q.DynamicClusterRoles <- event.GenericEvent{Meta: object, Object: object}
+		}
+	}
+}
+
+const (
+	dependantKindDynamicRole        = "DynamicRole"
+	dependantKindDynamicClusterRole = "DynamicClusterRole"
+)
+
+func dynamicRoleDependant(namespace string, name string) helpers.Dependant {
+	return helpers.Dependant{Kind: dependantKindDynamicRole, Namespace: namespace, Name: name}
+}
+
+func dynamicClusterRoleDependant(name string) helpers.Dependant {
+	return helpers.Dependant{Kind: dependantKindDynamicClusterRole, Name: name}
+}
@@ -18,22 +18,31 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/go-logr/logr"
 	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 // RoleReconciler reconciles a Role object
 type RoleReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-	Cache  *helpers.ResourceCache
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Cache    *helpers.ResourceCache
+	Queue    *RecomputeQueue
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=rbac.redhatcop.redhat.io,resources=roles,verbs=get;list;watch;create;update;patch;delete
@@ -43,15 +52,33 @@ func (r *RoleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	_ = context.Background()
 	_ = r.Log.WithValues("role", req.NamespacedName)
 
-	result := ctrl.Result{}
-	var err error
+	dependants := r.Cache.Dependencies.DependantsOfRole(req.NamespacedName)
 
-	if _, exists := r.Cache.WatchedRoles[req.NamespacedName]; exists {
-		r.Log.Info("A role referenced by a dynamic resource has been updated - reconciling now")
-		result, err = UpdateAllDynamicResources(r.Client, r.Log, r.Scheme, r.Cache)
+	role := &rbacv1.Role{}
+	err := r.Client.Get(context.TODO(), req.NamespacedName, role)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		// A deleted role may have matched a label selector of a dynamic resource, and its labels are no longer known
+		dependants = append(dependants, r.Cache.Dependencies.DependantsOfDeletedRole(req.Namespace)...)
+	} else {
+		dependants = append(dependants, r.Cache.Dependencies.DependantsOfRoleLabels(role.Namespace, labels.Set(role.Labels), func() labels.Set {
+			namespace := &corev1.Namespace{}
+			if err := r.Client.Get(context.TODO(), types.NamespacedName{Name: role.Namespace}, namespace); err != nil {
+				r.Log.Error(err, "could not get the namespace of a role to match namespace selectors", "namespace", role.Namespace)
+				return labels.Set{}
+			}
+			return labels.Set(namespace.Labels)
+		})...)
 	}
 
-	return result, err
+	if len(dependants) > 0 {
+		r.Log.Info(fmt.Sprintf("A role inherited by %d dynamic resources has been updated - recomputing them now", len(dependants)))
+		r.Queue.Enqueue("Role", dependants)
+	}
+
+	return reconcile.Result{}, nil
 }
 
 func (r *RoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// recordReconcileSuccess updates a dynamic role's status after its generated role has been written
+func recordReconcileSuccess(status *rbacv1alpha1.ComputedRoleStatus, generation int64, roleName string, ruleCount int, inheritedRoles []rbacv1alpha1.InheritedRole, discoveryVersion int64) {
+	status.ObservedGeneration = generation
+	status.GeneratedRoleName = roleName
+	status.RuleCount = ruleCount
+	status.InheritedRoles = inheritedRoles
+	status.DiscoveryVersion = discoveryVersion
+	status.Preview = nil
+	status.LastError = ""
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             rbacv1alpha1.ReasonRoleReconciled,
+		Message:            fmt.Sprintf("Generated role %s with %d rules", roleName, ruleCount),
+	})
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             rbacv1alpha1.ReasonRoleReconciled,
+	})
+}
+
+// recordRolesNotControlled reports in a DynamicClusterRole's status and events the namespaces it left untouched, because they hold a Role of the same name that it does not control
+func recordRolesNotControlled(recorder record.EventRecorder, instance runtime.Object, status *rbacv1alpha1.ComputedRoleStatus, generation int64, name string, namespaces []string) {
+	message := fmt.Sprintf("Role %s already exists and is not controlled by this DynamicClusterRole in namespaces %s", name, strings.Join(namespaces, ", "))
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             rbacv1alpha1.ReasonNotControlled,
+		Message:            message,
+	})
+	recorder.Event(instance, corev1.EventTypeWarning, rbacv1alpha1.ReasonNotControlled, message)
+}
+
+// recordDiscoveryStaleness reports in a dynamic role's status whether its rules were computed from API groups that could not be discovered
+func recordDiscoveryStaleness(status *rbacv1alpha1.ComputedRoleStatus, generation int64, staleGroups []string) {
+	if len(staleGroups) == 0 {
+		status.SetCondition(rbacv1alpha1.Condition{
+			Type:               rbacv1alpha1.ConditionDiscoveryStale,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             rbacv1alpha1.ReasonDiscoveryComplete,
+		})
+		return
+	}
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionDiscoveryStale,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             rbacv1alpha1.ReasonAPIGroupsStale,
+		Message:            fmt.Sprintf("API groups %s could not be discovered, their resources are taken from the last successful discovery", strings.Join(staleGroups, ", ")),
+	})
+}
+
+// recordNonResourceURLNarrowing reports in a dynamic role's status the granted nonResourceURL patterns that a deny rule only partly covered,
+// which no longer grant the URLs they matched beyond those the API server serves
+func recordNonResourceURLNarrowing(status *rbacv1alpha1.ComputedRoleStatus, generation int64, patterns []string) {
+	if len(patterns) == 0 {
+		status.SetCondition(rbacv1alpha1.Condition{
+			Type:               rbacv1alpha1.ConditionNonResourceURLsNarrowed,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             rbacv1alpha1.ReasonNonResourceURLsKept,
+		})
+		return
+	}
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionNonResourceURLsNarrowed,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             rbacv1alpha1.ReasonPartialNonResourceURLDeny,
+		Message:            fmt.Sprintf("nonResourceURLs %s are only partly denied, so they were narrowed down to the URLs the API server serves; any other URL they matched must be allowed explicitly", strings.Join(patterns, ", ")),
+	})
+}
+
+// recordPreview updates a dynamic role's status after its rules have been computed in Preview mode, leaving its generated role as it is
+func recordPreview(status *rbacv1alpha1.ComputedRoleStatus, generation int64, preview *rbacv1alpha1.RulePreview, inheritedRoles []rbacv1alpha1.InheritedRole, discoveryVersion int64) {
+	status.ObservedGeneration = generation
+	status.InheritedRoles = inheritedRoles
+	status.DiscoveryVersion = discoveryVersion
+	status.Preview = preview
+	status.LastError = ""
+	message := fmt.Sprintf("Enforcing the spec would add %d and remove %d permissions; the generated role is unchanged", preview.PermissionsAdded, preview.PermissionsRemoved)
+	if preview.RulesOmitted > 0 {
+		message += fmt.Sprintf("; %d rules were left out of status.preview to keep it small, run dynamic-rbac compute to see them all", preview.RulesOmitted)
+	}
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             rbacv1alpha1.ReasonPreviewing,
+		Message:            message,
+	})
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             rbacv1alpha1.ReasonPreviewing,
+	})
+}
+
+// recordReconcileFailure updates a dynamic role's status after its generated role could not be computed or written
+func recordReconcileFailure(status *rbacv1alpha1.ComputedRoleStatus, generation int64, reason string, err error) {
+	status.ObservedGeneration = generation
+	status.LastError = err.Error()
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            err.Error(),
+	})
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            err.Error(),
+	})
+}
+
+// reconcileFailed records an error in a dynamic role's status and events and returns it so that the request is retried
+// Inheritance cycles can only be fixed by changing a spec, which triggers a new reconciliation anyway, so they are not retried
+func reconcileFailed(c client.Client, recorder record.EventRecorder, instance runtime.Object, status *rbacv1alpha1.ComputedRoleStatus, generation int64, logger logr.Logger, reason string, err error) (ctrl.Result, error) {
+	recordReconcileFailure(status, generation, reason, err)
+	reconcileErrors.WithLabelValues(reason).Inc()
+	recorder.Event(instance, corev1.EventTypeWarning, reason, err.Error())
+	if statusErr := c.Status().Update(context.TODO(), instance); statusErr != nil {
+		logger.Error(statusErr, "could not record the reconciliation failure in the status")
+	}
+	if helpers.IsInheritanceCycle(err) {
+		logger.Info(err.Error())
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{}, err
+}
+
+// recordBindingSuccess updates a dynamic binding's status after its generated binding has been written
+func recordBindingSuccess(status *rbacv1alpha1.ComputedBindingStatus, generation int64, bindingName string, subjects []rbacv1.Subject) {
+	status.ObservedGeneration = generation
+	status.GeneratedBindingName = bindingName
+	status.SubjectCount = len(subjects)
+	status.Subjects = subjects
+	status.LastError = ""
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             rbacv1alpha1.ReasonBindingReconciled,
+		Message:            fmt.Sprintf("Generated binding %s with %d subjects", bindingName, len(subjects)),
+	})
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             rbacv1alpha1.ReasonBindingReconciled,
+	})
+}
+
+// recordBindingFailure updates a dynamic binding's status after its generated binding could not be resolved or written
+func recordBindingFailure(status *rbacv1alpha1.ComputedBindingStatus, generation int64, reason string, err error) {
+	status.ObservedGeneration = generation
+	status.LastError = err.Error()
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            err.Error(),
+	})
+	status.SetCondition(rbacv1alpha1.Condition{
+		Type:               rbacv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            err.Error(),
+	})
+}
+
+// bindingReconcileFailed records an error in a dynamic binding's status and events and returns it so that the request is retried
+func bindingReconcileFailed(c client.Client, recorder record.EventRecorder, instance runtime.Object, status *rbacv1alpha1.ComputedBindingStatus, generation int64, logger logr.Logger, reason string, err error) (ctrl.Result, error) {
+	recordBindingFailure(status, generation, reason, err)
+	reconcileErrors.WithLabelValues(reason).Inc()
+	recorder.Event(instance, corev1.EventTypeWarning, reason, err.Error())
+	if statusErr := c.Status().Update(context.TODO(), instance); statusErr != nil {
+		logger.Error(statusErr, "could not record the reconciliation failure in the status")
+	}
+	return reconcile.Result{}, err
+}
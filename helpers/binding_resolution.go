@@ -0,0 +1,181 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResolveRoleRef returns the RBAC roleRef for the role generated from a dynamic role
+// A DynamicClusterRole with a namespaceSelector generates Roles rather than a ClusterRole, so it can only be bound within a namespace
+func ResolveRoleRef(c client.Client, roleRef v1alpha1.RoleReference, forNamespace string) (v1.RoleRef, error) {
+	switch roleRef.Kind {
+	case "DynamicRole":
+		if forNamespace == "" {
+			return v1.RoleRef{}, errors.New("a DynamicRole can only be bound by a DynamicRoleBinding")
+		}
+		dynamicRole := &v1alpha1.DynamicRole{}
+		err := c.Get(context.TODO(), types.NamespacedName{Name: roleRef.Name, Namespace: forNamespace}, dynamicRole)
+		if err != nil {
+			return v1.RoleRef{}, err
+		}
+		return v1.RoleRef{APIGroup: v1.GroupName, Kind: "Role", Name: dynamicRole.Name}, nil
+	case "DynamicClusterRole":
+		dynamicClusterRole := &v1alpha1.DynamicClusterRole{}
+		err := c.Get(context.TODO(), types.NamespacedName{Name: roleRef.Name}, dynamicClusterRole)
+		if err != nil {
+			return v1.RoleRef{}, err
+		}
+		if dynamicClusterRole.Spec.NamespaceSelector != nil {
+			if forNamespace == "" {
+				return v1.RoleRef{}, fmt.Errorf("DynamicClusterRole %s has a namespaceSelector and can only be bound by a DynamicRoleBinding", dynamicClusterRole.Name)
+			}
+			return v1.RoleRef{APIGroup: v1.GroupName, Kind: "Role", Name: dynamicClusterRole.Name}, nil
+		}
+		return v1.RoleRef{APIGroup: v1.GroupName, Kind: "ClusterRole", Name: dynamicClusterRole.Name}, nil
+	default:
+		return v1.RoleRef{}, fmt.Errorf("roleRef kind %q is not supported, it must be DynamicRole or DynamicClusterRole", roleRef.Kind)
+	}
+}
+
+// ResolveSubjects returns the sorted, de-duplicated RBAC subjects currently selected by a dynamic binding's subject selectors
+// ServiceAccounts without a namespace or namespaceSelector are looked up in forNamespace, or in every namespace when forNamespace is empty
+func ResolveSubjects(c client.Client, selectors []v1alpha1.SubjectSelector, forNamespace string) ([]v1.Subject, error) {
+	seen := map[v1.Subject]bool{}
+	subjects := []v1.Subject{}
+	for _, selector := range selectors {
+		resolved, err := resolveSubjectSelector(c, selector, forNamespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, subject := range resolved {
+			if seen[subject] {
+				continue
+			}
+			seen[subject] = true
+			subjects = append(subjects, subject)
+		}
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].Kind != subjects[j].Kind {
+			return subjects[i].Kind < subjects[j].Kind
+		}
+		if subjects[i].Namespace != subjects[j].Namespace {
+			return subjects[i].Namespace < subjects[j].Namespace
+		}
+		return subjects[i].Name < subjects[j].Name
+	})
+	return subjects, nil
+}
+
+func resolveSubjectSelector(c client.Client, selector v1alpha1.SubjectSelector, forNamespace string) ([]v1.Subject, error) {
+	switch selector.Kind {
+	case v1.UserKind, v1.GroupKind:
+		if selector.Name == "" {
+			return nil, fmt.Errorf("a %s subject must specify a name", selector.Kind)
+		}
+		if selector.LabelSelector != nil || selector.NamespaceSelector != nil || selector.Namespace != "" {
+			return nil, fmt.Errorf("a %s subject can only be selected by name", selector.Kind)
+		}
+		return []v1.Subject{{APIGroup: v1.GroupName, Kind: selector.Kind, Name: selector.Name}}, nil
+	case v1.ServiceAccountKind:
+		return resolveServiceAccounts(c, selector, forNamespace)
+	default:
+		return nil, fmt.Errorf("subject kind %q is not supported, it must be User, Group or ServiceAccount", selector.Kind)
+	}
+}
+
+func resolveServiceAccounts(c client.Client, selector v1alpha1.SubjectSelector, forNamespace string) ([]v1.Subject, error) {
+	if (selector.Name == "") == (selector.LabelSelector == nil) {
+		return nil, errors.New("a ServiceAccount subject must specify exactly one of a name and a label selector")
+	}
+	if selector.Namespace != "" && selector.NamespaceSelector != nil {
+		return nil, errors.New("a ServiceAccount subject cannot specify both a namespace and a namespace selector")
+	}
+
+	useNamespace := forNamespace
+	if selector.Namespace != "" {
+		useNamespace = selector.Namespace
+	}
+	var namespaces []string
+	if selector.NamespaceSelector != nil {
+		namespaceSelector, err := metav1.LabelSelectorAsSelector(selector.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		namespaces, err = ListNamespacesForSelector(c, namespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+	} else if useNamespace != "" {
+		namespaces = []string{useNamespace}
+	}
+
+	if selector.Name != "" {
+		if namespaces == nil {
+			return nil, fmt.Errorf("ServiceAccount %s must specify a namespace or a namespace selector", selector.Name)
+		}
+		subjects := []v1.Subject{}
+		for _, namespace := range namespaces {
+			subjects = append(subjects, v1.Subject{Kind: v1.ServiceAccountKind, Name: selector.Name, Namespace: namespace})
+		}
+		return subjects, nil
+	}
+
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	serviceAccountList := &corev1.ServiceAccountList{}
+	err = c.List(context.TODO(), serviceAccountList, client.MatchingLabelsSelector{Selector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	inNamespace := map[string]bool{}
+	for _, namespace := range namespaces {
+		inNamespace[namespace] = true
+	}
+	subjects := []v1.Subject{}
+	for _, serviceAccount := range serviceAccountList.Items {
+		if namespaces != nil && !inNamespace[serviceAccount.Namespace] {
+			continue
+		}
+		subjects = append(subjects, v1.Subject{Kind: v1.ServiceAccountKind, Name: serviceAccount.Name, Namespace: serviceAccount.Namespace})
+	}
+	return subjects, nil
+}
+
+// DiffSubjects counts the subjects that were added and removed between two versions of a binding
+func DiffSubjects(previous []v1.Subject, current []v1.Subject) (added int, removed int) {
+	previousSet := map[v1.Subject]bool{}
+	for _, subject := range previous {
+		previousSet[subject] = true
+	}
+	currentSet := map[v1.Subject]bool{}
+	for _, subject := range current {
+		currentSet[subject] = true
+		if !previousSet[subject] {
+			added++
+		}
+	}
+	for subject := range previousSet {
+		if !currentSet[subject] {
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// subjectsUnchanged returns true if two bindings hold the same subjects, regardless of their order
+func subjectsUnchanged(previous []v1.Subject, current []v1.Subject) bool {
+	added, removed := DiffSubjects(previous, current)
+	return added == 0 && removed == 0 && len(previous) == len(current)
+}
@@ -0,0 +1,159 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolveRoleRef(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewFakeClientWithScheme(scheme,
+		&v1alpha1.DynamicRole{ObjectMeta: metav1.ObjectMeta{Name: "developer", Namespace: "team-a"}},
+		&v1alpha1.DynamicClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}},
+		&v1alpha1.DynamicClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}, Spec: v1alpha1.DynamicClusterRoleSpec{NamespaceSelector: &metav1.LabelSelector{}}},
+	)
+
+	tests := []struct {
+		name      string
+		roleRef   v1alpha1.RoleReference
+		namespace string
+		want      v1.RoleRef
+		wantErr   bool
+	}{
+		{name: "DynamicRole", roleRef: v1alpha1.RoleReference{Kind: "DynamicRole", Name: "developer"}, namespace: "team-a", want: v1.RoleRef{APIGroup: v1.GroupName, Kind: "Role", Name: "developer"}},
+		{name: "DynamicRole of another namespace", roleRef: v1alpha1.RoleReference{Kind: "DynamicRole", Name: "developer"}, namespace: "team-b", wantErr: true},
+		{name: "DynamicRole in a cluster binding", roleRef: v1alpha1.RoleReference{Kind: "DynamicRole", Name: "developer"}, wantErr: true},
+		{name: "DynamicClusterRole", roleRef: v1alpha1.RoleReference{Kind: "DynamicClusterRole", Name: "viewer"}, want: v1.RoleRef{APIGroup: v1.GroupName, Kind: "ClusterRole", Name: "viewer"}},
+		{name: "DynamicClusterRole in a namespace", roleRef: v1alpha1.RoleReference{Kind: "DynamicClusterRole", Name: "viewer"}, namespace: "team-a", want: v1.RoleRef{APIGroup: v1.GroupName, Kind: "ClusterRole", Name: "viewer"}},
+		{name: "DynamicClusterRole stamping Roles", roleRef: v1alpha1.RoleReference{Kind: "DynamicClusterRole", Name: "tenant"}, namespace: "team-a", want: v1.RoleRef{APIGroup: v1.GroupName, Kind: "Role", Name: "tenant"}},
+		{name: "DynamicClusterRole stamping Roles in a cluster binding", roleRef: v1alpha1.RoleReference{Kind: "DynamicClusterRole", Name: "tenant"}, wantErr: true},
+		{name: "unknown kind", roleRef: v1alpha1.RoleReference{Kind: "ClusterRole", Name: "admin"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveRoleRef(c, test.roleRef, test.namespace)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ResolveRoleRef() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ResolveRoleRef() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveSubjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	serviceAccount := func(namespace string, name string, app string) *corev1.ServiceAccount {
+		return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"app": app}}}
+	}
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tenant": "yes"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"tenant": "yes"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ci"}},
+		serviceAccount("team-a", "deployer", "ci"), serviceAccount("team-a", "web", "web"),
+		serviceAccount("team-b", "deployer", "ci"), serviceAccount("ci", "runner", "ci"),
+	)
+	ci := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "ci"}}
+	tenants := &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "yes"}}
+	user := func(name string) v1.Subject {
+		return v1.Subject{APIGroup: v1.GroupName, Kind: v1.UserKind, Name: name}
+	}
+	group := func(name string) v1.Subject {
+		return v1.Subject{APIGroup: v1.GroupName, Kind: v1.GroupKind, Name: name}
+	}
+	sa := func(namespace string, name string) v1.Subject {
+		return v1.Subject{Kind: v1.ServiceAccountKind, Name: name, Namespace: namespace}
+	}
+
+	tests := []struct {
+		name      string
+		selectors []v1alpha1.SubjectSelector
+		namespace string
+		want      []v1.Subject
+		wantErr   bool
+	}{
+		{
+			name:      "users and groups, sorted and de-duplicated",
+			selectors: []v1alpha1.SubjectSelector{{Kind: "User", Name: "bob"}, {Kind: "Group", Name: "dev"}, {Kind: "User", Name: "alice"}, {Kind: "User", Name: "bob"}},
+			want:      []v1.Subject{group("dev"), user("alice"), user("bob")},
+		},
+		{
+			name:      "ServiceAccount by name defaults to the binding's namespace",
+			selectors: []v1alpha1.SubjectSelector{{Kind: "ServiceAccount", Name: "deployer"}, {Kind: "ServiceAccount", Name: "runner", Namespace: "ci"}},
+			namespace: "team-a",
+			want:      []v1.Subject{sa("ci", "runner"), sa("team-a", "deployer")},
+		},
+		{
+			name:      "ServiceAccount by name in the namespaces matching a selector",
+			selectors: []v1alpha1.SubjectSelector{{Kind: "ServiceAccount", Name: "deployer", NamespaceSelector: tenants}},
+			want:      []v1.Subject{sa("team-a", "deployer"), sa("team-b", "deployer")},
+		},
+		{
+			name:      "ServiceAccounts by label selector in the binding's namespace",
+			selectors: []v1alpha1.SubjectSelector{{Kind: "ServiceAccount", LabelSelector: ci}},
+			namespace: "team-a",
+			want:      []v1.Subject{sa("team-a", "deployer")},
+		},
+		{
+			name:      "ServiceAccounts by label selector in the namespaces matching a selector",
+			selectors: []v1alpha1.SubjectSelector{{Kind: "ServiceAccount", LabelSelector: ci, NamespaceSelector: tenants}},
+			namespace: "team-a",
+			want:      []v1.Subject{sa("team-a", "deployer"), sa("team-b", "deployer")},
+		},
+		{
+			name:      "ServiceAccounts by label selector in every namespace",
+			selectors: []v1alpha1.SubjectSelector{{Kind: "ServiceAccount", LabelSelector: ci}},
+			want:      []v1.Subject{sa("ci", "runner"), sa("team-a", "deployer"), sa("team-b", "deployer")},
+		},
+		{name: "ServiceAccount by name without a namespace", selectors: []v1alpha1.SubjectSelector{{Kind: "ServiceAccount", Name: "deployer"}}, wantErr: true},
+		{name: "ServiceAccount by name and label selector", selectors: []v1alpha1.SubjectSelector{{Kind: "ServiceAccount", Name: "deployer", LabelSelector: ci}}, namespace: "team-a", wantErr: true},
+		{name: "ServiceAccount with a namespace and a namespace selector", selectors: []v1alpha1.SubjectSelector{{Kind: "ServiceAccount", LabelSelector: ci, Namespace: "ci", NamespaceSelector: tenants}}, wantErr: true},
+		{name: "user selected by label", selectors: []v1alpha1.SubjectSelector{{Kind: "User", Name: "bob", LabelSelector: ci}}, wantErr: true},
+		{name: "group without a name", selectors: []v1alpha1.SubjectSelector{{Kind: "Group"}}, wantErr: true},
+		{name: "unknown kind", selectors: []v1alpha1.SubjectSelector{{Kind: "Robot", Name: "r2"}}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveSubjects(c, test.selectors, test.namespace)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ResolveSubjects() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ResolveSubjects() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffSubjects(t *testing.T) {
+	alice := v1.Subject{APIGroup: v1.GroupName, Kind: v1.UserKind, Name: "alice"}
+	bob := v1.Subject{APIGroup: v1.GroupName, Kind: v1.UserKind, Name: "bob"}
+	carol := v1.Subject{APIGroup: v1.GroupName, Kind: v1.UserKind, Name: "carol"}
+	if added, removed := DiffSubjects([]v1.Subject{alice, bob}, []v1.Subject{bob, carol}); added != 1 || removed != 1 {
+		t.Errorf("DiffSubjects() = %d, %d, want 1, 1", added, removed)
+	}
+	if !subjectsUnchanged([]v1.Subject{alice, bob}, []v1.Subject{bob, alice}) {
+		t.Errorf("subjectsUnchanged() = false for the same subjects in another order")
+	}
+	if subjectsUnchanged([]v1.Subject{alice, alice}, []v1.Subject{alice}) {
+		t.Errorf("subjectsUnchanged() = true for a duplicated subject removed")
+	}
+}
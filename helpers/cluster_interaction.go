@@ -2,10 +2,16 @@ package helpers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/rbac/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
@@ -13,65 +19,387 @@ import (
 )
 
 // DiscoverClusterResources returns a list of all known resources and groups known to this API server
+// When only some API groups cannot be discovered, e.g. because the aggregated API serving them is down, the resources of the
+// other groups are returned together with a *discovery.ErrGroupDiscoveryFailed naming the failed ones
 func DiscoverClusterResources(config *rest.Config) (apiGroupList []*metav1.APIGroup, apiResourceList []*metav1.APIResourceList, err error) {
-	if err != nil {
-		return nil, nil, err
-	}
 	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
 	if err != nil {
 		return nil, nil, err
 	}
 	groups, resources, err := discoveryClient.ServerGroupsAndResources()
-	if err != nil {
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
 		return nil, nil, err
 	}
-	return groups, resources, nil
+	return groups, resources, err
+}
+
+// DiscoverPolicyRules returns one expanded rule for every API group and resource served by the cluster, with the verbs it supports
+// API groups that could not be discovered are returned separately instead of failing the whole discovery
+func DiscoverPolicyRules(config *rest.Config) ([]v1.PolicyRule, []string, error) {
+	_, apiResourceList, err := DiscoverClusterResources(config)
+	failedGroups := []string{}
+	if err != nil {
+		groupDiscoveryFailed, ok := err.(*discovery.ErrGroupDiscoveryFailed)
+		if !ok {
+			return nil, nil, err
+		}
+		for groupVersion := range groupDiscoveryFailed.Groups {
+			failedGroups = appendSet(failedGroups, groupVersion.Group)
+		}
+		sort.Strings(failedGroups)
+	}
+	return APIResourcesToExpandedRules(apiResourceList), failedGroups, nil
+}
+
+// GeneratedRoleRules returns the rules of the Role currently generated from a DynamicRole, or no rules if it has not been generated yet
+func GeneratedRoleRules(c client.Client, dynamicRole *v1alpha1.DynamicRole) ([]v1.PolicyRule, error) {
+	found := &v1.Role{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: dynamicRole.Name, Namespace: dynamicRole.Namespace}, found)
+	if apierrors.IsNotFound(err) {
+		return []v1.PolicyRule{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return found.Rules, nil
+}
+
+// GeneratedClusterRoleRules returns the rules of the ClusterRole currently generated from a DynamicClusterRole, or no rules if it has not been generated yet
+// A DynamicClusterRole with a namespaceSelector stamps the same rules into every selected namespace, so the Role in the first of them is used instead
+func GeneratedClusterRoleRules(c client.Client, dynamicClusterRole *v1alpha1.DynamicClusterRole) ([]v1.PolicyRule, error) {
+	if dynamicClusterRole.Spec.NamespaceSelector != nil {
+		if len(dynamicClusterRole.Status.Namespaces) == 0 {
+			return []v1.PolicyRule{}, nil
+		}
+		found := &v1.Role{}
+		err := c.Get(context.TODO(), types.NamespacedName{Name: dynamicClusterRole.Name, Namespace: dynamicClusterRole.Status.Namespaces[0]}, found)
+		if apierrors.IsNotFound(err) {
+			return []v1.PolicyRule{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return found.Rules, nil
+	}
+	found := &v1.ClusterRole{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: dynamicClusterRole.Name}, found)
+	if apierrors.IsNotFound(err) {
+		return []v1.PolicyRule{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return found.Rules, nil
+}
+
+// NotControlledError is returned instead of writing over an object of the generated name that the dynamic resource does not control
+type NotControlledError struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (e *NotControlledError) Error() string {
+	if e.Namespace == "" {
+		return fmt.Sprintf("%s %s already exists and is not controlled by this dynamic resource", e.Kind, e.Name)
+	}
+	return fmt.Sprintf("%s %s/%s already exists and is not controlled by this dynamic resource", e.Kind, e.Namespace, e.Name)
+}
+
+// IsNotControlled returns true if the error was caused by an existing object of the generated name that the dynamic resource does not control
+func IsNotControlled(err error) bool {
+	_, ok := err.(*NotControlledError)
+	return ok
+}
+
+// controlledBySameOwner returns true if the object found in the cluster is controlled by the owner set as controller of the generated object
+func controlledBySameOwner(found metav1.Object, generated metav1.Object) bool {
+	owner := metav1.GetControllerOf(generated)
+	if owner == nil {
+		return true
+	}
+	controller := metav1.GetControllerOf(found)
+	return controller != nil && controller.UID == owner.UID
 }
 
 // CreateOrUpdateRole ensures that a role exists in the specified state in the cluster, whether it has to be created or updated to ensure that
-func CreateOrUpdateRole(role *v1.Role, c client.Client) (err error) {
+// The rules of the role before the update are returned, and existed is false when the role had to be created
+// The role is annotated with a hash of its rules, and drifted is true when the rules found had been changed outside of the operator,
+// or when the role had been deleted although expected, because the operator had written it before
+// The role is not written when it already holds the same rules, in any order, and carries the same labels and annotations
+// A role of the same name that is not controlled by the owner of the generated role is left untouched and a *NotControlledError is returned
+func CreateOrUpdateRole(role *v1.Role, expected bool, c client.Client) (previousRules []v1.PolicyRule, existed bool, drifted bool, err error) {
+	setRulesHash(&role.ObjectMeta, role.Rules)
 	found := &v1.Role{}
 	err = c.Get(context.TODO(), types.NamespacedName{Name: role.Name, Namespace: role.Namespace}, found)
 
-	if found != nil && errors.IsNotFound(err) {
+	if found != nil && apierrors.IsNotFound(err) {
 		err = c.Create(context.TODO(), role)
 		if err != nil {
-			return err
+			return nil, false, false, err
 		}
-		return nil
+		return nil, false, expected, nil
 	} else if err != nil {
-		return err
+		return nil, false, false, err
+	}
+	if !controlledBySameOwner(found, role) {
+		return nil, true, false, &NotControlledError{Kind: "Role", Namespace: found.Namespace, Name: found.Name}
 	}
 
+	previousRules = found.Rules
+	unchanged := rulesUnchanged(found.Rules, role.Rules)
+	// Rules changed outside of the operator only need restoring if they differ from the ones about to be written
+	drifted = !unchanged && rulesDrifted(found.ObjectMeta, found.Rules)
+	metadataChanged := mergeMetadata(&found.ObjectMeta, role.ObjectMeta)
+	if !metadataChanged && unchanged {
+		// Nothing to write, even if the rules are listed in a different order
+		return previousRules, true, drifted, nil
+	}
 	found.Rules = role.Rules
 	err = c.Update(context.TODO(), found)
 	if err != nil {
-		return err
+		return previousRules, true, drifted, err
 	}
 
-	return nil
+	return previousRules, true, drifted, nil
 }
 
 // CreateOrUpdateClusterRole ensures that a clusterrole exists in the specified state in the cluster, whether it has to be created or updated to ensure that
-func CreateOrUpdateClusterRole(role *v1.ClusterRole, c client.Client) (err error) {
+// The rules of the clusterrole before the update are returned, and existed is false when the clusterrole had to be created
+// The clusterrole is annotated with a hash of its rules, and drifted is true when the rules found had been changed outside of the operator,
+// or when the clusterrole had been deleted although expected, because the operator had written it before
+// The clusterrole is not written when it already holds the same rules, in any order, and carries the same labels and annotations
+// A clusterrole of the same name that is not controlled by the owner of the generated clusterrole is left untouched and a *NotControlledError is returned
+func CreateOrUpdateClusterRole(role *v1.ClusterRole, expected bool, c client.Client) (previousRules []v1.PolicyRule, existed bool, drifted bool, err error) {
+	setRulesHash(&role.ObjectMeta, role.Rules)
 	found := &v1.ClusterRole{}
 	err = c.Get(context.TODO(), types.NamespacedName{Name: role.Name}, found)
 
-	if found != nil && errors.IsNotFound(err) {
+	if found != nil && apierrors.IsNotFound(err) {
 		err = c.Create(context.TODO(), role)
 		if err != nil {
-			return err
+			return nil, false, false, err
 		}
-		return nil
+		return nil, false, expected, nil
 	} else if err != nil {
-		return err
+		return nil, false, false, err
+	}
+	if !controlledBySameOwner(found, role) {
+		return nil, true, false, &NotControlledError{Kind: "ClusterRole", Name: found.Name}
 	}
 
+	previousRules = found.Rules
+	unchanged := rulesUnchanged(found.Rules, role.Rules)
+	// Rules changed outside of the operator only need restoring if they differ from the ones about to be written
+	drifted = !unchanged && rulesDrifted(found.ObjectMeta, found.Rules)
+	metadataChanged := mergeMetadata(&found.ObjectMeta, role.ObjectMeta)
+	if !metadataChanged && unchanged {
+		// Nothing to write, even if the rules are listed in a different order
+		return previousRules, true, drifted, nil
+	}
 	found.Rules = role.Rules
 	err = c.Update(context.TODO(), found)
 	if err != nil {
-		return err
+		return previousRules, true, drifted, err
+	}
+
+	return previousRules, true, drifted, nil
+}
+
+// CreateOrUpdateRoleBinding ensures that a rolebinding exists in the specified state in the cluster, whether it has to be created or updated to ensure that
+// The subjects of the rolebinding before the update are returned, and existed is false when the rolebinding had to be created
+// The roleRef of a binding is immutable, so a binding that refers to a different role is deleted and created again
+// The rolebinding is not written when it already refers to the same role with the same subjects, in any order, and carries the same labels and annotations
+// A rolebinding of the same name that is not controlled by the owner of the generated rolebinding is left untouched and a *NotControlledError is returned
+func CreateOrUpdateRoleBinding(binding *v1.RoleBinding, c client.Client) (previousSubjects []v1.Subject, existed bool, err error) {
+	found := &v1.RoleBinding{}
+	err = c.Get(context.TODO(), types.NamespacedName{Name: binding.Name, Namespace: binding.Namespace}, found)
+
+	if found != nil && apierrors.IsNotFound(err) {
+		err = c.Create(context.TODO(), binding)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if !controlledBySameOwner(found, binding) {
+		return nil, true, &NotControlledError{Kind: "RoleBinding", Namespace: found.Namespace, Name: found.Name}
+	}
+
+	previousSubjects = found.Subjects
+	if found.RoleRef != binding.RoleRef {
+		err = c.Delete(context.TODO(), found)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return previousSubjects, true, err
+		}
+		err = c.Create(context.TODO(), binding)
+		return previousSubjects, true, err
+	}
+	metadataChanged := mergeMetadata(&found.ObjectMeta, binding.ObjectMeta)
+	if !metadataChanged && subjectsUnchanged(found.Subjects, binding.Subjects) {
+		return previousSubjects, true, nil
+	}
+	found.Subjects = binding.Subjects
+	err = c.Update(context.TODO(), found)
+	if err != nil {
+		return previousSubjects, true, err
+	}
+
+	return previousSubjects, true, nil
+}
+
+// CreateOrUpdateClusterRoleBinding ensures that a clusterrolebinding exists in the specified state in the cluster, whether it has to be created or updated to ensure that
+// The subjects of the clusterrolebinding before the update are returned, and existed is false when the clusterrolebinding had to be created
+// The roleRef of a binding is immutable, so a binding that refers to a different role is deleted and created again
+// The clusterrolebinding is not written when it already refers to the same role with the same subjects, in any order, and carries the same labels and annotations
+// A clusterrolebinding of the same name that is not controlled by the owner of the generated clusterrolebinding is left untouched and a *NotControlledError is returned
+func CreateOrUpdateClusterRoleBinding(binding *v1.ClusterRoleBinding, c client.Client) (previousSubjects []v1.Subject, existed bool, err error) {
+	found := &v1.ClusterRoleBinding{}
+	err = c.Get(context.TODO(), types.NamespacedName{Name: binding.Name}, found)
+
+	if found != nil && apierrors.IsNotFound(err) {
+		err = c.Create(context.TODO(), binding)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if !controlledBySameOwner(found, binding) {
+		return nil, true, &NotControlledError{Kind: "ClusterRoleBinding", Name: found.Name}
+	}
+
+	previousSubjects = found.Subjects
+	if found.RoleRef != binding.RoleRef {
+		err = c.Delete(context.TODO(), found)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return previousSubjects, true, err
+		}
+		err = c.Create(context.TODO(), binding)
+		return previousSubjects, true, err
+	}
+	metadataChanged := mergeMetadata(&found.ObjectMeta, binding.ObjectMeta)
+	if !metadataChanged && subjectsUnchanged(found.Subjects, binding.Subjects) {
+		return previousSubjects, true, nil
+	}
+	found.Subjects = binding.Subjects
+	err = c.Update(context.TODO(), found)
+	if err != nil {
+		return previousSubjects, true, err
+	}
+
+	return previousSubjects, true, nil
+}
+
+// ResolveInheritedClusterRoles returns the ClusterRoles referenced by an inherit entry, either by name or by label selector
+// Names and label selectors are recorded in dependencies so that ClusterRoles created later with that name or matching labels trigger recomputation
+func ResolveInheritedClusterRoles(c client.Client, dependencies *Dependencies, roleToInherit v1alpha1.InheritedRole) ([]v1.ClusterRole, error) {
+	if roleToInherit.LabelSelector == nil {
+		if roleToInherit.Name == "" {
+			return nil, errors.New("an inherited Cluster Role must specify either a name or a label selector")
+		}
+		dependencies.ClusterRoles[roleToInherit.Name] = true
+		inheritedClusterRole := &v1.ClusterRole{}
+		err := c.Get(context.TODO(), types.NamespacedName{Name: roleToInherit.Name}, inheritedClusterRole)
+		if err != nil {
+			return nil, err
+		}
+		return []v1.ClusterRole{*inheritedClusterRole}, nil
+	}
+	if roleToInherit.Name != "" {
+		return nil, errors.New("an inherited Cluster Role cannot specify both a name and a label selector")
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(roleToInherit.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	dependencies.ClusterRoleSelectors[selector.String()] = selector
+	clusterRoleList := &v1.ClusterRoleList{}
+	err = c.List(context.TODO(), clusterRoleList, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(clusterRoleList.Items, func(i, j int) bool {
+		return clusterRoleList.Items[i].Name < clusterRoleList.Items[j].Name
+	})
+	return clusterRoleList.Items, nil
+}
+
+// ResolveInheritedRoles returns the Roles referenced by an inherit entry, either by name or by label selector
+// Roles are looked up in the entry's namespace, the namespaces matching its namespace selector, or forNamespace if neither is set
+// Names and label selectors are recorded in dependencies so that Roles created later with that name or matching labels trigger recomputation
+func ResolveInheritedRoles(c client.Client, dependencies *Dependencies, roleToInherit v1alpha1.InheritedRole, forNamespace string) ([]v1.Role, error) {
+	useNamespace := forNamespace
+	if roleToInherit.Namespace != "" {
+		useNamespace = roleToInherit.Namespace
+	}
+
+	if roleToInherit.LabelSelector == nil {
+		if roleToInherit.Name == "" {
+			return nil, errors.New("an inherited Role must specify either a name or a label selector")
+		}
+		if roleToInherit.NamespaceSelector != nil {
+			return nil, errors.New("an inherited Role can only use a namespace selector together with a label selector")
+		}
+		roleName := types.NamespacedName{Name: roleToInherit.Name, Namespace: useNamespace}
+		dependencies.Roles[roleName] = true
+		inheritedRole := &v1.Role{}
+		err := c.Get(context.TODO(), roleName, inheritedRole)
+		if err != nil {
+			return nil, err
+		}
+		return []v1.Role{*inheritedRole}, nil
+	}
+	if roleToInherit.Name != "" {
+		return nil, errors.New("an inherited Role cannot specify both a name and a label selector")
 	}
 
-	return nil
+	selector, err := metav1.LabelSelectorAsSelector(roleToInherit.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	roleSelector := RoleSelector{Selector: selector, Namespace: useNamespace}
+	namespaces := []string{useNamespace}
+	if roleToInherit.NamespaceSelector != nil {
+		namespaceSelector, err := metav1.LabelSelectorAsSelector(roleToInherit.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		roleSelector = RoleSelector{Selector: selector, NamespaceSelector: namespaceSelector}
+		namespaces, err = ListNamespacesForSelector(c, namespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dependencies.RoleSelectors[roleSelector.Key()] = roleSelector
+
+	roles := []v1.Role{}
+	for _, namespace := range namespaces {
+		roleList := &v1.RoleList{}
+		err = c.List(context.TODO(), roleList, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(roleList.Items, func(i, j int) bool {
+			return roleList.Items[i].Name < roleList.Items[j].Name
+		})
+		roles = append(roles, roleList.Items...)
+	}
+	return roles, nil
+}
+
+// ListNamespacesForSelector returns the sorted names of all namespaces whose labels match a selector
+func ListNamespacesForSelector(c client.Client, selector labels.Selector) ([]string, error) {
+	namespaceList := &corev1.NamespaceList{}
+	err := c.List(context.TODO(), namespaceList, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	namespaces := []string{}
+	for _, namespace := range namespaceList.Items {
+		namespaces = append(namespaces, namespace.Name)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
 }
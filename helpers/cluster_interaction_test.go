@@ -0,0 +1,270 @@
+package helpers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCreateOrUpdateRoleBindingSkipsUnchangedWrites(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	alice := v1.Subject{APIGroup: v1.GroupName, Kind: v1.UserKind, Name: "alice"}
+	bob := v1.Subject{APIGroup: v1.GroupName, Kind: v1.UserKind, Name: "bob"}
+	roleRef := v1.RoleRef{APIGroup: v1.GroupName, Kind: "Role", Name: "developer"}
+	binding := func(subjects ...v1.Subject) *v1.RoleBinding {
+		return &v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "developer", Namespace: "team-a"}, RoleRef: roleRef, Subjects: subjects}
+	}
+	c := fake.NewFakeClientWithScheme(scheme, binding(alice, bob))
+	resourceVersion := func() string {
+		found := &v1.RoleBinding{}
+		if err := c.Get(context.TODO(), types.NamespacedName{Name: "developer", Namespace: "team-a"}, found); err != nil {
+			t.Fatal(err)
+		}
+		return found.ResourceVersion
+	}
+
+	before := resourceVersion()
+	if _, existed, err := CreateOrUpdateRoleBinding(binding(bob, alice), c); err != nil || !existed {
+		t.Fatalf("CreateOrUpdateRoleBinding() = %v, %v", existed, err)
+	}
+	if after := resourceVersion(); after != before {
+		t.Errorf("the same subjects in another order were written, resourceVersion %s -> %s", before, after)
+	}
+
+	previousSubjects, _, err := CreateOrUpdateRoleBinding(binding(alice), c)
+	if err != nil {
+		t.Fatalf("CreateOrUpdateRoleBinding() error = %v", err)
+	}
+	if len(previousSubjects) != 2 {
+		t.Errorf("previous subjects = %v, want alice and bob", previousSubjects)
+	}
+	if after := resourceVersion(); after == before {
+		t.Errorf("a removed subject was not written")
+	}
+}
+
+func TestCreateOrUpdateClusterRoleBindingSkipsUnchangedWrites(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	subjects := []v1.Subject{{Kind: v1.ServiceAccountKind, Name: "builder", Namespace: "ci"}}
+	binding := &v1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "builder"},
+		RoleRef:    v1.RoleRef{APIGroup: v1.GroupName, Kind: "ClusterRole", Name: "builder"},
+		Subjects:   subjects,
+	}
+	c := fake.NewFakeClientWithScheme(scheme, binding.DeepCopy())
+	found := &v1.ClusterRoleBinding{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: "builder"}, found); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := CreateOrUpdateClusterRoleBinding(binding.DeepCopy(), c); err != nil {
+		t.Fatalf("CreateOrUpdateClusterRoleBinding() error = %v", err)
+	}
+	after := &v1.ClusterRoleBinding{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: "builder"}, after); err != nil {
+		t.Fatal(err)
+	}
+	if after.ResourceVersion != found.ResourceVersion {
+		t.Errorf("an unchanged clusterrolebinding was written, resourceVersion %s -> %s", found.ResourceVersion, after.ResourceVersion)
+	}
+}
+
+func TestResolveInheritedClusterRoles(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	clusterRole := func(name string, team string) *v1.ClusterRole {
+		return &v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"team": team}}}
+	}
+	c := fake.NewFakeClientWithScheme(scheme, clusterRole("payments-view", "payments"), clusterRole("payments-edit", "payments"), clusterRole("orders-view", "orders"))
+
+	tests := []struct {
+		name         string
+		inherit      v1alpha1.InheritedRole
+		want         []string
+		wantSelector string
+		wantErr      bool
+	}{
+		{name: "by name", inherit: v1alpha1.InheritedRole{Kind: "ClusterRole", Name: "orders-view"}, want: []string{"orders-view"}},
+		{name: "by name, not found", inherit: v1alpha1.InheritedRole{Kind: "ClusterRole", Name: "missing"}, wantErr: true},
+		{
+			name:         "by label selector, sorted by name",
+			inherit:      v1alpha1.InheritedRole{Kind: "ClusterRole", LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}},
+			want:         []string{"payments-edit", "payments-view"},
+			wantSelector: "team=payments",
+		},
+		{
+			name:         "by label selector matching nothing yet",
+			inherit:      v1alpha1.InheritedRole{Kind: "ClusterRole", LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "billing"}}},
+			want:         []string{},
+			wantSelector: "team=billing",
+		},
+		{
+			name: "by set-based label selector",
+			inherit: v1alpha1.InheritedRole{Kind: "ClusterRole", LabelSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "team", Operator: metav1.LabelSelectorOpIn, Values: []string{"orders", "billing"}},
+			}}},
+			want:         []string{"orders-view"},
+			wantSelector: "team in (billing,orders)",
+		},
+		{
+			name:    "both name and label selector",
+			inherit: v1alpha1.InheritedRole{Kind: "ClusterRole", Name: "orders-view", LabelSelector: &metav1.LabelSelector{}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dependencies := NewDependencies()
+			clusterRoles, err := ResolveInheritedClusterRoles(c, dependencies, test.inherit)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ResolveInheritedClusterRoles() error = %v, wantErr %v", err, test.wantErr)
+			}
+			names := []string{}
+			for _, clusterRole := range clusterRoles {
+				names = append(names, clusterRole.Name)
+			}
+			if !test.wantErr && !reflect.DeepEqual(names, test.want) {
+				t.Errorf("ResolveInheritedClusterRoles() = %q, want %q", names, test.want)
+			}
+			if test.wantSelector != "" {
+				if _, ok := dependencies.ClusterRoleSelectors[test.wantSelector]; !ok {
+					t.Errorf("selector %q was not recorded in the dependencies %v", test.wantSelector, dependencies.ClusterRoleSelectors)
+				}
+			} else if test.inherit.LabelSelector == nil && !dependencies.ClusterRoles[test.inherit.Name] {
+				t.Errorf("ClusterRole %q was not recorded in the dependencies, even when missing", test.inherit.Name)
+			}
+		})
+	}
+}
+
+func TestResolveInheritedRoles(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	namespace := func(name string, tenant string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"tenant": tenant}}}
+	}
+	role := func(namespace string, name string, team string) *v1.Role {
+		return &v1.Role{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"team": team}}}
+	}
+	c := fake.NewFakeClientWithScheme(scheme,
+		namespace("team-a", "yes"), namespace("team-b", "yes"), namespace("other", "no"),
+		role("team-a", "view", "payments"), role("team-a", "edit", "payments"), role("team-a", "admin", "orders"),
+		role("team-b", "view", "payments"), role("other", "view", "payments"),
+	)
+	payments := &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}
+	tenants := &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "yes"}}
+
+	tests := []struct {
+		name         string
+		inherit      v1alpha1.InheritedRole
+		want         []string
+		wantSelector string
+		wantErr      bool
+	}{
+		{name: "by name in the namespace of the dynamic role", inherit: v1alpha1.InheritedRole{Kind: "Role", Name: "admin"}, want: []string{"team-a/admin"}},
+		{name: "by name in another namespace", inherit: v1alpha1.InheritedRole{Kind: "Role", Name: "view", Namespace: "other"}, want: []string{"other/view"}},
+		{
+			name:         "by label selector in the namespace of the dynamic role",
+			inherit:      v1alpha1.InheritedRole{Kind: "Role", LabelSelector: payments},
+			want:         []string{"team-a/edit", "team-a/view"},
+			wantSelector: "team=payments|namespace:team-a",
+		},
+		{
+			name:         "by label selector in the namespaces matching a selector",
+			inherit:      v1alpha1.InheritedRole{Kind: "Role", LabelSelector: payments, NamespaceSelector: tenants},
+			want:         []string{"team-a/edit", "team-a/view", "team-b/view"},
+			wantSelector: "team=payments|namespaces:tenant=yes",
+		},
+		{name: "namespace selector without a label selector", inherit: v1alpha1.InheritedRole{Kind: "Role", Name: "view", NamespaceSelector: tenants}, wantErr: true},
+		{name: "neither name nor label selector", inherit: v1alpha1.InheritedRole{Kind: "Role"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dependencies := NewDependencies()
+			roles, err := ResolveInheritedRoles(c, dependencies, test.inherit, "team-a")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ResolveInheritedRoles() error = %v, wantErr %v", err, test.wantErr)
+			}
+			names := []string{}
+			for _, role := range roles {
+				names = append(names, role.Namespace+"/"+role.Name)
+			}
+			if !test.wantErr && !reflect.DeepEqual(names, test.want) {
+				t.Errorf("ResolveInheritedRoles() = %q, want %q", names, test.want)
+			}
+			if _, ok := dependencies.RoleSelectors[test.wantSelector]; test.wantSelector != "" && !ok {
+				t.Errorf("selector %q was not recorded in the dependencies %v", test.wantSelector, dependencies.RoleSelectors)
+			}
+		})
+	}
+}
+
+func TestCreateOrUpdateRoleReportsDrift(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	computed := []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}}
+	edited := []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "delete"}}}
+	written := metav1.ObjectMeta{Name: "developer", Namespace: "team-a"}
+	setRulesHash(&written, computed)
+
+	tests := []struct {
+		name        string
+		found       *v1.Role
+		wantDrifted bool
+	}{
+		{
+			name:  "rules as written",
+			found: &v1.Role{ObjectMeta: *written.DeepCopy(), Rules: computed},
+		},
+		{
+			name:        "rules changed outside of the operator",
+			found:       &v1.Role{ObjectMeta: *written.DeepCopy(), Rules: edited},
+			wantDrifted: true,
+		},
+		{
+			name:  "annotation missing",
+			found: &v1.Role{ObjectMeta: metav1.ObjectMeta{Name: "developer", Namespace: "team-a"}, Rules: edited},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := fake.NewFakeClientWithScheme(scheme, test.found)
+			role := &v1.Role{ObjectMeta: metav1.ObjectMeta{Name: "developer", Namespace: "team-a"}, Rules: computed}
+			_, _, drifted, err := CreateOrUpdateRole(role, true, c)
+			if err != nil {
+				t.Fatalf("CreateOrUpdateRole() error = %v", err)
+			}
+			if drifted != test.wantDrifted {
+				t.Errorf("CreateOrUpdateRole() drifted = %v, want %v", drifted, test.wantDrifted)
+			}
+			found := &v1.Role{}
+			if err := c.Get(context.TODO(), types.NamespacedName{Name: "developer", Namespace: "team-a"}, found); err != nil {
+				t.Fatal(err)
+			}
+			if !rulesUnchanged(found.Rules, computed) || rulesDrifted(found.ObjectMeta, found.Rules) {
+				t.Errorf("the role holds %v with annotations %v, want the computed rules and their hash", found.Rules, found.Annotations)
+			}
+		})
+	}
+}
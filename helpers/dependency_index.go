@@ -0,0 +1,398 @@
+package helpers
+
+import (
+	"sort"
+	"sync"
+
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Dependant identifies a DynamicRole or DynamicClusterRole whose computed rules depend on other objects
+type Dependant struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// Dependencies collects everything a dynamic role's rules were computed from while BuildPolicyRules runs
+type Dependencies struct {
+	Roles                map[types.NamespacedName]bool
+	ClusterRoles         map[string]bool
+	RoleSelectors        map[string]RoleSelector
+	ClusterRoleSelectors map[string]labels.Selector
+	DynamicRoles         map[types.NamespacedName]bool
+	DynamicClusterRoles  map[string]bool
+	// APIGroupPatterns are the apiGroups of every rule that was resolved against the cluster's discovery information
+	APIGroupPatterns map[string]bool
+	// NarrowedNonResourceURLs are the granted nonResourceURL patterns that a deny rule only partly covered, which were narrowed down to the well-known nonResourceURLs
+	NarrowedNonResourceURLs map[string]bool
+}
+
+// NewDependencies returns an empty set of dependencies
+func NewDependencies() *Dependencies {
+	return &Dependencies{
+		Roles:                   map[types.NamespacedName]bool{},
+		ClusterRoles:            map[string]bool{},
+		RoleSelectors:           map[string]RoleSelector{},
+		ClusterRoleSelectors:    map[string]labels.Selector{},
+		DynamicRoles:            map[types.NamespacedName]bool{},
+		DynamicClusterRoles:     map[string]bool{},
+		APIGroupPatterns:        map[string]bool{},
+		NarrowedNonResourceURLs: map[string]bool{},
+	}
+}
+
+// addRuleGroups records the apiGroups of rules that are resolved against discovery, so that API groups appearing or disappearing trigger recomputation
+func (d *Dependencies) addRuleGroups(rules []v1.PolicyRule) {
+	for _, rule := range rules {
+		for _, group := range rule.APIGroups {
+			d.APIGroupPatterns[group] = true
+		}
+	}
+}
+
+// addNarrowedNonResourceURLs records the nonResourceURL patterns that a deny rule narrowed down, see func `narrowNonResourceURL`
+func (d *Dependencies) addNarrowedNonResourceURLs(patterns []string) {
+	for _, pattern := range patterns {
+		d.NarrowedNonResourceURLs[pattern] = true
+	}
+}
+
+// NarrowedURLs returns the sorted nonResourceURL patterns that a deny rule narrowed down to the well-known nonResourceURLs,
+// including those of the dynamic roles inherited from, which no longer grant any other URL they matched
+func (d *Dependencies) NarrowedURLs() []string {
+	patterns := []string{}
+	for pattern := range d.NarrowedNonResourceURLs {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// StaleAPIGroups returns the stale API groups of a discovery snapshot that the rules of a dynamic role refer to
+func (d *Dependencies) StaleAPIGroups(discovery *DiscoverySnapshot) []string {
+	patterns := []string{}
+	for pattern := range d.APIGroupPatterns {
+		patterns = append(patterns, pattern)
+	}
+	stale := []string{}
+	for _, group := range discovery.StaleGroups {
+		if groupMatchesAnyPattern(patterns, group) {
+			stale = append(stale, group)
+		}
+	}
+	return stale
+}
+
+// DependencyIndex maps the objects that dynamic roles are computed from back to the dynamic roles that depend on them,
+// so that a change only recomputes the affected dynamic roles. It is safe for concurrent use.
+type DependencyIndex struct {
+	lock                sync.RWMutex
+	dependencies        map[Dependant]*Dependencies
+	roles               map[string]map[Dependant]bool
+	clusterRoles        map[string]map[Dependant]bool
+	dynamicRoles        map[string]map[Dependant]bool
+	dynamicClusterRoles map[string]map[Dependant]bool
+}
+
+// NewDependencyIndex returns an empty dependency index
+func NewDependencyIndex() *DependencyIndex {
+	return &DependencyIndex{
+		dependencies:        map[Dependant]*Dependencies{},
+		roles:               map[string]map[Dependant]bool{},
+		clusterRoles:        map[string]map[Dependant]bool{},
+		dynamicRoles:        map[string]map[Dependant]bool{},
+		dynamicClusterRoles: map[string]map[Dependant]bool{},
+	}
+}
+
+// Set replaces the recorded dependencies of a dynamic role with the ones collected by its most recent computation
+func (i *DependencyIndex) Set(dependant Dependant, dependencies *Dependencies) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.remove(dependant)
+	i.dependencies[dependant] = dependencies
+	for name := range dependencies.Roles {
+		addDependant(i.roles, name.String(), dependant)
+	}
+	for name := range dependencies.ClusterRoles {
+		addDependant(i.clusterRoles, name, dependant)
+	}
+	for name := range dependencies.DynamicRoles {
+		addDependant(i.dynamicRoles, name.String(), dependant)
+	}
+	for name := range dependencies.DynamicClusterRoles {
+		addDependant(i.dynamicClusterRoles, name, dependant)
+	}
+}
+
+// Remove forgets the dependencies of a dynamic role that has been deleted
+func (i *DependencyIndex) Remove(dependant Dependant) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.remove(dependant)
+}
+
+func (i *DependencyIndex) remove(dependant Dependant) {
+	previous, ok := i.dependencies[dependant]
+	if !ok {
+		return
+	}
+	for name := range previous.Roles {
+		removeDependant(i.roles, name.String(), dependant)
+	}
+	for name := range previous.ClusterRoles {
+		removeDependant(i.clusterRoles, name, dependant)
+	}
+	for name := range previous.DynamicRoles {
+		removeDependant(i.dynamicRoles, name.String(), dependant)
+	}
+	for name := range previous.DynamicClusterRoles {
+		removeDependant(i.dynamicClusterRoles, name, dependant)
+	}
+	delete(i.dependencies, dependant)
+}
+
+// Count returns the number of dynamic roles of a kind whose dependencies are recorded
+func (i *DependencyIndex) Count(kind string) int {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	count := 0
+	for dependant := range i.dependencies {
+		if dependant.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// Dependants returns every dynamic role whose dependencies are recorded
+func (i *DependencyIndex) Dependants() []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	dependants := map[Dependant]bool{}
+	for dependant := range i.dependencies {
+		dependants[dependant] = true
+	}
+	return sortedDependants(dependants)
+}
+
+// DependantsOfRole returns the dynamic roles that inherit from a Role by name
+func (i *DependencyIndex) DependantsOfRole(name types.NamespacedName) []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return sortedDependants(i.roles[name.String()])
+}
+
+// DependantsOfClusterRole returns the dynamic roles that inherit from a ClusterRole by name
+func (i *DependencyIndex) DependantsOfClusterRole(name string) []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return sortedDependants(i.clusterRoles[name])
+}
+
+// DependantsOfDynamicRole returns the dynamic roles that inherit from a DynamicRole, directly or through other dynamic roles
+func (i *DependencyIndex) DependantsOfDynamicRole(name types.NamespacedName) []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return sortedDependants(i.dynamicRoles[name.String()])
+}
+
+// DependantsOfDynamicClusterRole returns the dynamic roles that inherit from a DynamicClusterRole, directly or through other dynamic roles
+func (i *DependencyIndex) DependantsOfDynamicClusterRole(name string) []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return sortedDependants(i.dynamicClusterRoles[name])
+}
+
+// DependantsOfRoleLabels returns the dynamic roles with a label selector matching a Role with the given labels in the given namespace
+// The namespace's labels are only looked up if a namespace selector needs them
+func (i *DependencyIndex) DependantsOfRoleLabels(namespace string, roleLabels labels.Set, namespaceLabels func() labels.Set) []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	var resolvedNamespaceLabels labels.Set
+	namespaceLabelsResolved := false
+	dependants := map[Dependant]bool{}
+	for dependant, dependencies := range i.dependencies {
+		for _, roleSelector := range dependencies.RoleSelectors {
+			if !roleSelector.Selector.Matches(roleLabels) {
+				continue
+			}
+			if roleSelector.NamespaceSelector == nil {
+				if roleSelector.Namespace == namespace {
+					dependants[dependant] = true
+				}
+				continue
+			}
+			if !namespaceLabelsResolved {
+				resolvedNamespaceLabels = namespaceLabels()
+				namespaceLabelsResolved = true
+			}
+			if roleSelector.NamespaceSelector.Matches(resolvedNamespaceLabels) {
+				dependants[dependant] = true
+			}
+		}
+	}
+	return sortedDependants(dependants)
+}
+
+// DependantsOfDeletedRole returns the dynamic roles with a label selector that may have matched a Role deleted from the given namespace
+func (i *DependencyIndex) DependantsOfDeletedRole(namespace string) []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	dependants := map[Dependant]bool{}
+	for dependant, dependencies := range i.dependencies {
+		for _, roleSelector := range dependencies.RoleSelectors {
+			if roleSelector.NamespaceSelector != nil || roleSelector.Namespace == namespace {
+				dependants[dependant] = true
+			}
+		}
+	}
+	return sortedDependants(dependants)
+}
+
+// DependantsOfClusterRoleLabels returns the dynamic roles with a label selector matching a ClusterRole with the given labels
+func (i *DependencyIndex) DependantsOfClusterRoleLabels(clusterRoleLabels labels.Set) []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	dependants := map[Dependant]bool{}
+	for dependant, dependencies := range i.dependencies {
+		for _, selector := range dependencies.ClusterRoleSelectors {
+			if selector.Matches(clusterRoleLabels) {
+				dependants[dependant] = true
+			}
+		}
+	}
+	return sortedDependants(dependants)
+}
+
+// DependantsOfDeletedClusterRole returns the dynamic roles with a label selector that may have matched a deleted ClusterRole
+func (i *DependencyIndex) DependantsOfDeletedClusterRole() []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	dependants := map[Dependant]bool{}
+	for dependant, dependencies := range i.dependencies {
+		if len(dependencies.ClusterRoleSelectors) > 0 {
+			dependants[dependant] = true
+		}
+	}
+	return sortedDependants(dependants)
+}
+
+// DependantsOfAPIGroups returns the dynamic roles with a rule whose apiGroups match any of the given API groups
+func (i *DependencyIndex) DependantsOfAPIGroups(groups []string) []Dependant {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	dependants := map[Dependant]bool{}
+	for dependant, dependencies := range i.dependencies {
+		patterns := []string{}
+		for pattern := range dependencies.APIGroupPatterns {
+			patterns = append(patterns, pattern)
+		}
+		for _, group := range groups {
+			if groupMatchesAnyPattern(patterns, group) {
+				dependants[dependant] = true
+				break
+			}
+		}
+	}
+	return sortedDependants(dependants)
+}
+
+func addDependant(index map[string]map[Dependant]bool, key string, dependant Dependant) {
+	if index[key] == nil {
+		index[key] = map[Dependant]bool{}
+	}
+	index[key][dependant] = true
+}
+
+func removeDependant(index map[string]map[Dependant]bool, key string, dependant Dependant) {
+	delete(index[key], dependant)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+func sortedDependants(set map[Dependant]bool) []Dependant {
+	dependants := []Dependant{}
+	for dependant := range set {
+		dependants = append(dependants, dependant)
+	}
+	sort.Slice(dependants, func(i, j int) bool {
+		if dependants[i].Kind != dependants[j].Kind {
+			return dependants[i].Kind < dependants[j].Kind
+		}
+		if dependants[i].Namespace != dependants[j].Namespace {
+			return dependants[i].Namespace < dependants[j].Namespace
+		}
+		return dependants[i].Name < dependants[j].Name
+	})
+	return dependants
+}
+
+// ChangedStaleGroups returns the API groups that became stale, or were discovered again, between two discovery snapshots
+func ChangedStaleGroups(previous *DiscoverySnapshot, current *DiscoverySnapshot) []string {
+	changed := []string{}
+	for _, group := range previous.StaleGroups {
+		if !stringInSlice(current.StaleGroups, group) {
+			changed = append(changed, group)
+		}
+	}
+	for _, group := range current.StaleGroups {
+		if !stringInSlice(previous.StaleGroups, group) {
+			changed = append(changed, group)
+		}
+	}
+	return changed
+}
+
+// ChangedAPIGroups returns the API groups whose resources or verbs differ between two versions of the cluster policy cache
+func ChangedAPIGroups(previous []v1.PolicyRule, current []v1.PolicyRule) []string {
+	previousByGroup := rulesByGroup(previous)
+	currentByGroup := rulesByGroup(current)
+	changed := []string{}
+	for group, rules := range currentByGroup {
+		if previousRules, ok := previousByGroup[group]; !ok || !stringSetsEqual(previousRules, rules) {
+			changed = append(changed, group)
+		}
+	}
+	for group := range previousByGroup {
+		if _, ok := currentByGroup[group]; !ok {
+			changed = append(changed, group)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// rulesByGroup maps every API group to the set of resource and verb combinations it serves
+func rulesByGroup(rules []v1.PolicyRule) map[string]map[string]bool {
+	byGroup := map[string]map[string]bool{}
+	for _, rule := range rules {
+		for _, group := range rule.APIGroups {
+			if byGroup[group] == nil {
+				byGroup[group] = map[string]bool{}
+			}
+			for _, resource := range rule.Resources {
+				for _, verb := range rule.Verbs {
+					byGroup[group][resource+"/"+verb] = true
+				}
+			}
+		}
+	}
+	return byGroup
+}
+
+func stringSetsEqual(a map[string]bool, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key := range a {
+		if !b[key] {
+			return false
+		}
+	}
+	return true
+}
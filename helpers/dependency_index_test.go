@@ -0,0 +1,91 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDependencyIndex(t *testing.T) {
+	base := Dependant{Kind: "DynamicClusterRole", Name: "base"}
+	developer := Dependant{Kind: "DynamicRole", Namespace: "team-a", Name: "developer"}
+	auditor := Dependant{Kind: "DynamicClusterRole", Name: "auditor"}
+
+	index := NewDependencyIndex()
+	baseDependencies := NewDependencies()
+	baseDependencies.ClusterRoles["admin"] = true
+	baseDependencies.APIGroupPatterns["*.openshift.io"] = true
+	index.Set(base, baseDependencies)
+
+	developerDependencies := NewDependencies()
+	developerDependencies.DynamicClusterRoles["base"] = true
+	developerDependencies.Roles[types.NamespacedName{Namespace: "team-a", Name: "viewer"}] = true
+	developerDependencies.RoleSelectors["tier"] = RoleSelector{Selector: labels.SelectorFromSet(labels.Set{"tier": "dev"}), Namespace: "team-a"}
+	developerDependencies.APIGroupPatterns[""] = true
+	index.Set(developer, developerDependencies)
+
+	auditorDependencies := NewDependencies()
+	auditorDependencies.ClusterRoles["admin"] = true
+	auditorDependencies.ClusterRoleSelectors["audit"] = labels.SelectorFromSet(labels.Set{"audit": "true"})
+	index.Set(auditor, auditorDependencies)
+
+	tests := []struct {
+		name string
+		got  []Dependant
+		want []Dependant
+	}{
+		{"ClusterRole by name", index.DependantsOfClusterRole("admin"), []Dependant{auditor, base}},
+		{"unknown ClusterRole", index.DependantsOfClusterRole("view"), []Dependant{}},
+		{"Role by name", index.DependantsOfRole(types.NamespacedName{Namespace: "team-a", Name: "viewer"}), []Dependant{developer}},
+		{"Role of the same name in another namespace", index.DependantsOfRole(types.NamespacedName{Namespace: "team-b", Name: "viewer"}), []Dependant{}},
+		{"DynamicClusterRole", index.DependantsOfDynamicClusterRole("base"), []Dependant{developer}},
+		{"Role labels in the selected namespace", index.DependantsOfRoleLabels("team-a", labels.Set{"tier": "dev"}, func() labels.Set { return nil }), []Dependant{developer}},
+		{"Role labels in another namespace", index.DependantsOfRoleLabels("team-b", labels.Set{"tier": "dev"}, func() labels.Set { return nil }), []Dependant{}},
+		{"deleted Role", index.DependantsOfDeletedRole("team-a"), []Dependant{developer}},
+		{"ClusterRole labels", index.DependantsOfClusterRoleLabels(labels.Set{"audit": "true"}), []Dependant{auditor}},
+		{"deleted ClusterRole", index.DependantsOfDeletedClusterRole(), []Dependant{auditor}},
+		{"API group matching a pattern", index.DependantsOfAPIGroups([]string{"route.openshift.io"}), []Dependant{base}},
+		{"core API group", index.DependantsOfAPIGroups([]string{"", "apps"}), []Dependant{developer}},
+		{"every dependant", index.Dependants(), []Dependant{auditor, base, developer}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.got, test.want) {
+				t.Errorf("got %v, want %v", test.got, test.want)
+			}
+		})
+	}
+
+	// Replacing the dependencies of a dynamic role forgets the previous ones
+	index.Set(auditor, NewDependencies())
+	if got := index.DependantsOfClusterRole("admin"); !reflect.DeepEqual(got, []Dependant{base}) {
+		t.Errorf("after Set, got %v, want %v", got, []Dependant{base})
+	}
+	index.Remove(base)
+	if got := index.DependantsOfClusterRole("admin"); len(got) != 0 {
+		t.Errorf("after Remove, got %v, want none", got)
+	}
+	if got := index.Count("DynamicClusterRole"); got != 1 {
+		t.Errorf("Count() = %d, want 1", got)
+	}
+}
+
+func TestChangedAPIGroups(t *testing.T) {
+	previous := []v1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}},
+		{APIGroups: []string{"batch"}, Resources: []string{"jobs"}, Verbs: []string{"get"}},
+	}
+	current := []v1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "list"}},
+		{APIGroups: []string{"route.openshift.io"}, Resources: []string{"routes"}, Verbs: []string{"get"}},
+	}
+	want := []string{"apps", "batch", "route.openshift.io"}
+	if got := ChangedAPIGroups(previous, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedAPIGroups() = %v, want %v", got, want)
+	}
+}
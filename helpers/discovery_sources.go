@@ -0,0 +1,69 @@
+package helpers
+
+import (
+	"encoding/json"
+	"sort"
+
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// APIServiceGVK identifies the APIService objects that register aggregated APIs such as metrics.k8s.io
+// They are handled as unstructured objects so that the operator does not depend on the kube-aggregator types
+var APIServiceGVK = schema.GroupVersionKind{Group: "apiregistration.k8s.io", Version: "v1", Kind: "APIService"}
+
+// APIServiceListGVK identifies a list of APIService objects
+var APIServiceListGVK = schema.GroupVersionKind{Group: "apiregistration.k8s.io", Version: "v1", Kind: "APIServiceList"}
+
+// crdDiscoveryInfo is the part of a CRD that determines what it contributes to discovery
+type crdDiscoveryInfo struct {
+	Group          string                                       `json:"group"`
+	Names          crdv1.CustomResourceDefinitionNames          `json:"names"`
+	Scope          crdv1.ResourceScope                          `json:"scope"`
+	ServedVersions []string                                     `json:"servedVersions"`
+	Subresources   map[string]*crdv1.CustomResourceSubresources `json:"subresources"`
+	Established    bool                                         `json:"established"`
+}
+
+// CRDFingerprint summarises the parts of a CRD that change the cluster's discovery information
+// A CRD only shows up in discovery once it is established, so a CRD whose fingerprint has not changed can be ignored
+func CRDFingerprint(crd *crdv1.CustomResourceDefinition) string {
+	info := crdDiscoveryInfo{
+		Group:          crd.Spec.Group,
+		Names:          crd.Status.AcceptedNames,
+		Scope:          crd.Spec.Scope,
+		ServedVersions: []string{},
+		Subresources:   map[string]*crdv1.CustomResourceSubresources{},
+	}
+	for _, version := range crd.Spec.Versions {
+		if !version.Served {
+			continue
+		}
+		info.ServedVersions = append(info.ServedVersions, version.Name)
+		info.Subresources[version.Name] = version.Subresources
+	}
+	sort.Strings(info.ServedVersions)
+	for _, condition := range crd.Status.Conditions {
+		if condition.Type == crdv1.Established && condition.Status == crdv1.ConditionTrue {
+			info.Established = true
+		}
+	}
+	fingerprint, _ := json.Marshal(info)
+	return string(fingerprint)
+}
+
+// APIServiceAvailable returns true if an APIService reports the Available condition, i.e. its API is being served
+func APIServiceAvailable(apiService *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(apiService.Object, "status", "conditions")
+	for _, condition := range conditions {
+		condition, ok := condition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if condition["type"] == "Available" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
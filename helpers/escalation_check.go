@@ -0,0 +1,142 @@
+package helpers
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxConcurrentReviews bounds the number of SubjectAccessReviews in flight while the permissions of a single set of rules are checked
+const maxConcurrentReviews = 16
+
+// MissingPermissions returns the permissions of the given rules that a user does not hold in a namespace, or cluster-wide when namespace is empty
+// A single review for everything on everything lets cluster admins through at once, and one review for every verb on every resource of an API group
+// lets users holding a whole group through without checking its resources one by one
+// Every remaining resource is then checked with a review for all of its verbs at once, and only verb by verb if that fails, with a bounded number of reviews in flight
+// The missing permissions are compacted into as few rules as possible
+func MissingPermissions(c client.Client, user authenticationv1.UserInfo, namespace string, rules []v1.PolicyRule) ([]v1.PolicyRule, error) {
+	allowed, err := userCan(c, user, authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "*", Group: "*", Resource: "*"}, nil)
+	if err == nil && allowed && namespace == "" {
+		allowed, err = userCan(c, user, authorizationv1.ResourceAttributes{}, &authorizationv1.NonResourceAttributes{Path: "*", Verb: "*"})
+	}
+	if err != nil || allowed {
+		return nil, err
+	}
+
+	permissions := NormalizePolicyRules(rules)
+	groupsHeld := map[string]bool{}
+	for _, rule := range permissions {
+		if len(rule.NonResourceURLs) > 0 {
+			continue
+		}
+		if _, checked := groupsHeld[rule.APIGroups[0]]; checked {
+			continue
+		}
+		held, err := UserCan(c, user, authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "*", Group: rule.APIGroups[0], Resource: "*"})
+		if err != nil {
+			return nil, err
+		}
+		groupsHeld[rule.APIGroups[0]] = held
+	}
+	pending := []v1.PolicyRule{}
+	for _, rule := range permissions {
+		if len(rule.NonResourceURLs) > 0 || !groupsHeld[rule.APIGroups[0]] {
+			pending = append(pending, rule)
+		}
+	}
+
+	missingVerbs := make([][]string, len(pending))
+	errs := make([]error, len(pending))
+	inFlight := make(chan struct{}, maxConcurrentReviews)
+	var wg sync.WaitGroup
+	for i := range pending {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			inFlight <- struct{}{}
+			defer func() { <-inFlight }()
+			missingVerbs[i], errs[i] = missingVerbsOfRule(c, user, namespace, pending[i])
+		}(i)
+	}
+	wg.Wait()
+
+	missing := []v1.PolicyRule{}
+	for i, rule := range pending {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if len(missingVerbs[i]) > 0 {
+			missing = append(missing, v1.PolicyRule{APIGroups: rule.APIGroups, Resources: rule.Resources, ResourceNames: rule.ResourceNames, NonResourceURLs: rule.NonResourceURLs, Verbs: missingVerbs[i]})
+		}
+	}
+	return CompactPolicyRules(NormalizePolicyRules(missing)), nil
+}
+
+// missingVerbsOfRule returns the verbs of an expanded rule (see func `ExpandPolicyRules`) that a user does not hold, after a single review for all of them
+func missingVerbsOfRule(c client.Client, user authenticationv1.UserInfo, namespace string, rule v1.PolicyRule) ([]string, error) {
+	if len(rule.Verbs) > 1 && !stringInSlice(rule.Verbs, "*") {
+		allowed, err := userCanOnRule(c, user, namespace, rule, "*")
+		if err != nil || allowed {
+			return nil, err
+		}
+	}
+	missing := []string{}
+	for _, verb := range rule.Verbs {
+		allowed, err := userCanOnRule(c, user, namespace, rule, verb)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			missing = append(missing, verb)
+		}
+	}
+	return missing, nil
+}
+
+// userCanOnRule asks whether a user may use a verb on the resource or non-resource URL of an expanded rule, e.g. `pods/exec` as the `exec` subresource of `pods`
+func userCanOnRule(c client.Client, user authenticationv1.UserInfo, namespace string, rule v1.PolicyRule, verb string) (bool, error) {
+	if len(rule.NonResourceURLs) > 0 {
+		return userCan(c, user, authorizationv1.ResourceAttributes{}, &authorizationv1.NonResourceAttributes{Path: rule.NonResourceURLs[0], Verb: verb})
+	}
+	attributes := authorizationv1.ResourceAttributes{Namespace: namespace, Verb: verb, Group: rule.APIGroups[0], Resource: rule.Resources[0]}
+	if parts := strings.SplitN(attributes.Resource, "/", 2); len(parts) == 2 {
+		attributes.Resource, attributes.Subresource = parts[0], parts[1]
+	}
+	if len(rule.ResourceNames) > 0 {
+		attributes.Name = rule.ResourceNames[0]
+	}
+	return UserCan(c, user, attributes)
+}
+
+// UserCan asks the API server, with a SubjectAccessReview, whether a user may act on a resource
+func UserCan(c client.Client, user authenticationv1.UserInfo, attributes authorizationv1.ResourceAttributes) (bool, error) {
+	return userCan(c, user, attributes, nil)
+}
+
+func userCan(c client.Client, user authenticationv1.UserInfo, attributes authorizationv1.ResourceAttributes, nonResourceAttributes *authorizationv1.NonResourceAttributes) (bool, error) {
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  map[string]authorizationv1.ExtraValue{},
+		},
+	}
+	for key, value := range user.Extra {
+		review.Spec.Extra[key] = authorizationv1.ExtraValue(value)
+	}
+	if nonResourceAttributes != nil {
+		review.Spec.NonResourceAttributes = nonResourceAttributes
+	} else {
+		review.Spec.ResourceAttributes = &attributes
+	}
+	if err := c.Create(context.TODO(), review); err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
@@ -0,0 +1,252 @@
+package helpers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeReviewer answers SubjectAccessReviews as RBAC would for a user holding the given rules, and records every review it answered
+type fakeReviewer struct {
+	client.Client
+	held    []v1.PolicyRule
+	lock    sync.Mutex
+	reviews []authorizationv1.SubjectAccessReviewSpec
+}
+
+func newFakeReviewer(held ...v1.PolicyRule) *fakeReviewer {
+	return &fakeReviewer{Client: fake.NewFakeClientWithScheme(runtime.NewScheme()), held: held}
+}
+
+func (f *fakeReviewer) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authorizationv1.SubjectAccessReview)
+	if !ok {
+		return f.Client.Create(ctx, obj, opts...)
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.reviews = append(f.reviews, review.Spec)
+	for _, rule := range f.held {
+		if reviewMatchesRule(review.Spec, rule) {
+			review.Status.Allowed = true
+		}
+	}
+	return nil
+}
+
+// reviewedResources returns the resources that were reviewed one by one, e.g. `pods/exec`, leaving out reviews of a whole API group
+func (f *fakeReviewer) reviewedResources() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	resources := []string{}
+	for _, review := range f.reviews {
+		if review.ResourceAttributes == nil || review.ResourceAttributes.Resource == "*" {
+			continue
+		}
+		resource := review.ResourceAttributes.Resource
+		if review.ResourceAttributes.Subresource != "" {
+			resource += "/" + review.ResourceAttributes.Subresource
+		}
+		resources = appendSet(resources, resource)
+	}
+	return resources
+}
+
+// reviewMatchesRule matches the attributes of a review against a rule the way the RBAC authorizer does, where only `*` in the rule is a wildcard
+func reviewMatchesRule(review authorizationv1.SubjectAccessReviewSpec, rule v1.PolicyRule) bool {
+	if review.NonResourceAttributes != nil {
+		attributes := review.NonResourceAttributes
+		if !stringInSlice(rule.Verbs, "*") && !stringInSlice(rule.Verbs, attributes.Verb) {
+			return false
+		}
+		for _, url := range rule.NonResourceURLs {
+			if url == attributes.Path || url == "*" || (strings.HasSuffix(url, "*") && strings.HasPrefix(attributes.Path, strings.TrimSuffix(url, "*"))) {
+				return true
+			}
+		}
+		return false
+	}
+	attributes := review.ResourceAttributes
+	resource := attributes.Resource
+	if attributes.Subresource != "" {
+		resource += "/" + attributes.Subresource
+	}
+	return (stringInSlice(rule.Verbs, "*") || stringInSlice(rule.Verbs, attributes.Verb)) &&
+		(stringInSlice(rule.APIGroups, "*") || stringInSlice(rule.APIGroups, attributes.Group)) &&
+		(stringInSlice(rule.Resources, "*") || stringInSlice(rule.Resources, resource) || (attributes.Subresource != "" && stringInSlice(rule.Resources, "*/"+attributes.Subresource))) &&
+		(len(rule.ResourceNames) == 0 || stringInSlice(rule.ResourceNames, attributes.Name))
+}
+
+func TestMissingPermissions(t *testing.T) {
+	user := authenticationv1.UserInfo{Username: "bob", Groups: []string{"dev"}}
+	tests := []struct {
+		name          string
+		namespace     string
+		held          []v1.PolicyRule
+		rules         []v1.PolicyRule
+		want          []v1.PolicyRule
+		wantReviewed  []string
+		wantAtMostSAR int
+	}{
+		{
+			name: "cluster admin is admitted at once",
+			held: []v1.PolicyRule{
+				{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+				{NonResourceURLs: []string{"*"}, Verbs: []string{"*"}},
+			},
+			rules:         []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}, {NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}},
+			want:          []v1.PolicyRule{},
+			wantReviewed:  []string{},
+			wantAtMostSAR: 2,
+		},
+		{
+			name:          "namespace admin is admitted without checking nonResourceURLs",
+			namespace:     "team-a",
+			held:          []v1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}},
+			rules:         []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+			want:          []v1.PolicyRule{},
+			wantReviewed:  []string{},
+			wantAtMostSAR: 1,
+		},
+		{
+			name: "a whole API group is admitted without checking its resources",
+			held: []v1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"*"}, Verbs: []string{"*"}}},
+			rules: []v1.PolicyRule{
+				{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "delete"}},
+				{APIGroups: []string{"apps"}, Resources: []string{"deployments/scale"}, Verbs: []string{"update"}},
+			},
+			want:         []v1.PolicyRule{},
+			wantReviewed: []string{},
+		},
+		{
+			name:         "subresources are reviewed as the subresource of their parent",
+			held:         []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods/exec"}, Verbs: []string{"create"}}},
+			rules:        []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods/exec", "pods/log"}, Verbs: []string{"create"}}},
+			want:         []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods/log"}, Verbs: []string{"create"}}},
+			wantReviewed: []string{"pods/exec", "pods/log"},
+		},
+		{
+			name:         "only the verbs not held are missing",
+			held:         []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+			rules:        []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "delete"}}},
+			want:         []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"delete", "list"}}},
+			wantReviewed: []string{"secrets"},
+		},
+		{
+			name:         "resource names are reviewed one by one",
+			held:         []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a"}, Verbs: []string{"get"}}},
+			rules:        []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a", "b"}, Verbs: []string{"get"}}},
+			want:         []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"b"}, Verbs: []string{"get"}}},
+			wantReviewed: []string{"secrets"},
+		},
+		{
+			name:  "nonResourceURLs",
+			held:  []v1.PolicyRule{{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}},
+			rules: []v1.PolicyRule{{NonResourceURLs: []string{"/healthz", "/metrics"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reviewer := newFakeReviewer(test.held...)
+			got, err := MissingPermissions(reviewer, user, test.namespace, test.rules)
+			if err != nil {
+				t.Fatalf("MissingPermissions() error = %v", err)
+			}
+			expectRules(t, got, test.want)
+			if test.wantReviewed != nil {
+				expectSameStrings(t, "reviewed resources", reviewer.reviewedResources(), test.wantReviewed)
+			}
+			if test.wantAtMostSAR > 0 && len(reviewer.reviews) > test.wantAtMostSAR {
+				t.Errorf("MissingPermissions() made %d reviews, want at most %d", len(reviewer.reviews), test.wantAtMostSAR)
+			}
+			for _, review := range reviewer.reviews {
+				if review.User != user.Username || review.ResourceAttributes != nil && review.ResourceAttributes.Namespace != test.namespace {
+					t.Errorf("review %+v is not for user %s in namespace %q", review, user.Username, test.namespace)
+				}
+			}
+		})
+	}
+}
+
+func TestMissingVerbsOfRule(t *testing.T) {
+	user := authenticationv1.UserInfo{Username: "bob"}
+	rule := v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "delete"}}
+
+	reviewer := newFakeReviewer(v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"*"}})
+	missing, err := missingVerbsOfRule(reviewer, user, "team-a", rule)
+	if err != nil || len(missing) != 0 {
+		t.Errorf("missingVerbsOfRule() = %v, %v, want no missing verbs", missing, err)
+	}
+	if len(reviewer.reviews) != 1 {
+		t.Errorf("missingVerbsOfRule() made %d reviews for a user holding every verb, want 1", len(reviewer.reviews))
+	}
+
+	reviewer = newFakeReviewer(v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}})
+	missing, err = missingVerbsOfRule(reviewer, user, "team-a", rule)
+	if err != nil {
+		t.Fatalf("missingVerbsOfRule() error = %v", err)
+	}
+	expectSameStrings(t, "missing verbs", missing, []string{"list", "delete"})
+	if len(reviewer.reviews) != 4 {
+		t.Errorf("missingVerbsOfRule() made %d reviews, want 1 for every verb at once and 1 per verb", len(reviewer.reviews))
+	}
+}
+
+func TestUserCanOnRule(t *testing.T) {
+	user := authenticationv1.UserInfo{Username: "bob"}
+	tests := []struct {
+		name string
+		rule v1.PolicyRule
+		want authorizationv1.ResourceAttributes
+	}{
+		{
+			name: "resource",
+			rule: v1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}},
+			want: authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "get", Group: "apps", Resource: "deployments"},
+		},
+		{
+			name: "subresource",
+			rule: v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods/exec"}, Verbs: []string{"create"}},
+			want: authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "create", Resource: "pods", Subresource: "exec"},
+		},
+		{
+			name: "resource name",
+			rule: v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"db"}, Verbs: []string{"get"}},
+			want: authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "get", Resource: "secrets", Name: "db"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reviewer := newFakeReviewer()
+			if _, err := userCanOnRule(reviewer, user, "team-a", test.rule, test.rule.Verbs[0]); err != nil {
+				t.Fatalf("userCanOnRule() error = %v", err)
+			}
+			if len(reviewer.reviews) != 1 || *reviewer.reviews[0].ResourceAttributes != test.want {
+				t.Errorf("userCanOnRule() reviewed %+v, want %+v", reviewer.reviews, test.want)
+			}
+		})
+	}
+
+	reviewer := newFakeReviewer(v1.PolicyRule{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}})
+	allowed, err := userCanOnRule(reviewer, user, "", v1.PolicyRule{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}, "get")
+	if err != nil || !allowed {
+		t.Errorf("userCanOnRule() = %v, %v for a nonResourceURL the user holds", allowed, err)
+	}
+}
+
+// expectSameStrings fails the test unless two lists hold the same strings, in any order
+func expectSameStrings(t *testing.T, description string, got []string, want []string) {
+	t.Helper()
+	if len(got) != len(want) || len(subtractStringSlices(got, want)) > 0 || len(subtractStringSlices(want, got)) > 0 {
+		t.Errorf("%s = %q, want %q", description, got, want)
+	}
+}
@@ -34,6 +34,16 @@ func subtractStringSlices(allElements []string, elementsToRemove []string) []str
 	return newList
 }
 
+func intersectStringSlices(elements []string, elementsToKeep []string) []string {
+	newList := []string{}
+	for _, element := range elements {
+		if stringInSlice(elementsToKeep, element) {
+			newList = append(newList, element)
+		}
+	}
+	return newList
+}
+
 func appendSet(input []string, stringsToAppend ...string) []string {
 	output := []string{}
 	copier.Copy(&output, &input)
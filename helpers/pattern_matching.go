@@ -0,0 +1,113 @@
+package helpers
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// maxCompiledPatterns bounds how many compiled regular expressions are kept, evicting the least recently used first,
+// since the patterns of every spec the webhooks compute rules for pass through patternMatches, including rejected and dry-run requests
+const maxCompiledPatterns = 1024
+
+// compiledPatternTTL drops a compiled regular expression that has not been matched with for a while, it is compiled again when needed
+const compiledPatternTTL = 24 * time.Hour
+
+var compiledPatterns = cache.NewLRUExpireCache(maxCompiledPatterns)
+
+// patternMatches reports whether an apiGroup or resource pattern from a DynamicRole spec matches a name known to discovery
+//
+// Patterns take one of the following forms:
+//   - `*`, which matches everything (including subresources)
+//   - a literal name, e.g. `secrets` or `apps`
+//   - a glob, e.g. `*.openshift.io`, `secrets*`, `pods/*` or `*/exec` (`*` does not cross the `/` between a resource and its subresource)
+//   - a regular expression starting with `^`, e.g. `^(.*\.)?tekton\.dev$`
+func patternMatches(pattern string, name string) bool {
+	if pattern == "*" || pattern == name {
+		return true
+	}
+	if isRegexPattern(pattern) {
+		expression, err := compilePattern(pattern)
+		if err != nil {
+			return false
+		}
+		return expression.MatchString(name)
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return false
+	}
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+func groupMatchesAnyPattern(patterns []string, group string) bool {
+	for _, pattern := range patterns {
+		if pattern == "v1" {
+			pattern = ""
+		}
+		if patternMatches(pattern, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func resourceMatchesAnyPattern(patterns []string, resource string) bool {
+	for _, pattern := range patterns {
+		if patternMatches(pattern, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+func isRegexPattern(pattern string) bool {
+	return strings.HasPrefix(pattern, "^")
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if expression, ok := compiledPatterns.Get(pattern); ok {
+		return expression.(*regexp.Regexp), nil
+	}
+	expression, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	compiledPatterns.Add(pattern, expression, compiledPatternTTL)
+	return expression, nil
+}
+
+// newPatternMatcher parses a pattern (see func `patternMatches`) without adding it to compiledPatterns, and returns a func reporting whether it matches a name
+// It is used to validate specs on admission, so that patterns sent in requests that are then rejected do not take up room in the cache
+func newPatternMatcher(pattern string) (func(name string) bool, error) {
+	if isRegexPattern(pattern) {
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+		}
+		return expression.MatchString, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return func(name string) bool {
+		return patternMatches(pattern, name)
+	}, nil
+}
+
+// ValidateRulePatterns returns an error describing the first apiGroup or resource pattern in the given rules that cannot be parsed
+func ValidateRulePatterns(rules []v1.PolicyRule) error {
+	for _, rule := range rules {
+		for _, pattern := range append(append([]string{}, rule.APIGroups...), rule.Resources...) {
+			if _, err := newPatternMatcher(pattern); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
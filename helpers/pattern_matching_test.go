@@ -0,0 +1,103 @@
+package helpers
+
+import (
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*", "secrets", true},
+		{"*", "pods/exec", true},
+		{"secrets", "secrets", true},
+		{"secrets", "secrets/status", false},
+		{"*.openshift.io", "route.openshift.io", true},
+		{"*.openshift.io", "openshift.io", false},
+		{"secrets*", "secretsstore", true},
+		{"pods/*", "pods/exec", true},
+		{"pods/*", "pods", false},
+		{"*/exec", "pods/exec", true},
+		{"*/exec", "exec", false},
+		{"*s", "pods/exec", false},
+		{"^(.*\\.)?tekton\\.dev$", "tekton.dev", true},
+		{"^(.*\\.)?tekton\\.dev$", "triggers.tekton.dev", true},
+		{"^(.*\\.)?tekton\\.dev$", "tekton.dev.example.com", false},
+		{"^([", "anything", false},
+		{"[", "[", true},
+	}
+	for _, test := range tests {
+		if got := patternMatches(test.pattern, test.name); got != test.want {
+			t.Errorf("patternMatches(%q, %q) = %v, want %v", test.pattern, test.name, got, test.want)
+		}
+	}
+}
+
+func TestGroupMatchesAnyPattern(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		group    string
+		want     bool
+	}{
+		{[]string{""}, "", true},
+		{[]string{"v1"}, "", true},
+		{[]string{"apps", "batch"}, "batch", true},
+		{[]string{"apps"}, "", false},
+		{[]string{"*.k8s.io"}, "rbac.authorization.k8s.io", true},
+	}
+	for _, test := range tests {
+		if got := groupMatchesAnyPattern(test.patterns, test.group); got != test.want {
+			t.Errorf("groupMatchesAnyPattern(%q, %q) = %v, want %v", test.patterns, test.group, got, test.want)
+		}
+	}
+}
+
+func TestValidateRulePatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []v1.PolicyRule
+		wantErr bool
+	}{
+		{"literals and globs", []v1.PolicyRule{{APIGroups: []string{"*.openshift.io"}, Resources: []string{"pods/*", "secrets"}}}, false},
+		{"valid regular expression", []v1.PolicyRule{{APIGroups: []string{"^(.*\\.)?tekton\\.dev$"}, Resources: []string{"*"}}}, false},
+		{"invalid regular expression", []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"^(pods"}}}, true},
+		{"invalid glob", []v1.PolicyRule{{APIGroups: []string{"[apps"}, Resources: []string{"*"}}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateRulePatterns(test.rules); (err != nil) != test.wantErr {
+				t.Errorf("ValidateRulePatterns() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidationDoesNotCachePatterns(t *testing.T) {
+	cached := len(compiledPatterns.Keys())
+	for i := 0; i < 10; i++ {
+		pattern := fmt.Sprintf("^app%d\\..*$", i)
+		allow := []v1.PolicyRule{{APIGroups: []string{pattern}, Resources: []string{"^deployments?$"}, Verbs: []string{"get"}}}
+		if err := ValidateRulePatterns(allow); err != nil {
+			t.Fatalf("ValidateRulePatterns() error = %v", err)
+		}
+		ValidateDynamicRoleSpec(Role, field.NewPath("spec"), nil, &allow, nil, testDiscovery)
+	}
+	if got := len(compiledPatterns.Keys()); got != cached {
+		t.Errorf("validating specs grew the compiled pattern cache from %d to %d entries", cached, got)
+	}
+}
+
+func TestCompiledPatternsAreBounded(t *testing.T) {
+	for i := 0; i < maxCompiledPatterns+10; i++ {
+		patternMatches(fmt.Sprintf("^unique%d$", i), "apps")
+	}
+	if got := len(compiledPatterns.Keys()); got > maxCompiledPatterns {
+		t.Errorf("the compiled pattern cache holds %d entries, want at most %d", got, maxCompiledPatterns)
+	}
+}
@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	v1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// applyDynamicRBACPolicies removes every permission that a DynamicRBACPolicy of the cluster forbids from an expanded ruleset
+// Policies are applied in order of name, each removal being recorded as e.g. `DynamicRBACPolicy/guardrails deny[0]`
+func applyDynamicRBACPolicies(c client.Client, discovery *DiscoverySnapshot, rules []v1.PolicyRule, provenance *Provenance) ([]v1.PolicyRule, error) {
+	policies := &v1alpha1.DynamicRBACPolicyList{}
+	if err := c.List(context.TODO(), policies); err != nil {
+		return nil, err
+	}
+	sort.Slice(policies.Items, func(i, j int) bool {
+		return policies.Items[i].Name < policies.Items[j].Name
+	})
+	for _, policy := range policies.Items {
+		if err := validateDynamicRBACPolicy(policy.Spec); err != nil {
+			return nil, fmt.Errorf("DynamicRBACPolicy %s: %v", policy.Name, err)
+		}
+		for i := range policy.Spec.Deny {
+			remaining := ApplyDenyRulesToExpandedRuleset(rules, policy.Spec.Deny[i:i+1], discovery)
+			provenance.recordDenial(fmt.Sprintf("DynamicRBACPolicy/%s deny[%d]", policy.Name, i), &policy.Spec.Deny[i], rules, remaining)
+			rules = remaining
+		}
+		for i, limit := range policy.Spec.MaxVerbs {
+			remaining := ApplyVerbLimitsToExpandedRuleset(rules, []v1alpha1.VerbLimit{limit})
+			if provenance != nil {
+				_, removed := PolicyRuleChanges(rules, remaining)
+				provenance.record(false, fmt.Sprintf("DynamicRBACPolicy/%s maxVerbs[%d]", policy.Name, i), &v1.PolicyRule{APIGroups: limit.APIGroups, Resources: limit.Resources, Verbs: limit.Verbs}, removed)
+			}
+			rules = remaining
+		}
+	}
+	return rules, nil
+}
+
+// validateDynamicRBACPolicy returns an error describing the first pattern of a policy that cannot be parsed
+// A policy that cannot be applied fails the computation of every dynamic role, rather than letting through what it forbids
+func validateDynamicRBACPolicy(spec v1alpha1.DynamicRBACPolicySpec) error {
+	if err := ValidateRulePatterns(spec.Deny); err != nil {
+		return err
+	}
+	for _, limit := range spec.MaxVerbs {
+		if err := ValidateRulePatterns([]v1.PolicyRule{{APIGroups: limit.APIGroups, Resources: limit.Resources}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyVerbLimitsToExpandedRuleset takes in an expanded ruleset (see func `ExpandPolicyRules`) and removes every verb that a matching limit does not list
+// A rule granting `*` is granted the verbs of the limit instead, verb aliases stand for all of their verbs, and nonResourceURLs are never limited
+func ApplyVerbLimitsToExpandedRuleset(fullRuleSet []v1.PolicyRule, limits []v1alpha1.VerbLimit) []v1.PolicyRule {
+	outputIR := policyListToIR(fullRuleSet)
+
+	for _, limit := range limits {
+		limitVerbs := expandVerbAliases(limit.Verbs)
+		for currentPolicyKey, verbs := range outputIR {
+			if currentPolicyKey.NonResourceURLs != "" {
+				continue
+			}
+			if !groupMatchesAnyPattern(limit.APIGroups, currentPolicyKey.APIGroup) || !resourceMatchesAnyPattern(limit.Resources, currentPolicyKey.Resource) {
+				continue
+			}
+			if stringInSlice(limitVerbs, "*") {
+				continue
+			}
+			var newVerbs []string
+			if stringInSlice(verbs, "*") {
+				newVerbs = appendSet([]string{}, limitVerbs...)
+			} else {
+				newVerbs = intersectStringSlices(verbs, limitVerbs)
+			}
+			if len(newVerbs) > 0 {
+				outputIR[currentPolicyKey] = newVerbs
+			} else {
+				delete(outputIR, currentPolicyKey)
+			}
+		}
+	}
+
+	return irToPolicyList(outputIR)
+}
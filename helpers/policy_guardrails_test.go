@@ -0,0 +1,159 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestApplyVerbLimitsToExpandedRuleset(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []v1.PolicyRule
+		limits []v1alpha1.VerbLimit
+		want   []v1.PolicyRule
+	}{
+		{
+			name:   "verbs outside the limit are removed",
+			rules:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "delete"}}},
+			limits: []v1alpha1.VerbLimit{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+			want:   []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:   "rules left without verbs are dropped",
+			rules:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"delete"}}},
+			limits: []v1alpha1.VerbLimit{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+			want:   []v1.PolicyRule{},
+		},
+		{
+			name:   "wildcard verb is replaced by the verbs of the limit",
+			rules:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"*"}}},
+			limits: []v1alpha1.VerbLimit{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"read"}}},
+			want:   []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "watch"}}},
+		},
+		{
+			name:   "wildcard limit keeps every verb",
+			rules:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "delete"}}},
+			limits: []v1alpha1.VerbLimit{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}},
+			want:   []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "delete"}}},
+		},
+		{
+			name: "resources not matched by the limit are untouched",
+			rules: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "delete"}},
+				{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "delete"}},
+			},
+			limits: []v1alpha1.VerbLimit{{APIGroups: []string{"apps"}, Resources: []string{"deploy*"}, Verbs: []string{"get"}}},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "delete"}},
+				{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}},
+			},
+		},
+		{
+			name:   "nonResourceURLs are never limited",
+			rules:  []v1.PolicyRule{{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get", "post"}}},
+			limits: []v1alpha1.VerbLimit{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"get"}}},
+			want:   []v1.PolicyRule{{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get", "post"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectRules(t, ApplyVerbLimitsToExpandedRuleset(ExpandPolicyRules(test.rules), test.limits), test.want)
+		})
+	}
+}
+
+func TestApplyDynamicRBACPolicies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	rules := ExpandPolicyRules([]v1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get", "list", "delete"}},
+		{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles"}, Verbs: []string{"get", "escalate"}},
+	})
+
+	tests := []struct {
+		name     string
+		policies []runtime.Object
+		want     []v1.PolicyRule
+		wantErr  bool
+	}{
+		{
+			name: "no policy",
+			want: rules,
+		},
+		{
+			name: "deny and verb limits of every policy",
+			policies: []runtime.Object{
+				&v1alpha1.DynamicRBACPolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: "no-escalation"},
+					Spec:       v1alpha1.DynamicRBACPolicySpec{Deny: []v1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"dangerous"}}}},
+				},
+				&v1alpha1.DynamicRBACPolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: "read-only-secrets"},
+					Spec:       v1alpha1.DynamicRBACPolicySpec{MaxVerbs: []v1alpha1.VerbLimit{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"read"}}}},
+				},
+			},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "delete"}},
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list"}},
+				{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles"}, Verbs: []string{"get"}},
+			},
+		},
+		{
+			name: "invalid policy fails the computation",
+			policies: []runtime.Object{
+				&v1alpha1.DynamicRBACPolicy{
+					ObjectMeta: metav1.ObjectMeta{Name: "broken"},
+					Spec:       v1alpha1.DynamicRBACPolicySpec{MaxVerbs: []v1alpha1.VerbLimit{{APIGroups: []string{""}, Resources: []string{"^(secrets"}, Verbs: []string{"get"}}}},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyDynamicRBACPolicies(fake.NewFakeClientWithScheme(scheme, test.policies...), testDiscovery, rules, NewProvenance())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("applyDynamicRBACPolicies() error = %v, want error %v", err, test.wantErr)
+			}
+			if err == nil {
+				expectRules(t, got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyDynamicRBACPoliciesToWildcardVerbs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewFakeClientWithScheme(scheme, &v1alpha1.DynamicRBACPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "no-escalation"},
+		Spec:       v1alpha1.DynamicRBACPolicySpec{Deny: []v1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"escalate"}}}},
+	})
+	// `*` reaches the policies from inherited roles and from resources that discovery lists without verbs
+	rules := ExpandPolicyRules([]v1.PolicyRule{
+		{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles"}, Verbs: []string{"*"}},
+		{APIGroups: []string{"example.com"}, Resources: []string{"widgets"}, Verbs: []string{"*"}},
+	})
+	got, err := applyDynamicRBACPolicies(client, testDiscovery, rules, nil)
+	if err != nil {
+		t.Fatalf("applyDynamicRBACPolicies() error = %v", err)
+	}
+	expectRules(t, got, []v1.PolicyRule{
+		{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection", "bind"}},
+		{APIGroups: []string{"example.com"}, Resources: []string{"widgets"}, Verbs: subtractStringSlices(knownVerbs, []string{"escalate"})},
+	})
+	for _, rule := range got {
+		if stringInSlice(rule.Verbs, "*") || stringInSlice(rule.Verbs, "escalate") {
+			t.Errorf("rule %s still grants escalate", DescribePolicyRule(rule))
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package helpers
 
 import (
+	"sort"
+
 	v1 "k8s.io/api/rbac/v1"
 )
 
@@ -19,31 +21,98 @@ type policyListIR map[expandedPolicyKey]policyValue
 func policyListToIR(input []v1.PolicyRule) policyListIR {
 	outputMap := make(policyListIR)
 	for _, rule := range input {
-		currentPolicyKey := expandedPolicyKey{
-			APIGroup: rule.APIGroups[0],
-			Resource: rule.Resources[0],
-		}
-		if _, ok := outputMap[currentPolicyKey]; ok {
-			outputMap[currentPolicyKey] = appendSet(outputMap[currentPolicyKey], rule.Verbs...)
-		} else {
-			outputMap[currentPolicyKey] = rule.Verbs
+		for _, currentPolicyKey := range policyKeysForRule(rule) {
+			if _, ok := outputMap[currentPolicyKey]; ok {
+				outputMap[currentPolicyKey] = appendSet(outputMap[currentPolicyKey], rule.Verbs...)
+			} else {
+				outputMap[currentPolicyKey] = appendSet([]string{}, rule.Verbs...)
+			}
 		}
 	}
 	return outputMap
 }
 
-func irToPolicyList(input policyListIR) []v1.PolicyRule {
-	output := make([]v1.PolicyRule, 0, 100)
-	for key, verbs := range input {
-		output = append(output, v1.PolicyRule{
-			APIGroups: []string{key.APIGroup},
-			Resources: []string{key.Resource},
-			Verbs:     verbs,
+// policyKeysForRule returns one key for every group/resource/resourceName combination and every nonResourceURL that a rule covers.
+// An empty ResourceNames list produces keys with an empty ResourceNames field, meaning "every object of this type".
+func policyKeysForRule(rule v1.PolicyRule) []expandedPolicyKey {
+	keys := []expandedPolicyKey{}
+	for _, url := range rule.NonResourceURLs {
+		keys = append(keys, expandedPolicyKey{
+			NonResourceURLs: url,
 		})
 	}
+	resourceNames := rule.ResourceNames
+	if len(resourceNames) == 0 {
+		resourceNames = []string{""}
+	}
+	for _, group := range rule.APIGroups {
+		for _, resource := range rule.Resources {
+			for _, resourceName := range resourceNames {
+				keys = append(keys, expandedPolicyKey{
+					APIGroup:      group,
+					Resource:      resource,
+					ResourceNames: resourceName,
+				})
+			}
+		}
+	}
+	return keys
+}
+
+// irToPolicyList converts the IR back into expanded PolicyRules, sorted by key and with sorted verbs so that the output is stable across reconciles
+func irToPolicyList(input policyListIR) []v1.PolicyRule {
+	keys := make([]expandedPolicyKey, 0, len(input))
+	for key := range input {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return policyKeyLess(keys[i], keys[j])
+	})
+	output := make([]v1.PolicyRule, 0, len(keys))
+	for _, key := range keys {
+		verbs := append([]string{}, input[key]...)
+		sort.Strings(verbs)
+		output = append(output, policyRuleForKey(key, verbs))
+	}
 	return output
 }
 
+// policyKeyLess orders resource keys by API group, resource and resource name, followed by nonResourceURLs
+func policyKeyLess(a expandedPolicyKey, b expandedPolicyKey) bool {
+	if (a.NonResourceURLs == "") != (b.NonResourceURLs == "") {
+		return a.NonResourceURLs == ""
+	}
+	if a.APIGroup != b.APIGroup {
+		return a.APIGroup < b.APIGroup
+	}
+	if a.Resource != b.Resource {
+		return a.Resource < b.Resource
+	}
+	if a.ResourceNames != b.ResourceNames {
+		return a.ResourceNames < b.ResourceNames
+	}
+	return a.NonResourceURLs < b.NonResourceURLs
+}
+
+// policyRuleForKey converts a single IR entry back into an expanded PolicyRule
+func policyRuleForKey(key expandedPolicyKey, verbs []string) v1.PolicyRule {
+	if key.NonResourceURLs != "" {
+		return v1.PolicyRule{
+			NonResourceURLs: []string{key.NonResourceURLs},
+			Verbs:           verbs,
+		}
+	}
+	rule := v1.PolicyRule{
+		APIGroups: []string{key.APIGroup},
+		Resources: []string{key.Resource},
+		Verbs:     verbs,
+	}
+	if key.ResourceNames != "" {
+		rule.ResourceNames = []string{key.ResourceNames}
+	}
+	return rule
+}
+
 func unionIRs(m1, m2 policyListIR) policyListIR {
 	for ia, va := range m1 {
 		if it, ok := m2[ia]; ok {
@@ -0,0 +1,211 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	v1 "k8s.io/api/rbac/v1"
+)
+
+// ProvenanceStep records one source granting or removing a permission while the rules of a dynamic role are computed
+type ProvenanceStep struct {
+	// Granted is true if the source granted the permission, and false if it removed it
+	Granted bool
+	// Source names what granted or removed the permission, e.g. `ClusterRole/admin`, `deny[1]` or `allow[0]`
+	Source string
+	// Rule is the allow or deny rule of the spec, for the sources that are one
+	Rule *v1.PolicyRule
+}
+
+func (s ProvenanceStep) String() string {
+	if s.Granted {
+		return fmt.Sprintf("granted by %s", s.Source)
+	}
+	return fmt.Sprintf("removed by %s", s.Source)
+}
+
+// Explanation lists the steps that granted or removed a single verb on a resource, resource name or nonResourceURL, in the order they were applied
+type Explanation struct {
+	// Rule is the permission being explained, as a rule with a single verb
+	Rule    v1.PolicyRule
+	Steps   []ProvenanceStep
+	Granted bool
+}
+
+// Provenance records, for every individual permission, which inherited roles, deny and allow rules granted or removed it
+// The methods of a nil *Provenance do nothing, so that provenance is only tracked when it was asked for
+type Provenance struct {
+	steps map[expandedPolicyKey]map[string][]ProvenanceStep
+}
+
+// NewProvenance returns an empty provenance record
+func NewProvenance() *Provenance {
+	return &Provenance{steps: map[expandedPolicyKey]map[string][]ProvenanceStep{}}
+}
+
+// record appends a step to the history of every permission in rules
+func (p *Provenance) record(granted bool, source string, rule *v1.PolicyRule, rules []v1.PolicyRule) {
+	if p == nil {
+		return
+	}
+	for key, verbs := range policyListToIR(rules) {
+		if p.steps[key] == nil {
+			p.steps[key] = map[string][]ProvenanceStep{}
+		}
+		for _, verb := range verbs {
+			p.steps[key][verb] = append(p.steps[key][verb], ProvenanceStep{Granted: granted, Source: source, Rule: rule})
+		}
+	}
+}
+
+// recordDenial records the permissions that a deny rule removed from rules, and those it granted again on the well-known nonResourceURLs of a broader pattern
+// that it only partly overlapped (see func `narrowNonResourceURL`)
+func (p *Provenance) recordDenial(source string, rule *v1.PolicyRule, rules []v1.PolicyRule, remaining []v1.PolicyRule) {
+	if p == nil {
+		return
+	}
+	narrowed, removed := PolicyRuleChanges(rules, remaining)
+	p.record(false, source, rule, removed)
+	p.record(true, source+", narrowing a broader nonResourceURL", rule, narrowed)
+}
+
+// Explain returns the history of a verb on a resource of an API group, or on a single object of it when resourceName is set
+// A rule granting every object of the resource also applies to a single object, so both are explained
+func (p *Provenance) Explain(apiGroup string, resource string, resourceName string, verb string) []Explanation {
+	return p.explain(verb, func(key expandedPolicyKey) bool {
+		return key.NonResourceURLs == "" && key.APIGroup == apiGroup && key.Resource == resource && (key.ResourceNames == "" || key.ResourceNames == resourceName)
+	})
+}
+
+// ExplainNonResourceURL returns the history of a verb on a nonResourceURL, including the patterns such as `/apis/*` that match it
+func (p *Provenance) ExplainNonResourceURL(url string, verb string) []Explanation {
+	return p.explain(verb, func(key expandedPolicyKey) bool {
+		return key.NonResourceURLs != "" && nonResourceURLMatches(key.NonResourceURLs, url)
+	})
+}
+
+func (p *Provenance) explain(verb string, matches func(expandedPolicyKey) bool) []Explanation {
+	if p == nil {
+		return nil
+	}
+	explanations := []Explanation{}
+	for key, steps := range p.steps {
+		if !matches(key) {
+			continue
+		}
+		for _, matchingVerb := range []string{verb, "*"} {
+			if history, ok := steps[matchingVerb]; ok {
+				explanations = append(explanations, Explanation{
+					Rule:    policyRuleForKey(key, []string{matchingVerb}),
+					Steps:   history,
+					Granted: history[len(history)-1].Granted,
+				})
+			}
+		}
+	}
+	sort.Slice(explanations, func(i, j int) bool {
+		return compactedRuleLess(explanations[i].Rule, explanations[j].Rule)
+	})
+	return explanations
+}
+
+// maxProvenanceSize bounds the serialized size of the provenance published in the status of a dynamic role, well below the size limit of objects in etcd
+const maxProvenanceSize = 256 * 1024
+
+// LimitedSummary returns the Summary without the histories that would make it larger than maxProvenanceSize once serialized, and how many were left out
+// The full history of any permission can still be explained with `dynamic-rbac explain`
+func (p *Provenance) LimitedSummary() ([]v1alpha1.PermissionProvenance, int) {
+	return limitProvenance(p.Summary(), maxProvenanceSize)
+}
+
+// limitProvenance keeps the histories of a summary, in order, as long as their serialized size fits in maxSize, and returns how many were left out
+func limitProvenance(summary []v1alpha1.PermissionProvenance, maxSize int) ([]v1alpha1.PermissionProvenance, int) {
+	if summary == nil {
+		return nil, 0
+	}
+	limited := []v1alpha1.PermissionProvenance{}
+	size, omitted := 0, 0
+	for _, entry := range summary {
+		serialized, _ := json.Marshal(entry)
+		if size+len(serialized) > maxSize {
+			omitted++
+			continue
+		}
+		size += len(serialized)
+		limited = append(limited, entry)
+	}
+	return limited, omitted
+}
+
+// maxPreviewSize bounds the serialized size of the rules published in the Preview status of a dynamic role, like maxProvenanceSize
+const maxPreviewSize = 256 * 1024
+
+// LimitedPreview returns a copy of a preview without the rules that would make it larger than maxPreviewSize once serialized, counting them in RulesOmitted
+// The added and removed rules are kept first, since they are what reviewers approve, then the computed rules
+// The full rules can still be computed with `dynamic-rbac compute`
+func LimitedPreview(preview *v1alpha1.RulePreview) *v1alpha1.RulePreview {
+	return limitPreview(preview, maxPreviewSize)
+}
+
+// limitPreview keeps the rules of a preview, in order, as long as their serialized size fits in maxSize
+func limitPreview(preview *v1alpha1.RulePreview, maxSize int) *v1alpha1.RulePreview {
+	limited := preview.DeepCopy()
+	size, omitted := 0, 0
+	for _, rules := range []*[]v1.PolicyRule{&limited.Added, &limited.Removed, &limited.Rules} {
+		if *rules == nil {
+			continue
+		}
+		kept := []v1.PolicyRule{}
+		for _, rule := range *rules {
+			serialized, _ := json.Marshal(rule)
+			if size+len(serialized) > maxSize {
+				omitted++
+				continue
+			}
+			size += len(serialized)
+			kept = append(kept, rule)
+		}
+		*rules = kept
+	}
+	limited.RulesOmitted = omitted
+	return limited
+}
+
+// Summary groups the permissions that share the same history, compacted into as few rules as possible, for the status of a dynamic role
+func (p *Provenance) Summary() []v1alpha1.PermissionProvenance {
+	if p == nil {
+		return nil
+	}
+	histories := map[string][]string{}
+	granted := map[string]bool{}
+	rules := map[string][]v1.PolicyRule{}
+	for key, steps := range p.steps {
+		for verb, history := range steps {
+			descriptions := []string{}
+			for _, step := range history {
+				descriptions = append(descriptions, step.String())
+			}
+			signature := strings.Join(descriptions, "\n")
+			histories[signature] = descriptions
+			granted[signature] = history[len(history)-1].Granted
+			rules[signature] = append(rules[signature], policyRuleForKey(key, []string{verb}))
+		}
+	}
+	signatures := []string{}
+	for signature := range histories {
+		signatures = append(signatures, signature)
+	}
+	sort.Strings(signatures)
+	summary := []v1alpha1.PermissionProvenance{}
+	for _, signature := range signatures {
+		summary = append(summary, v1alpha1.PermissionProvenance{
+			Rules:   CompactPolicyRules(rules[signature]),
+			History: histories[signature],
+			Granted: granted[signature],
+		})
+	}
+	return summary
+}
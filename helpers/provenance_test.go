@@ -0,0 +1,193 @@
+package helpers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	v1 "k8s.io/api/rbac/v1"
+)
+
+func TestProvenance(t *testing.T) {
+	inherited := []v1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get", "list"}},
+		{NonResourceURLs: []string{"/apis/*"}, Verbs: []string{"get"}},
+	}
+	deny := v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"*"}}
+	allow := v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"public"}, Verbs: []string{"get"}}
+
+	provenance := NewProvenance()
+	provenance.record(true, "ClusterRole/view", nil, inherited)
+	remaining := []v1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+		{NonResourceURLs: []string{"/apis/*"}, Verbs: []string{"get"}},
+	}
+	provenance.recordDenial("deny[0]", &deny, inherited, remaining)
+	provenance.record(true, "allow[0]", &allow, []v1.PolicyRule{allow})
+
+	tests := []struct {
+		name         string
+		explanations []Explanation
+		want         []string
+		granted      []bool
+	}{
+		{
+			name:         "inherited permission",
+			explanations: provenance.Explain("", "pods", "", "list"),
+			want:         []string{"granted by ClusterRole/view"},
+			granted:      []bool{true},
+		},
+		{
+			name:         "denied permission",
+			explanations: provenance.Explain("", "secrets", "", "list"),
+			want:         []string{"granted by ClusterRole/view", "removed by deny[0]"},
+			granted:      []bool{false},
+		},
+		{
+			name:         "resource name allowed again after the whole resource was denied",
+			explanations: provenance.Explain("", "secrets", "public", "get"),
+			want:         []string{"granted by ClusterRole/view", "removed by deny[0]", "granted by allow[0]"},
+			granted:      []bool{false, true},
+		},
+		{
+			name:         "nonResourceURL matched by a pattern",
+			explanations: provenance.ExplainNonResourceURL("/apis/apps", "get"),
+			want:         []string{"granted by ClusterRole/view"},
+			granted:      []bool{true},
+		},
+		{
+			name:         "permission never granted",
+			explanations: provenance.Explain("apps", "deployments", "", "get"),
+			want:         []string{},
+			granted:      []bool{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			steps := []string{}
+			granted := []bool{}
+			for _, explanation := range test.explanations {
+				for _, step := range explanation.Steps {
+					steps = append(steps, step.String())
+				}
+				granted = append(granted, explanation.Granted)
+			}
+			if !reflect.DeepEqual(steps, test.want) {
+				t.Errorf("steps = %q, want %q", steps, test.want)
+			}
+			if !reflect.DeepEqual(granted, test.granted) {
+				t.Errorf("granted = %v, want %v", granted, test.granted)
+			}
+		})
+	}
+
+	want := []v1alpha1.PermissionProvenance{
+		{
+			Rules:   []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}, {NonResourceURLs: []string{"/apis/*"}, Verbs: []string{"get"}}},
+			History: []string{"granted by ClusterRole/view"},
+			Granted: true,
+		},
+		{
+			Rules:   []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list"}}},
+			History: []string{"granted by ClusterRole/view", "removed by deny[0]"},
+			Granted: false,
+		},
+		{
+			Rules:   []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"public"}, Verbs: []string{"get"}}},
+			History: []string{"granted by allow[0]"},
+			Granted: true,
+		},
+	}
+	if got := provenance.Summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Summary() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNilProvenance(t *testing.T) {
+	var provenance *Provenance
+	provenance.record(true, "allow[0]", nil, []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}})
+	if got := provenance.Explain("", "pods", "", "get"); got != nil {
+		t.Errorf("Explain() = %v, want nil", got)
+	}
+	if got, omitted := provenance.LimitedSummary(); got != nil || omitted != 0 {
+		t.Errorf("LimitedSummary() = %v, %d, want nil, 0", got, omitted)
+	}
+}
+
+func TestLimitProvenance(t *testing.T) {
+	summary := []v1alpha1.PermissionProvenance{
+		{Rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}}, History: []string{"granted by allow[0]"}, Granted: true},
+		{Rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}}, History: []string{"granted by ClusterRole/view", "removed by deny[0]"}},
+		{Rules: []v1.PolicyRule{{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}}, History: []string{"granted by allow[1]"}, Granted: true},
+	}
+	sizes := []int{}
+	for _, entry := range summary {
+		serialized, _ := json.Marshal(entry)
+		sizes = append(sizes, len(serialized))
+	}
+
+	tests := []struct {
+		name        string
+		maxSize     int
+		wantKept    []v1alpha1.PermissionProvenance
+		wantOmitted int
+	}{
+		{"everything fits", sizes[0] + sizes[1] + sizes[2], summary, 0},
+		{"a later, smaller history still fits", sizes[0] + sizes[2], []v1alpha1.PermissionProvenance{summary[0], summary[2]}, 1},
+		{"nothing fits", 1, []v1alpha1.PermissionProvenance{}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kept, omitted := limitProvenance(summary, test.maxSize)
+			if !reflect.DeepEqual(kept, test.wantKept) || omitted != test.wantOmitted {
+				t.Errorf("limitProvenance() = %+v, %d, want %+v, %d", kept, omitted, test.wantKept, test.wantOmitted)
+			}
+		})
+	}
+}
+
+func TestLimitPreview(t *testing.T) {
+	pods := v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}
+	secrets := v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}
+	healthz := v1.PolicyRule{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}
+	preview := &v1alpha1.RulePreview{
+		Rules:              []v1.PolicyRule{pods, healthz},
+		Added:              []v1.PolicyRule{healthz},
+		Removed:            []v1.PolicyRule{secrets},
+		PermissionsAdded:   1,
+		PermissionsRemoved: 1,
+	}
+	size := func(rule v1.PolicyRule) int {
+		serialized, _ := json.Marshal(rule)
+		return len(serialized)
+	}
+
+	tests := []struct {
+		name    string
+		maxSize int
+		want    *v1alpha1.RulePreview
+	}{
+		{"everything fits", 2*size(healthz) + size(secrets) + size(pods), preview},
+		{
+			"the added and removed rules are kept first",
+			size(healthz) + size(secrets) + size(pods),
+			&v1alpha1.RulePreview{Rules: []v1.PolicyRule{pods}, Added: []v1.PolicyRule{healthz}, Removed: []v1.PolicyRule{secrets}, PermissionsAdded: 1, PermissionsRemoved: 1, RulesOmitted: 1},
+		},
+		{
+			"nothing fits",
+			1,
+			&v1alpha1.RulePreview{Rules: []v1.PolicyRule{}, Added: []v1.PolicyRule{}, Removed: []v1.PolicyRule{}, PermissionsAdded: 1, PermissionsRemoved: 1, RulesOmitted: 4},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := limitPreview(preview, test.maxSize); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("limitPreview() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+	if len(preview.Rules) != 2 || preview.RulesOmitted != 0 {
+		t.Errorf("limitPreview() changed the preview it was given to %+v", preview)
+	}
+}
@@ -1,36 +1,142 @@
 package helpers
 
 import (
+	"fmt"
 	"sync"
 
 	rbacv1 "k8s.io/api/rbac/v1"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
-var lock = &sync.Mutex{}
+var once = &sync.Once{}
+
+// DiscoverySnapshot is an immutable view of every resource and verb the cluster served when discovery was last refreshed
+// A dynamic role is computed from a single snapshot, so a refresh happening concurrently never mixes two views of the cluster
+type DiscoverySnapshot struct {
+	// Version increases every time discovery is refreshed, so that computed roles can record which snapshot they were built from
+	Version int64
+	// Rules holds one expanded rule per API group, resource and its verbs; it must not be modified
+	Rules []rbacv1.PolicyRule
+	// StaleGroups are the API groups that could not be discovered, whose resources are retained from the previous snapshot
+	StaleGroups []string
+}
 
 // ResourceCache holds information about the kube cluster state and
 // its policies so that it doesn't need to be queried for every reconciliation.
+// It is shared by every controller and is safe for concurrent use.
 type ResourceCache struct {
-	CRDs                map[string]string
-	AllPolicies         *[]rbacv1.PolicyRule
-	WatchedRoles        map[types.NamespacedName]bool
-	WatchedClusterRoles map[types.NamespacedName]bool
+	lock        sync.RWMutex
+	refreshLock sync.Mutex
+	crds        map[string]string
+	apiServices map[string]bool
+	discovery   *DiscoverySnapshot
+	// Dependencies is synchronised on its own
+	Dependencies *DependencyIndex
+}
+
+// RoleSelector describes a set of Roles inherited by label, limited to a single namespace or to the namespaces matching a selector
+type RoleSelector struct {
+	Selector          labels.Selector
+	Namespace         string
+	NamespaceSelector labels.Selector
+}
+
+// Key returns a string that uniquely identifies the set of Roles selected
+func (s RoleSelector) Key() string {
+	if s.NamespaceSelector != nil {
+		return fmt.Sprintf("%s|namespaces:%s", s.Selector.String(), s.NamespaceSelector.String())
+	}
+	return fmt.Sprintf("%s|namespace:%s", s.Selector.String(), s.Namespace)
 }
 
 var instance *ResourceCache
 
 // GetCacheInstance returns or instantiates a ResourceCache
 func GetCacheInstance() *ResourceCache {
-	if instance == nil {
-		lock.Lock()
-		defer lock.Unlock()
-		if instance == nil {
-			instance = &ResourceCache{}
-			instance.CRDs = map[string]string{}
-			instance.WatchedRoles = map[types.NamespacedName]bool{}
-			instance.WatchedClusterRoles = map[types.NamespacedName]bool{}
+	once.Do(func() {
+		instance = NewResourceCache()
+	})
+	return instance
+}
+
+// NewResourceCache returns an empty cache with an empty discovery snapshot
+func NewResourceCache() *ResourceCache {
+	return &ResourceCache{
+		crds:         map[string]string{},
+		apiServices:  map[string]bool{},
+		discovery:    &DiscoverySnapshot{Rules: []rbacv1.PolicyRule{}},
+		Dependencies: NewDependencyIndex(),
+	}
+}
+
+// Discovery returns the current discovery snapshot
+func (c *ResourceCache) Discovery() *DiscoverySnapshot {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.discovery
+}
+
+// RefreshDiscovery replaces the discovery snapshot with the rules returned by discover and returns the previous and new snapshots
+// discover also returns the API groups that could not be discovered. Their resources are retained from the previous snapshot,
+// so that a single broken aggregated API does not remove its permissions from every generated role, and they are marked stale
+// Refreshes are serialised, so a slow discovery can never overwrite the result of one that started after it
+func (c *ResourceCache) RefreshDiscovery(discover func() ([]rbacv1.PolicyRule, []string, error)) (*DiscoverySnapshot, *DiscoverySnapshot, error) {
+	c.refreshLock.Lock()
+	defer c.refreshLock.Unlock()
+	rules, failedGroups, err := discover()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	previous := c.discovery
+	if len(failedGroups) > 0 {
+		retained := []rbacv1.PolicyRule{}
+		for _, rule := range previous.Rules {
+			if stringInSlice(failedGroups, rule.APIGroups[0]) {
+				retained = append(retained, rule)
+			}
 		}
+		rules = MergeExpandedPolicyRules(rules, retained)
 	}
-	return instance
+	c.discovery = &DiscoverySnapshot{Version: previous.Version + 1, Rules: rules, StaleGroups: failedGroups}
+	return previous, c.discovery, nil
+}
+
+// SetCRDFingerprint records the fingerprint of a CRD and returns true if it is new or differs from the recorded one
+func (c *ResourceCache) SetCRDFingerprint(name string, fingerprint string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if previous, ok := c.crds[name]; ok && previous == fingerprint {
+		return false
+	}
+	c.crds[name] = fingerprint
+	return true
+}
+
+// DeleteCRD forgets the fingerprint of a deleted CRD
+func (c *ResourceCache) DeleteCRD(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.crds, name)
+}
+
+// SetAPIServiceAvailable records the availability of an APIService and returns true if it is new or its availability changed
+func (c *ResourceCache) SetAPIServiceAvailable(name string, available bool) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if wasAvailable, ok := c.apiServices[name]; ok && wasAvailable == available {
+		return false
+	}
+	c.apiServices[name] = available
+	return true
+}
+
+// DeleteAPIService forgets a deleted APIService and returns whether it was known, and if so whether it was available
+func (c *ResourceCache) DeleteAPIService(name string) (known bool, available bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	available, known = c.apiServices[name]
+	delete(c.apiServices, name)
+	return known, available
 }
@@ -0,0 +1,177 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+func TestRefreshDiscovery(t *testing.T) {
+	pods := v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}
+	deployments := v1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "list"}}
+	metrics := v1.PolicyRule{APIGroups: []string{"metrics.k8s.io"}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}
+	routes := v1.PolicyRule{APIGroups: []string{"route.openshift.io"}, Resources: []string{"routes"}, Verbs: []string{"get"}}
+
+	tests := []struct {
+		name        string
+		rules       []v1.PolicyRule
+		failed      []string
+		err         error
+		wantRules   []v1.PolicyRule
+		wantStale   []string
+		wantVersion int64
+	}{
+		{
+			name:        "full discovery",
+			rules:       []v1.PolicyRule{pods, deployments, metrics},
+			wantRules:   []v1.PolicyRule{pods, deployments, metrics},
+			wantVersion: 1,
+		},
+		{
+			name:        "failed group is retained and marked stale",
+			rules:       []v1.PolicyRule{pods, deployments},
+			failed:      []string{"metrics.k8s.io"},
+			wantRules:   []v1.PolicyRule{pods, deployments, metrics},
+			wantStale:   []string{"metrics.k8s.io"},
+			wantVersion: 2,
+		},
+		{
+			name:        "error leaves the snapshot unchanged",
+			rules:       []v1.PolicyRule{pods},
+			err:         errors.New("discovery failed"),
+			wantRules:   []v1.PolicyRule{pods, deployments, metrics},
+			wantStale:   []string{"metrics.k8s.io"},
+			wantVersion: 2,
+		},
+		{
+			name:        "removed groups are dropped once discovery succeeds",
+			rules:       []v1.PolicyRule{pods, routes},
+			wantRules:   []v1.PolicyRule{pods, routes},
+			wantVersion: 3,
+		},
+		{
+			name:        "a group that never was discovered is not invented",
+			rules:       []v1.PolicyRule{pods},
+			failed:      []string{"apps"},
+			wantRules:   []v1.PolicyRule{pods},
+			wantStale:   []string{"apps"},
+			wantVersion: 4,
+		},
+	}
+
+	cache := NewResourceCache()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := cache.Discovery()
+			previous, current, err := cache.RefreshDiscovery(func() ([]v1.PolicyRule, []string, error) {
+				return test.rules, test.failed, test.err
+			})
+			if (err != nil) != (test.err != nil) {
+				t.Fatalf("RefreshDiscovery() error = %v, want %v", err, test.err)
+			}
+			if err == nil && (previous != before || current != cache.Discovery()) {
+				t.Errorf("RefreshDiscovery() did not return the previous and new snapshots")
+			}
+			snapshot := cache.Discovery()
+			expectRules(t, snapshot.Rules, test.wantRules)
+			if !reflect.DeepEqual(snapshot.StaleGroups, test.wantStale) {
+				t.Errorf("StaleGroups = %v, want %v", snapshot.StaleGroups, test.wantStale)
+			}
+			if snapshot.Version != test.wantVersion {
+				t.Errorf("Version = %d, want %d", snapshot.Version, test.wantVersion)
+			}
+		})
+	}
+}
+
+// TestResourceCacheConcurrency refreshes discovery while dynamic roles are computed from it and their dependencies are indexed, as controllers
+// running with MaxConcurrentReconciles > 1 do; run it with -race
+func TestResourceCacheConcurrency(t *testing.T) {
+	const refreshes, readers = 50, 8
+	cache := NewResourceCache()
+	// Every refresh serves a single resource named after the version of the snapshot it ends up in, so that a torn snapshot is detected
+	refreshed := 0
+	discover := func() ([]v1.PolicyRule, []string, error) {
+		refreshed++
+		return []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{fmt.Sprintf("resource-%d", refreshed)}, Verbs: []string{"get"}}}, nil, nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, refreshes+readers)
+	for i := 0; i < refreshes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, _, err := cache.RefreshDiscovery(discover); err != nil {
+				errs <- err
+			}
+			cache.SetCRDFingerprint(fmt.Sprintf("crd-%d", i%5), fmt.Sprint(i))
+			cache.SetAPIServiceAvailable(fmt.Sprintf("apiservice-%d", i%5), i%2 == 0)
+		}(i)
+	}
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dependant := Dependant{Kind: "DynamicRole", Namespace: "team-a", Name: fmt.Sprintf("reader-%d", i)}
+			lastVersion := int64(0)
+			for j := 0; j < refreshes; j++ {
+				discovery := cache.Discovery()
+				if discovery.Version < lastVersion {
+					errs <- fmt.Errorf("discovery went back from version %d to %d", lastVersion, discovery.Version)
+					return
+				}
+				lastVersion = discovery.Version
+				dependencies := NewDependencies()
+				rules, _, err := buildPolicyRules(BuildContext{Discovery: discovery, Dependencies: dependencies}, Role, "team-a", RuleSpec{Allow: &[]v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"*"}, Verbs: []string{"get"}}}}, nil)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if want := fmt.Sprintf("resource-%d", discovery.Version); discovery.Version > 0 && ((*rules)[0].Resources[0] != want || len(*rules) != 1) {
+					errs <- fmt.Errorf("the rules computed from discovery version %d are %v, want %s only", discovery.Version, *rules, want)
+					return
+				}
+				cache.Dependencies.Set(dependant, dependencies)
+				cache.Dependencies.DependantsOfAPIGroups([]string{""})
+			}
+			cache.Dependencies.Remove(dependant)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if version := cache.Discovery().Version; version != refreshes {
+		t.Errorf("discovery version = %d after %d refreshes", version, refreshes)
+	}
+	if count := cache.Dependencies.Count("DynamicRole"); count != 0 {
+		t.Errorf("%d dependants left in the index after every one was removed", count)
+	}
+}
+
+func TestDeleteAPIService(t *testing.T) {
+	cache := NewResourceCache()
+	cache.SetAPIServiceAvailable("v1beta1.metrics.k8s.io", false)
+	cache.SetAPIServiceAvailable("v1.packages.operators.coreos.com", true)
+	tests := []struct {
+		name          string
+		wantKnown     bool
+		wantAvailable bool
+	}{
+		{"v1beta1.metrics.k8s.io", true, false},
+		{"v1.packages.operators.coreos.com", true, true},
+		{"v1.packages.operators.coreos.com", false, false},
+		{"v1.unknown.example.com", false, false},
+	}
+	for _, test := range tests {
+		if known, available := cache.DeleteAPIService(test.name); known != test.wantKnown || available != test.wantAvailable {
+			t.Errorf("DeleteAPIService(%q) = %v, %v, want known %v and available %v", test.name, known, available, test.wantKnown, test.wantAvailable)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package helpers
+
+import (
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+// compactionKey groups the rules that can be merged into a single PolicyRule by one of the compaction passes
+type compactionKey struct {
+	first  string
+	second string
+	verbs  string
+	// named keeps the rules restricted to resourceNames apart from the ones granting every object of a resource
+	named bool
+}
+
+// CompactPolicyRules regroups a ruleset into as few PolicyRules as possible without changing the permissions it grants
+// Resource names are merged for the same resource, then resources sharing the same resource names and verbs, then API groups sharing
+// the same resources, resource names and verbs, and finally nonResourceURLs sharing the same verbs. The output is sorted, so it is stable across reconciles.
+func CompactPolicyRules(rules []v1.PolicyRule) []v1.PolicyRule {
+	expanded := NormalizePolicyRules(rules)
+
+	nonResourceURLs := map[string][]string{}
+	byResource := map[compactionKey][]string{}
+	for _, rule := range expanded {
+		verbs := strings.Join(rule.Verbs, ",")
+		if len(rule.NonResourceURLs) > 0 {
+			nonResourceURLs[verbs] = append(nonResourceURLs[verbs], rule.NonResourceURLs...)
+			continue
+		}
+		key := compactionKey{first: rule.APIGroups[0], second: rule.Resources[0], verbs: verbs, named: len(rule.ResourceNames) > 0}
+		byResource[key] = append(byResource[key], rule.ResourceNames...)
+	}
+
+	// Merge the resources of an API group that have the same resource names and verbs
+	byGroup := map[compactionKey][]string{}
+	for key, resourceNames := range byResource {
+		sort.Strings(resourceNames)
+		groupKey := compactionKey{first: key.first, second: strings.Join(resourceNames, ","), verbs: key.verbs}
+		byGroup[groupKey] = append(byGroup[groupKey], key.second)
+	}
+
+	// Merge the API groups that have the same resources, resource names and verbs
+	byResources := map[compactionKey][]string{}
+	for key, resources := range byGroup {
+		sort.Strings(resources)
+		resourcesKey := compactionKey{first: strings.Join(resources, ","), second: key.second, verbs: key.verbs}
+		byResources[resourcesKey] = append(byResources[resourcesKey], key.first)
+	}
+
+	compacted := []v1.PolicyRule{}
+	for key, groups := range byResources {
+		sort.Strings(groups)
+		rule := v1.PolicyRule{
+			APIGroups: groups,
+			Resources: strings.Split(key.first, ","),
+			Verbs:     strings.Split(key.verbs, ","),
+		}
+		if key.second != "" {
+			rule.ResourceNames = strings.Split(key.second, ",")
+		}
+		compacted = append(compacted, rule)
+	}
+	for verbs, urls := range nonResourceURLs {
+		sort.Strings(urls)
+		compacted = append(compacted, v1.PolicyRule{
+			NonResourceURLs: urls,
+			Verbs:           strings.Split(verbs, ","),
+		})
+	}
+	sort.Slice(compacted, func(i, j int) bool {
+		return compactedRuleLess(compacted[i], compacted[j])
+	})
+	return compacted
+}
+
+// compactedRuleLess orders compacted rules by API groups, resources, resource names and verbs, followed by nonResourceURLs
+func compactedRuleLess(a v1.PolicyRule, b v1.PolicyRule) bool {
+	if (len(a.NonResourceURLs) > 0) != (len(b.NonResourceURLs) > 0) {
+		return len(a.NonResourceURLs) == 0
+	}
+	for _, fields := range [][2][]string{
+		{a.APIGroups, b.APIGroups},
+		{a.Resources, b.Resources},
+		{a.ResourceNames, b.ResourceNames},
+		{a.NonResourceURLs, b.NonResourceURLs},
+		{a.Verbs, b.Verbs},
+	} {
+		if compared := compareStringSlices(fields[0], fields[1]); compared != 0 {
+			return compared < 0
+		}
+	}
+	return false
+}
+
+// compareStringSlices compares two sorted string slices element by element, with a shorter slice ordered before a longer one it is a prefix of
+func compareStringSlices(a []string, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return strings.Compare(a[i], b[i])
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,89 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+func TestCompactPolicyRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []v1.PolicyRule
+		want  []v1.PolicyRule
+	}{
+		{
+			name: "resources with the same verbs",
+			rules: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"list", "get"}},
+			},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"configmaps", "pods"}, Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			name: "API groups with the same resources and verbs",
+			rules: []v1.PolicyRule{
+				{APIGroups: []string{"extensions"}, Resources: []string{"deployments"}, Verbs: []string{"get"}},
+				{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}},
+			},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{"apps", "extensions"}, Resources: []string{"deployments"}, Verbs: []string{"get"}},
+			},
+		},
+		{
+			name: "resources with different verbs are kept apart",
+			rules: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get"}},
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}},
+			},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+			},
+		},
+		{
+			name: "resource names are kept apart from the whole resource",
+			rules: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"b"}, Verbs: []string{"get"}},
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"a"}, Verbs: []string{"get"}},
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a", "b"}, Verbs: []string{"get"}},
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+			},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"configmaps", "secrets"}, ResourceNames: []string{"a", "b"}, Verbs: []string{"get"}},
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+			},
+		},
+		{
+			name: "nonResourceURLs with the same verbs",
+			rules: []v1.PolicyRule{
+				{NonResourceURLs: []string{"/readyz"}, Verbs: []string{"get"}},
+				{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}},
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+			},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+				{NonResourceURLs: []string{"/healthz", "/readyz"}, Verbs: []string{"get"}},
+			},
+		},
+		{
+			name:  "empty",
+			rules: []v1.PolicyRule{},
+			want:  []v1.PolicyRule{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := CompactPolicyRules(test.rules)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("CompactPolicyRules() =\n%s\nwant\n%s", describeRules(got), describeRules(test.want))
+			}
+			if RulesHash(got) != RulesHash(test.rules) {
+				t.Errorf("CompactPolicyRules() changed the permissions granted:\n%s", describeRules(got))
+			}
+		})
+	}
+}
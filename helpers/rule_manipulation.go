@@ -3,6 +3,7 @@ package helpers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/jinzhu/copier"
@@ -15,167 +16,377 @@ import (
 
 type RoleType int
 
+// InheritanceCycleError is returned when dynamic roles inherit from each other in a loop
+type InheritanceCycleError struct {
+	Chain []string
+}
+
+func (e *InheritanceCycleError) Error() string {
+	return fmt.Sprintf("inheritance cycle detected: %s", strings.Join(e.Chain, " -> "))
+}
+
+// DynamicRoleLink identifies a DynamicRole in inheritance chains and provenance, e.g. `DynamicRole/team-a/developer`
+func DynamicRoleLink(namespace string, name string) string {
+	return fmt.Sprintf("DynamicRole/%s/%s", namespace, name)
+}
+
+// DynamicClusterRoleLink identifies a DynamicClusterRole in inheritance chains and provenance, e.g. `DynamicClusterRole/base`
+func DynamicClusterRoleLink(name string) string {
+	return fmt.Sprintf("DynamicClusterRole/%s", name)
+}
+
+// IsInheritanceCycle returns true if the error was caused by dynamic roles inheriting from each other in a loop
+func IsInheritanceCycle(err error) bool {
+	_, ok := err.(*InheritanceCycleError)
+	return ok
+}
+
+// nonResourceURLVerbs are the verbs the API server checks against nonResourceURLs, which are the lowercased HTTP methods
+var nonResourceURLVerbs = []string{"get", "post", "put", "patch", "delete", "head", "options"}
+
 const (
 	Role RoleType = iota
 	ClusterRole
 )
 
-// BuildPolicyRules takes an inherited role, an allow list, and a deny list; and processes everything into a list of policy rules
-func BuildPolicyRules(client client.Client, cache ResourceCache, roleType RoleType, forNamespace string, inherit *[]v1alpha1.InheritedRole, allow *[]v1.PolicyRule, deny *[]v1.PolicyRule) (*[]v1.PolicyRule, error) {
+// RuleSpec holds the fields of a DynamicRole or DynamicClusterRole spec that its rules are computed from
+type RuleSpec struct {
+	Inherit *[]v1alpha1.InheritedRole
+	Allow   *[]v1.PolicyRule
+	Deny    *[]v1.PolicyRule
+	// DenySubresources makes a deny rule naming a parent resource (e.g. `pods`) also deny all of its subresources (e.g. `pods/exec`)
+	DenySubresources bool
+	// Precedence is DenyOverrides to apply the deny rules after the allow rules, so that they also remove permissions granted by the allow rules
+	Precedence v1alpha1.Precedence
+}
+
+// DynamicRoleRuleSpec returns the fields of a DynamicRole spec that its rules are computed from
+func DynamicRoleRuleSpec(spec *v1alpha1.DynamicRoleSpec) RuleSpec {
+	return RuleSpec{Inherit: spec.Inherit, Allow: spec.Allow, Deny: spec.Deny, DenySubresources: spec.DenySubresources, Precedence: spec.Precedence}
+}
+
+// DynamicClusterRoleRuleSpec returns the fields of a DynamicClusterRole spec that its rules are computed from
+func DynamicClusterRoleRuleSpec(spec *v1alpha1.DynamicClusterRoleSpec) RuleSpec {
+	return RuleSpec{Inherit: spec.Inherit, Allow: spec.Allow, Deny: spec.Deny, DenySubresources: spec.DenySubresources, Precedence: spec.Precedence}
+}
+
+// BuildContext holds what the rules of a dynamic role are computed against, and what is recorded while computing them
+type BuildContext struct {
+	// Client reads the roles and dynamic roles that are inherited from, and the cluster's DynamicRBACPolicies
+	Client client.Client
+	// Discovery is the single snapshot patterns are resolved against, so that a concurrent refresh cannot change the outcome halfway through
+	Discovery *DiscoverySnapshot
+	// Dependencies records everything the rules were computed from, even when an error is returned, so that fixing the error triggers recomputation
+	Dependencies *Dependencies
+	// Provenance, when not nil, records the source that granted or removed each permission
+	Provenance *Provenance
+}
+
+// BuildPolicyRules takes the inherited roles, allow list and deny list of a spec, and processes everything into a list of policy rules
+// The deny rules are applied before the allow rules, unless the precedence is DenyOverrides
+// The roles that were actually inherited from are returned alongside the rules, with any defaulted namespace filled in
+// self identifies the dynamic role being computed (see funcs `DynamicRoleLink` and `DynamicClusterRoleLink`), and starts the chain of an InheritanceCycleError
+// The cluster's DynamicRBACPolicies are applied last, so that no inherit or allow rule can grant what they forbid
+func BuildPolicyRules(build BuildContext, self string, roleType RoleType, forNamespace string, spec RuleSpec) (*[]v1.PolicyRule, []v1alpha1.InheritedRole, error) {
+	rules, inheritedRoles, err := buildPolicyRules(build, roleType, forNamespace, spec, []string{self})
+	if err != nil {
+		return nil, nil, err
+	}
+	guardedRules, err := applyDynamicRBACPolicies(build.Client, build.Discovery, *rules, build.Provenance)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &guardedRules, inheritedRoles, nil
+}
+
+// buildPolicyRules does the work of BuildPolicyRules, keeping track of the chain of dynamic roles currently being computed so that inheritance cycles are detected
+func buildPolicyRules(build BuildContext, roleType RoleType, forNamespace string, spec RuleSpec, chain []string) (*[]v1.PolicyRule, []v1alpha1.InheritedRole, error) {
+	client, discovery, dependencies, provenance := build.Client, build.Discovery, build.Dependencies, build.Provenance
+	inherit, allow, deny := spec.Inherit, spec.Allow, spec.Deny
+	// The permissions of an inherited dynamic role are recorded as a single source, so its own provenance is not
+	inheritedBuild := build
+	inheritedBuild.Provenance = nil
+
 	rules := []v1.PolicyRule{}
+	inheritedRoles := []v1alpha1.InheritedRole{}
+
+	for _, ruleList := range []*[]v1.PolicyRule{allow, deny} {
+		if ruleList == nil {
+			continue
+		}
+		if err := ValidateRulePatterns(*ruleList); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	if inherit != nil {
 		for _, roleToInherit := range *inherit {
 			switch roleToInherit.Kind {
 			case "ClusterRole":
-				inheritedClusterRole := &v1.ClusterRole{}
-				clusterRoleNamespacedName := types.NamespacedName{Name: roleToInherit.Name}
-				err := client.Get(context.TODO(), clusterRoleNamespacedName, inheritedClusterRole)
+				inheritedClusterRoles, err := ResolveInheritedClusterRoles(client, dependencies, roleToInherit)
+				if err != nil {
+					return nil, nil, err
+				}
+				for _, inheritedClusterRole := range inheritedClusterRoles {
+					dependencies.ClusterRoles[inheritedClusterRole.Name] = true
+					inheritedRoles = append(inheritedRoles, v1alpha1.InheritedRole{Name: inheritedClusterRole.Name, Kind: roleToInherit.Kind})
+					dependencies.addRuleGroups(inheritedClusterRole.Rules)
+					var enumeratedPolicyRules []v1.PolicyRule
+					if roleType == Role {
+						// nonResourceURLs do not make sense to move from a ClusterRole to a Role
+						enumeratedPolicyRules, err = EnumeratePolicyRules(StripNonResourceURLs(inheritedClusterRole.Rules), discovery)
+					} else {
+						enumeratedPolicyRules, err = EnumeratePolicyRules(inheritedClusterRole.Rules, discovery)
+					}
+					if err != nil {
+						return nil, nil, err
+					}
+					expandedPolicyRules := ExpandPolicyRules(enumeratedPolicyRules)
+					provenance.record(true, fmt.Sprintf("ClusterRole/%s", inheritedClusterRole.Name), nil, expandedPolicyRules)
+					rules = MergeExpandedPolicyRules(rules, expandedPolicyRules)
+				}
+			case "Role":
+				if roleType == ClusterRole && roleToInherit.Namespace == "" && roleToInherit.NamespaceSelector == nil {
+					return nil, nil, errors.New("a Cluster Role cannot inherit from a Role without a namespace specified")
+				}
+				inheritedRoleList, err := ResolveInheritedRoles(client, dependencies, roleToInherit, forNamespace)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
+				}
+				for _, inheritedRole := range inheritedRoleList {
+					dependencies.Roles[types.NamespacedName{Name: inheritedRole.Name, Namespace: inheritedRole.Namespace}] = true
+					inheritedRoles = append(inheritedRoles, v1alpha1.InheritedRole{Name: inheritedRole.Name, Kind: roleToInherit.Kind, Namespace: inheritedRole.Namespace})
+					dependencies.addRuleGroups(inheritedRole.Rules)
+					enumeratedPolicyRules, err := EnumeratePolicyRules(inheritedRole.Rules, discovery)
+					if err != nil {
+						return nil, nil, err
+					}
+					expandedPolicyRules := ExpandPolicyRules(enumeratedPolicyRules)
+					provenance.record(true, fmt.Sprintf("Role/%s/%s", inheritedRole.Namespace, inheritedRole.Name), nil, expandedPolicyRules)
+					rules = MergeExpandedPolicyRules(rules, expandedPolicyRules)
+				}
+			case "DynamicClusterRole":
+				if roleToInherit.LabelSelector != nil {
+					return nil, nil, errors.New("label selectors can only be used to inherit from Cluster Roles and Roles")
+				}
+				dependencies.DynamicClusterRoles[roleToInherit.Name] = true
+				inheritedDynamicClusterRole := &v1alpha1.DynamicClusterRole{}
+				err := client.Get(context.TODO(), types.NamespacedName{Name: roleToInherit.Name}, inheritedDynamicClusterRole)
+				if err != nil {
+					return nil, nil, err
+				}
+				link := DynamicClusterRoleLink(roleToInherit.Name)
+				if stringInSlice(chain, link) {
+					return nil, nil, &InheritanceCycleError{Chain: append(append([]string{}, chain...), link)}
+				}
+				inheritedRoles = append(inheritedRoles, v1alpha1.InheritedRole{Name: roleToInherit.Name, Kind: roleToInherit.Kind})
+				inheritedSpec := inheritedDynamicClusterRole.Spec
+				var inheritedRules *[]v1.PolicyRule
+				if inheritedSpec.Mode == v1alpha1.ModePreview {
+					// A spec in Preview has not been approved yet, so the rules currently enforced by its generated role are inherited instead
+					generatedRules, err := GeneratedClusterRoleRules(client, inheritedDynamicClusterRole)
+					if err != nil {
+						return nil, nil, err
+					}
+					generatedRules = ExpandPolicyRules(generatedRules)
+					inheritedRules = &generatedRules
+				} else {
+					inheritedRules, _, err = buildPolicyRules(inheritedBuild, ClusterRole, "", DynamicClusterRoleRuleSpec(&inheritedSpec), append(append([]string{}, chain...), link))
+					if err != nil {
+						return nil, nil, err
+					}
 				}
-				cache.WatchedClusterRoles[clusterRoleNamespacedName] = true
-				var enumeratedPolicyRules []v1.PolicyRule
 				if roleType == Role {
 					// nonResourceURLs do not make sense to move from a ClusterRole to a Role
-					enumeratedPolicyRules, err = EnumeratePolicyRules(StripNonResourceURLs(inheritedClusterRole.Rules), &cache)
-				} else {
-					enumeratedPolicyRules, err = EnumeratePolicyRules(inheritedClusterRole.Rules, &cache)
+					stripped := StripNonResourceURLs(*inheritedRules)
+					inheritedRules = &stripped
+				}
+				provenance.record(true, link, nil, *inheritedRules)
+				rules = MergeExpandedPolicyRules(rules, *inheritedRules)
+			case "DynamicRole":
+				if roleToInherit.LabelSelector != nil {
+					return nil, nil, errors.New("label selectors can only be used to inherit from Cluster Roles and Roles")
 				}
-				expandedPolicyRules := ExpandPolicyRules(enumeratedPolicyRules)
-				rules = MergeExpandedPolicyRules(rules, expandedPolicyRules)
-			case "Role":
 				if roleType == ClusterRole && roleToInherit.Namespace == "" {
-					return nil, errors.New("a Cluster Role cannot inherit from a Role without a namespace specified")
+					return nil, nil, errors.New("a Cluster Role cannot inherit from a Dynamic Role without a namespace specified")
 				}
 				useNamespace := forNamespace
 				if roleToInherit.Namespace != "" {
 					useNamespace = roleToInherit.Namespace
 				}
-				inheritedRole := &v1.Role{}
-				roleNamespacedName := types.NamespacedName{Name: roleToInherit.Name, Namespace: useNamespace}
-				err := client.Get(context.TODO(), roleNamespacedName, inheritedRole)
+				dynamicRoleNamespacedName := types.NamespacedName{Name: roleToInherit.Name, Namespace: useNamespace}
+				dependencies.DynamicRoles[dynamicRoleNamespacedName] = true
+				inheritedDynamicRole := &v1alpha1.DynamicRole{}
+				err := client.Get(context.TODO(), dynamicRoleNamespacedName, inheritedDynamicRole)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
+				}
+				link := DynamicRoleLink(useNamespace, roleToInherit.Name)
+				if stringInSlice(chain, link) {
+					return nil, nil, &InheritanceCycleError{Chain: append(append([]string{}, chain...), link)}
+				}
+				inheritedRoles = append(inheritedRoles, v1alpha1.InheritedRole{Name: roleToInherit.Name, Kind: roleToInherit.Kind, Namespace: useNamespace})
+				inheritedSpec := inheritedDynamicRole.Spec
+				var inheritedRules *[]v1.PolicyRule
+				if inheritedSpec.Mode == v1alpha1.ModePreview {
+					// A spec in Preview has not been approved yet, so the rules currently enforced by its generated role are inherited instead
+					generatedRules, err := GeneratedRoleRules(client, inheritedDynamicRole)
+					if err != nil {
+						return nil, nil, err
+					}
+					generatedRules = ExpandPolicyRules(generatedRules)
+					inheritedRules = &generatedRules
+				} else {
+					inheritedRules, _, err = buildPolicyRules(inheritedBuild, Role, useNamespace, DynamicRoleRuleSpec(&inheritedSpec), append(append([]string{}, chain...), link))
+					if err != nil {
+						return nil, nil, err
+					}
 				}
-				cache.WatchedRoles[roleNamespacedName] = true
-				enumeratedPolicyRules, err := EnumeratePolicyRules(inheritedRole.Rules, &cache)
-				expandedPolicyRules := ExpandPolicyRules(enumeratedPolicyRules)
-				rules = MergeExpandedPolicyRules(rules, expandedPolicyRules)
+				provenance.record(true, link, nil, *inheritedRules)
+				rules = MergeExpandedPolicyRules(rules, *inheritedRules)
+			default:
+				return nil, nil, fmt.Errorf("cannot inherit from unknown kind %q, must be one of %s", roleToInherit.Kind, strings.Join(InheritableKinds, ", "))
 			}
 		}
 	}
 
-	if deny != nil {
-		rules = ApplyDenyRulesToExpandedRuleset(rules, *deny)
+	applyDeny := func() {
+		if deny == nil {
+			return
+		}
+		denyRules := *deny
+		if spec.DenySubresources {
+			denyRules = AddSubresourcesToRules(denyRules)
+		}
+		dependencies.addRuleGroups(denyRules)
+		recordDenyProvenance(provenance, discovery, rules, *deny, spec.DenySubresources)
+		var narrowedPatterns []string
+		rules, narrowedPatterns = applyDenyRules(rules, denyRules, discovery)
+		dependencies.addNarrowedNonResourceURLs(narrowedPatterns)
+	}
+
+	if spec.Precedence != v1alpha1.PrecedenceDenyOverrides {
+		applyDeny()
 	}
 
 	if allow != nil {
-		allowRules, err := EnumeratePolicyRules(*allow, &cache)
+		allowRulesToEnumerate := *allow
+		if roleType == Role {
+			allowRulesToEnumerate = StripNonResourceURLs(allowRulesToEnumerate)
+		}
+		dependencies.addRuleGroups(allowRulesToEnumerate)
+		allowRules, err := EnumeratePolicyRules(allowRulesToEnumerate, discovery)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		recordAllowProvenance(provenance, *allow, roleType, discovery)
 		rules = MergeExpandedPolicyRules(rules, ExpandPolicyRules(allowRules))
 	}
 
-	return &rules, nil
+	if spec.Precedence == v1alpha1.PrecedenceDenyOverrides {
+		applyDeny()
+	}
+
+	rules = NormalizePolicyRules(rules)
+	return &rules, inheritedRoles, nil
+}
+
+// recordDenyProvenance applies the deny rules one at a time, recording the permissions each of them removes as `deny[i]`
+func recordDenyProvenance(provenance *Provenance, discovery *DiscoverySnapshot, rules []v1.PolicyRule, deny []v1.PolicyRule, denySubresources bool) {
+	if provenance == nil {
+		return
+	}
+	for i := range deny {
+		denyRules := []v1.PolicyRule{deny[i]}
+		if denySubresources {
+			denyRules = AddSubresourcesToRules(denyRules)
+		}
+		remaining := ApplyDenyRulesToExpandedRuleset(rules, denyRules, discovery)
+		provenance.recordDenial(fmt.Sprintf("deny[%d]", i), &deny[i], rules, remaining)
+		rules = remaining
+	}
+}
+
+// recordAllowProvenance enumerates the allow rules one at a time, recording the permissions each of them grants as `allow[i]`
+func recordAllowProvenance(provenance *Provenance, allow []v1.PolicyRule, roleType RoleType, discovery *DiscoverySnapshot) {
+	if provenance == nil {
+		return
+	}
+	for i := range allow {
+		allowRules := []v1.PolicyRule{allow[i]}
+		if roleType == Role {
+			allowRules = StripNonResourceURLs(allowRules)
+		}
+		enumeratedRules, err := EnumeratePolicyRules(allowRules, discovery)
+		if err != nil {
+			continue
+		}
+		provenance.record(true, fmt.Sprintf("allow[%d]", i), &allow[i], ExpandPolicyRules(enumeratedRules))
+	}
 }
 
-// EnumeratePolicyRules takes a list of rules with wildcards and returns a list of policy rules with resources explicitly enumerated
-func EnumeratePolicyRules(inputRules []v1.PolicyRule, cache *ResourceCache) ([]v1.PolicyRule, error) {
+// EnumeratePolicyRules takes a list of rules with wildcards and patterns (see func `patternMatches`) and returns a list of policy rules with resources explicitly enumerated
+// Verb aliases such as `read` are resolved to the verbs each enumerated resource supports
+func EnumeratePolicyRules(inputRules []v1.PolicyRule, discovery *DiscoverySnapshot) ([]v1.PolicyRule, error) {
 	rules := []v1.PolicyRule{}
-	allPossibleRules := cache.AllPolicies
 	for _, rule := range inputRules {
-		if ruleHasGroupWildcard(&rule) && ruleHasResourceWildcard(&rule) {
-			var relevantRules []v1.PolicyRule
-			copier.Copy(&relevantRules, allPossibleRules)
-			if !stringInSlice(rule.Verbs, "*") {
-				for index := range relevantRules {
-					relevantRules[index].Verbs = rule.Verbs
-				}
+		if len(rule.NonResourceURLs) > 0 {
+			// nonResourceURLs are not part of API discovery, so they are passed through with any verb wildcard or alias spelled out
+			nonResourceRule := v1.PolicyRule{}
+			copier.Copy(&nonResourceRule.NonResourceURLs, &rule.NonResourceURLs)
+			if stringInSlice(rule.Verbs, "*") {
+				copier.Copy(&nonResourceRule.Verbs, &nonResourceURLVerbs)
+			} else {
+				nonResourceRule.Verbs = resolveVerbAliases(rule.Verbs, nonResourceURLVerbs)
 			}
-			rules = append(rules, relevantRules...)
-		} else if ruleHasGroupWildcard(&rule) {
-			for _, resource := range rule.Resources {
-				for _, matchedRule := range *allPossibleRules {
-					if stringInSlice(matchedRule.Resources, resource) {
-						var tmpRule v1.PolicyRule
-						copier.Copy(&tmpRule, &matchedRule)
-						if !stringInSlice(rule.Verbs, "*") {
-							copier.Copy(&tmpRule.Verbs, &rule.Verbs)
-						} else {
-							copier.Copy(&tmpRule.Verbs, &matchedRule.Verbs)
-						}
-						rules = append(rules, tmpRule)
-					}
-				}
+			if len(nonResourceRule.Verbs) > 0 {
+				rules = append(rules, nonResourceRule)
 			}
-		} else if ruleHasResourceWildcard(&rule) {
-			for _, group := range rule.APIGroups {
-				for _, matchedRule := range *allPossibleRules {
-					if stringInSlice(matchedRule.APIGroups, group) {
-						var tmpRule v1.PolicyRule
-						copier.Copy(&tmpRule, &matchedRule)
-						if !stringInSlice(rule.Verbs, "*") {
-							copier.Copy(&tmpRule.Verbs, &rule.Verbs)
-						} else {
-							copier.Copy(&tmpRule.Verbs, &matchedRule.Verbs)
-						}
-						rules = append(rules, tmpRule)
-					}
-				}
+			if len(rule.Resources) == 0 {
+				continue
 			}
-		} else {
-			for _, group := range rule.APIGroups {
-				if group == "v1" {
-					group = ""
+		}
+		for _, matchedRule := range discovery.Rules {
+			if groupMatchesAnyPattern(rule.APIGroups, matchedRule.APIGroups[0]) && resourceMatchesAnyPattern(rule.Resources, matchedRule.Resources[0]) {
+				var tmpRule v1.PolicyRule
+				copier.Copy(&tmpRule, &matchedRule)
+				if !stringInSlice(rule.Verbs, "*") {
+					tmpRule.Verbs = resolveVerbAliases(rule.Verbs, supportedVerbs(matchedRule))
+				} else {
+					copier.Copy(&tmpRule.Verbs, &matchedRule.Verbs)
 				}
-				for _, resource := range rule.Resources {
-					for _, matchedRule := range *allPossibleRules {
-						if stringInSlice(matchedRule.APIGroups, group) && stringInSlice(matchedRule.Resources, resource) {
-							var tmpRule v1.PolicyRule
-							copier.Copy(&tmpRule, &matchedRule)
-							if !stringInSlice(rule.Verbs, "*") {
-								copier.Copy(&tmpRule.Verbs, &rule.Verbs)
-							} else {
-								copier.Copy(&tmpRule.Verbs, &matchedRule.Verbs)
-							}
-							rules = append(rules, tmpRule)
-						}
-					}
+				if len(tmpRule.Verbs) == 0 {
+					// Every verb of the rule was an alias for verbs the resource does not support
+					continue
 				}
+				copier.Copy(&tmpRule.ResourceNames, &rule.ResourceNames)
+				rules = append(rules, tmpRule)
 			}
 		}
+		rules = append(rules, enumerateRBACOnlyResources(rule)...)
 	}
 	return rules, nil
 }
 
-// ExpandPolicyRules ensures that multiple resources with the same verbs are not grouped together in the same rule definition (makes it easier to edit individual verbs later)
+// ExpandPolicyRules ensures that multiple groups, resources, resourceNames and nonResourceURLs with the same verbs are not grouped together in the same rule definition (makes it easier to edit individual verbs later)
 func ExpandPolicyRules(inputRules []v1.PolicyRule) []v1.PolicyRule {
 	rules := []v1.PolicyRule{}
 	for _, rule := range inputRules {
-		if len(rule.Resources) > 1 {
-			for _, resource := range rule.Resources {
-				var newVerbs []string
-				var newAPIGroups []string
-				copier.Copy(&newVerbs, &rule.Verbs)
-				copier.Copy(&newAPIGroups, &rule.APIGroups)
-				newRule := v1.PolicyRule{
-					APIGroups: newAPIGroups,
-					Resources: []string{resource},
-					Verbs:     newVerbs,
-				}
-				rules = append(rules, newRule)
-			}
-		} else {
-			var tmpRule v1.PolicyRule
-			copier.Copy(&tmpRule, &rule)
-			rules = append(rules, tmpRule)
+		for _, key := range policyKeysForRule(rule) {
+			var newVerbs []string
+			copier.Copy(&newVerbs, &rule.Verbs)
+			rules = append(rules, policyRuleForKey(key, newVerbs))
 		}
 	}
 	return rules
 }
 
+// NormalizePolicyRules returns an expanded ruleset (see func `ExpandPolicyRules`) without duplicates, sorted by API group, resource and resource name with sorted verbs
+// The same permissions always produce the same rules, so generated roles do not change from one reconcile to the next
+func NormalizePolicyRules(rules []v1.PolicyRule) []v1.PolicyRule {
+	return irToPolicyList(policyListToIR(rules))
+}
+
 // MergeExpandedPolicyRules takes two expanded rulesets (see func `ExpandPolicyRules`) and returns one merged expanded ruleset
 func MergeExpandedPolicyRules(first []v1.PolicyRule, second []v1.PolicyRule) []v1.PolicyRule {
 	return irToPolicyList(unionIRs(policyListToIR(first), policyListToIR(second)))
@@ -212,64 +423,209 @@ func APIResourcesToExpandedRules(resourceLists []*metav1.APIResourceList) []v1.P
 }
 
 // ApplyDenyRulesToExpandedRuleset takes in an expanded ruleset (see func `ExpandPolicyRules`) and removes anything matching the deny rules
-func ApplyDenyRulesToExpandedRuleset(fullRuleSet []v1.PolicyRule, denyRules []v1.PolicyRule) []v1.PolicyRule {
+//
+// A deny rule without resourceNames removes verbs from every object of the matched resources, including name-scoped grants.
+// A deny rule with resourceNames removes verbs from grants scoped to those names. RBAC cannot express "every object except
+// these names", so the denied verbs are also removed from any grant covering every object of the matched resources.
+// nonResourceURLs follow the same rule: a deny removes verbs from every granted URL pattern that overlaps with its own.
+// A verb alias such as `write` denies every verb it stands for.
+// A grant of `*` is first spelled out as every verb the resource supports (see func `wildcardVerbs`), so that denying a verb removes it from `*` too.
+func ApplyDenyRulesToExpandedRuleset(fullRuleSet []v1.PolicyRule, denyRules []v1.PolicyRule, discovery *DiscoverySnapshot) []v1.PolicyRule {
+	rules, _ := applyDenyRules(fullRuleSet, denyRules, discovery)
+	return rules
+}
+
+// applyDenyRules does the work of ApplyDenyRulesToExpandedRuleset, also returning the granted nonResourceURL patterns that a deny rule only partly covered,
+// which were narrowed down to the well-known nonResourceURLs and no longer grant any other URL they matched (see func `narrowNonResourceURL`)
+func applyDenyRules(fullRuleSet []v1.PolicyRule, denyRules []v1.PolicyRule, discovery *DiscoverySnapshot) ([]v1.PolicyRule, []string) {
 	outputIR := policyListToIR(fullRuleSet)
+	narrowedPatterns := []string{}
 
-	for _, rule := range fullRuleSet {
-		for _, denyRule := range denyRules {
-			var newVerbs []string
-			denyRuleApplies := false
-			if ruleHasGroupWildcard(&denyRule) && ruleHasResourceWildcard(&denyRule) {
-				denyRuleApplies = true
-			} else if ruleHasGroupWildcard(&denyRule) && slicesIntersect(denyRule.Resources, rule.Resources) {
-				denyRuleApplies = true
-			} else if ruleHasResourceWildcard(&denyRule) && slicesIntersect(denyRule.APIGroups, rule.APIGroups) {
-				denyRuleApplies = true
-			} else if slicesIntersect(denyRule.APIGroups, rule.APIGroups) && slicesIntersect(denyRule.Resources, rule.Resources) {
-				denyRuleApplies = true
+	for _, denyRule := range denyRules {
+		deniedVerbs := expandVerbAliases(denyRule.Verbs)
+		narrowedIR := make(policyListIR)
+		for currentPolicyKey, verbs := range outputIR {
+			if !denyRuleMatchesKey(&denyRule, currentPolicyKey) {
+				continue
 			}
-			if denyRuleApplies {
-				currentPolicyKey := expandedPolicyKey{
-					APIGroup: rule.APIGroups[0],
-					Resource: rule.Resources[0],
-				}
-				if !stringInSlice(denyRule.Verbs, "*") {
-					newVerbs = subtractStringSlices(rule.Verbs, denyRule.Verbs)
-					if len(newVerbs) > 0 {
-						var tmpRule v1.PolicyRule
-						copier.Copy(&tmpRule, &rule)
-						tmpRule.Verbs = newVerbs
-						outputIR[currentPolicyKey] = newVerbs
-					} else {
-						delete(outputIR, currentPolicyKey)
-					}
-				} else {
-					delete(outputIR, currentPolicyKey)
+			var newVerbs []string
+			if !stringInSlice(deniedVerbs, "*") {
+				if stringInSlice(verbs, "*") {
+					verbs = wildcardVerbs(currentPolicyKey, discovery)
 				}
+				newVerbs = subtractStringSlices(verbs, deniedVerbs)
+			}
+			if currentPolicyKey.NonResourceURLs != "" && narrowNonResourceURL(narrowedIR, &denyRule, currentPolicyKey.NonResourceURLs, subtractStringSlices(verbs, newVerbs)) {
+				narrowedPatterns = appendSet(narrowedPatterns, currentPolicyKey.NonResourceURLs)
 			}
+			if len(newVerbs) > 0 {
+				outputIR[currentPolicyKey] = newVerbs
+			} else {
+				delete(outputIR, currentPolicyKey)
+			}
+		}
+		for key, verbs := range narrowedIR {
+			outputIR[key] = appendSet(outputIR[key], verbs...)
 		}
 	}
 
-	return irToPolicyList(outputIR)
+	return irToPolicyList(outputIR), narrowedPatterns
+}
+
+// wellKnownNonResourceURLs are the nonResourceURLs served by the API server
+// A granted pattern such as `*` cannot express "every URL except the denied ones", so it is narrowed down to these instead, see func `narrowNonResourceURL`
+var wellKnownNonResourceURLs = []string{
+	"/.well-known/*",
+	"/api", "/api/*",
+	"/apis", "/apis/*",
+	"/debug/*",
+	"/healthz", "/healthz/*",
+	"/livez", "/livez/*",
+	"/logs", "/logs/*",
+	"/metrics", "/metrics/*",
+	"/openapi", "/openapi/*",
+	"/openid/*",
+	"/readyz", "/readyz/*",
+	"/version", "/version/*",
+}
+
+// narrowNonResourceURL grants the verbs a deny rule removed from a nonResourceURL pattern again on the well-known nonResourceURLs that the pattern matches and the deny rule does not,
+// so that denying `/metrics` against an inherited `*` keeps `/healthz`
+// It reports whether the pattern was narrowed, i.e. whether the deny rule only covered part of it, so that any other URL it matched lost the removed verbs
+func narrowNonResourceURL(narrowedIR policyListIR, denyRule *v1.PolicyRule, pattern string, removedVerbs []string) bool {
+	if len(removedVerbs) == 0 {
+		return false
+	}
+	for _, deniedURL := range denyRule.NonResourceURLs {
+		if nonResourceURLMatches(deniedURL, pattern) {
+			return false
+		}
+	}
+	for _, url := range wellKnownNonResourceURLs {
+		key := expandedPolicyKey{NonResourceURLs: url}
+		if url == pattern || !nonResourceURLMatches(pattern, url) || denyRuleMatchesKey(denyRule, key) {
+			continue
+		}
+		narrowedIR[key] = appendSet(narrowedIR[key], removedVerbs...)
+	}
+	return true
+}
+
+func denyRuleMatchesKey(denyRule *v1.PolicyRule, key expandedPolicyKey) bool {
+	if key.NonResourceURLs != "" {
+		for _, deniedURL := range denyRule.NonResourceURLs {
+			if nonResourceURLsOverlap(deniedURL, key.NonResourceURLs) {
+				return true
+			}
+		}
+		return false
+	}
+	if !groupMatchesAnyPattern(denyRule.APIGroups, key.APIGroup) {
+		return false
+	}
+	if !resourceMatchesAnyPattern(denyRule.Resources, key.Resource) {
+		return false
+	}
+	if len(denyRule.ResourceNames) > 0 && key.ResourceNames != "" && !stringInSlice(denyRule.ResourceNames, key.ResourceNames) {
+		return false
+	}
+	return true
 }
 
 // StripNonResourceURLs takes a list of PolicyRules that may specify NonResourceURLs and returns the same list without any NonResourceURLs
 func StripNonResourceURLs(rules []v1.PolicyRule) []v1.PolicyRule {
-	var ln int
+	output := []v1.PolicyRule{}
 	for _, rule := range rules {
-		if rule.NonResourceURLs != nil {
+		if len(rule.NonResourceURLs) > 0 {
 			continue
 		}
-		rules[ln] = rule
-		ln++
+		output = append(output, rule)
+	}
+	return output
+}
+
+// DiffPolicyRules compares two rulesets and returns the number of individual permissions (a verb on a single resource, resourceName or nonResourceURL) added and removed
+func DiffPolicyRules(previousRules []v1.PolicyRule, currentRules []v1.PolicyRule) (added int, removed int) {
+	previousIR := policyListToIR(previousRules)
+	currentIR := policyListToIR(currentRules)
+	for key, verbs := range currentIR {
+		added += len(subtractStringSlices(verbs, previousIR[key]))
+	}
+	for key, verbs := range previousIR {
+		removed += len(subtractStringSlices(verbs, currentIR[key]))
+	}
+	return added, removed
+}
+
+// PolicyRuleChanges compares two rulesets and returns the permissions granted by the current rules only, and by the previous rules only, as expanded rulesets
+func PolicyRuleChanges(previousRules []v1.PolicyRule, currentRules []v1.PolicyRule) (added []v1.PolicyRule, removed []v1.PolicyRule) {
+	previousIR := policyListToIR(previousRules)
+	currentIR := policyListToIR(currentRules)
+	addedIR := make(policyListIR)
+	for key, verbs := range currentIR {
+		if newVerbs := subtractStringSlices(verbs, previousIR[key]); len(newVerbs) > 0 {
+			addedIR[key] = newVerbs
+		}
+	}
+	removedIR := make(policyListIR)
+	for key, verbs := range previousIR {
+		if oldVerbs := subtractStringSlices(verbs, currentIR[key]); len(oldVerbs) > 0 {
+			removedIR[key] = oldVerbs
+		}
+	}
+	return irToPolicyList(addedIR), irToPolicyList(removedIR)
+}
+
+// AddSubresourcesToRules returns a copy of the given rules where every parent resource (e.g. `pods`) is accompanied by a wildcard over its subresources (e.g. `pods/*`)
+func AddSubresourcesToRules(rules []v1.PolicyRule) []v1.PolicyRule {
+	output := []v1.PolicyRule{}
+	for _, rule := range rules {
+		var tmpRule v1.PolicyRule
+		copier.Copy(&tmpRule, &rule)
+		for _, resource := range rule.Resources {
+			if resource != "*" && !strings.Contains(resource, "/") && !isRegexPattern(resource) {
+				tmpRule.Resources = appendSet(tmpRule.Resources, resource+"/*")
+			}
+		}
+		output = append(output, tmpRule)
+	}
+	return output
+}
+
+// nonResourceURLMatches reports whether a nonResourceURL pattern (an exact path, "*", or a path prefix ending in "*") matches a path
+func nonResourceURLMatches(pattern string, path string) bool {
+	if pattern == "*" || pattern == path {
+		return true
 	}
-	return rules[:ln]
+	return strings.HasSuffix(pattern, "*") && strings.HasPrefix(path, strings.TrimSuffix(pattern, "*"))
 }
 
-func ruleHasGroupWildcard(rule *v1.PolicyRule) bool {
-	return stringInSlice(rule.APIGroups, "*")
+// nonResourceURLsOverlap reports whether two nonResourceURL patterns could both match the same request path
+func nonResourceURLsOverlap(first string, second string) bool {
+	return nonResourceURLMatches(first, second) || nonResourceURLMatches(second, first)
 }
 
-func ruleHasResourceWildcard(rule *v1.PolicyRule) bool {
-	return stringInSlice(rule.Resources, "*")
+// DescribePolicyRule formats a rule on a single line, for messages
+func DescribePolicyRule(rule v1.PolicyRule) string {
+	fields := []string{}
+	for _, field := range []struct {
+		name   string
+		values []string
+	}{
+		{"apiGroups", rule.APIGroups},
+		{"resources", rule.Resources},
+		{"resourceNames", rule.ResourceNames},
+		{"nonResourceURLs", rule.NonResourceURLs},
+		{"verbs", rule.Verbs},
+	} {
+		if field.values == nil {
+			continue
+		}
+		quoted := []string{}
+		for _, value := range field.values {
+			quoted = append(quoted, fmt.Sprintf("%q", value))
+		}
+		fields = append(fields, fmt.Sprintf("%s: [%s]", field.name, strings.Join(quoted, ", ")))
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
 }
@@ -0,0 +1,401 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testDiscovery is a small discovery snapshot shared by the tests of this package
+var testDiscovery = &DiscoverySnapshot{
+	Version: 1,
+	Rules: []v1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}},
+		{APIGroups: []string{""}, Resources: []string{"pods/log"}, Verbs: []string{"get"}},
+		{APIGroups: []string{""}, Resources: []string{"pods/exec"}, Verbs: []string{"create", "get"}},
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}},
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments/scale"}, Verbs: []string{"get", "update", "patch"}},
+		{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}},
+	},
+}
+
+// expectRules fails the test unless two rulesets grant the same permissions, regardless of their order and grouping
+func expectRules(t *testing.T, got []v1.PolicyRule, want []v1.PolicyRule) {
+	t.Helper()
+	if normalizedGot, normalizedWant := NormalizePolicyRules(got), NormalizePolicyRules(want); !reflect.DeepEqual(normalizedGot, normalizedWant) {
+		t.Errorf("got rules\n%v\nwant\n%v", describeRules(normalizedGot), describeRules(normalizedWant))
+	}
+}
+
+func describeRules(rules []v1.PolicyRule) []string {
+	descriptions := []string{}
+	for _, rule := range rules {
+		descriptions = append(descriptions, DescribePolicyRule(rule))
+	}
+	return descriptions
+}
+
+func TestApplyDenyRulesToExpandedRuleset(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []v1.PolicyRule
+		deny  []v1.PolicyRule
+		want  []v1.PolicyRule
+		// narrowed are the granted nonResourceURL patterns the deny only partly covers
+		narrowed []string
+	}{
+		{
+			name:  "deny removes the denied verbs only",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "delete"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"delete"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list"}}},
+		},
+		{
+			name:  "deny of every verb removes the resource",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets", "pods"}, Verbs: []string{"get"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"*"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "name-scoped deny removes the named object only",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a", "b"}, Verbs: []string{"get"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"b"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "name-scoped deny removes the denied verbs from a grant of every object",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"list"}}},
+		},
+		{
+			name:  "deny without names removes named grants",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a"}, Verbs: []string{"get"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{},
+		},
+		{
+			name:  "deny of another name leaves a named grant",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a"}, Verbs: []string{"get"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"b"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "nonResourceURL deny removes the denied verbs from an overlapping pattern",
+			rules: []v1.PolicyRule{{NonResourceURLs: []string{"/healthz/*"}, Verbs: []string{"get", "head"}}},
+			deny:  []v1.PolicyRule{{NonResourceURLs: []string{"/healthz/*"}, Verbs: []string{"head"}}},
+			want:  []v1.PolicyRule{{NonResourceURLs: []string{"/healthz/*"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "nonResourceURL deny covering a narrower grant removes it",
+			rules: []v1.PolicyRule{{NonResourceURLs: []string{"/apis/apps"}, Verbs: []string{"get"}}},
+			deny:  []v1.PolicyRule{{NonResourceURLs: []string{"/apis/*"}, Verbs: []string{"*"}}},
+			want:  []v1.PolicyRule{},
+		},
+		{
+			name:  "nonResourceURL deny leaves patterns it does not overlap",
+			rules: []v1.PolicyRule{{NonResourceURLs: []string{"/api/*", "/apis/*"}, Verbs: []string{"get"}}},
+			deny:  []v1.PolicyRule{{NonResourceURLs: []string{"/apis/*"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{NonResourceURLs: []string{"/api/*"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "narrow nonResourceURL deny narrows a wildcard grant down to the other known URLs",
+			rules: []v1.PolicyRule{{NonResourceURLs: []string{"*"}, Verbs: []string{"get", "post"}}},
+			deny:  []v1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}},
+			want: []v1.PolicyRule{
+				{NonResourceURLs: []string{"*"}, Verbs: []string{"post"}},
+				{NonResourceURLs: []string{
+					"/.well-known/*", "/api", "/api/*", "/apis", "/apis/*", "/debug/*", "/healthz", "/healthz/*", "/livez", "/livez/*", "/logs", "/logs/*",
+					"/metrics/*", "/openapi", "/openapi/*", "/openid/*", "/readyz", "/readyz/*", "/version", "/version/*",
+				}, Verbs: []string{"get"}},
+			},
+			narrowed: []string{"*"},
+		},
+		{
+			name:     "narrow nonResourceURL deny removes the whole known pattern it falls under",
+			rules:    []v1.PolicyRule{{NonResourceURLs: []string{"/healthz", "/healthz/*"}, Verbs: []string{"get"}}},
+			deny:     []v1.PolicyRule{{NonResourceURLs: []string{"/healthz/etcd"}, Verbs: []string{"get"}}},
+			want:     []v1.PolicyRule{{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}},
+			narrowed: []string{"/healthz/*"},
+		},
+		{
+			name:  "deny of a subresource leaves its parent resource",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "pods/exec"}, Verbs: []string{"get", "create"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods/exec"}, Verbs: []string{"*"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "create"}}},
+		},
+		{
+			name:  "deny of a parent resource leaves its subresources",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}, Verbs: []string{"get"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods/log"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "deny with denySubresources removes the subresources of a parent resource",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "pods/log", "secrets"}, Verbs: []string{"get"}}},
+			deny:  AddSubresourcesToRules([]v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}}),
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "deny of a subresource of every resource",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods/exec", "pods/log"}, Verbs: []string{"get"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"*/exec"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods/log"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "deny removes the denied verb from a wildcard grant",
+			rules: []v1.PolicyRule{{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles"}, Verbs: []string{"*"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"escalate"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection", "bind"}}},
+		},
+		{
+			name:  "wildcard grant on an RBAC-only resource",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"users"}, Verbs: []string{"*"}}},
+			deny:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"users"}, Verbs: []string{"dangerous"}}},
+			want:  []v1.PolicyRule{},
+		},
+		{
+			name:  "wildcard grant on a nonResourceURL",
+			rules: []v1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"*"}}},
+			deny:  []v1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"post", "put", "patch", "delete"}}},
+			want:  []v1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get", "head", "options"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, narrowed := applyDenyRules(ExpandPolicyRules(test.rules), test.deny, testDiscovery)
+			expectRules(t, rules, test.want)
+			expectSameStrings(t, "narrowed nonResourceURLs", narrowed, test.narrowed)
+		})
+	}
+}
+
+func TestEnumeratePolicyRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []v1.PolicyRule
+		want  []v1.PolicyRule
+	}{
+		{
+			name:  "wildcard resources are enumerated from discovery",
+			rules: []v1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"*"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"deployments", "deployments/scale"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "resourceNames are preserved",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets", "configmaps"}, ResourceNames: []string{"db"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets", "configmaps"}, ResourceNames: []string{"db"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "nonResourceURLs are passed through with verb wildcards spelled out",
+			rules: []v1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"*"}}},
+			want:  []v1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: nonResourceURLVerbs}},
+		},
+		{
+			name:  "every subresource of a resource",
+			rules: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods/*"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods/exec", "pods/log"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:  "a subresource of every resource",
+			rules: []v1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*/scale"}, Verbs: []string{"update"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"deployments/scale"}, Verbs: []string{"update"}}},
+		},
+		{
+			name:  "glob and regular expression patterns",
+			rules: []v1.PolicyRule{{APIGroups: []string{"^(apps|)$"}, Resources: []string{"*s", "config*"}, Verbs: []string{"list"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps", "pods", "secrets"}, Verbs: []string{"list"}}, {APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"list"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := EnumeratePolicyRules(test.rules, testDiscovery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectRules(t, ExpandPolicyRules(got), test.want)
+		})
+	}
+}
+
+func TestBuildPolicyRulesPrecedence(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewFakeClientWithScheme(scheme, &v1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "view"},
+		Rules:      []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get", "list"}}},
+	})
+	inherit := &[]v1alpha1.InheritedRole{{Kind: "ClusterRole", Name: "view"}}
+	deny := &[]v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"*"}}}
+
+	tests := []struct {
+		name       string
+		precedence v1alpha1.Precedence
+		allow      *[]v1.PolicyRule
+		want       []v1.PolicyRule
+	}{
+		{
+			name:       "deny applies to inherited permissions",
+			precedence: v1alpha1.PrecedenceAllowOverrides,
+			want:       []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}},
+		},
+		{
+			name:       "allow overrides deny",
+			precedence: v1alpha1.PrecedenceAllowOverrides,
+			allow:      &[]v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"public"}, Verbs: []string{"get"}}},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"public"}, Verbs: []string{"get"}},
+			},
+		},
+		{
+			name:  "default precedence is AllowOverrides",
+			allow: &[]v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+			want:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}, {APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:       "deny overrides allow",
+			precedence: v1alpha1.PrecedenceDenyOverrides,
+			allow: &[]v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"public"}, Verbs: []string{"get"}},
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}},
+			},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _, err := BuildPolicyRules(BuildContext{Client: client, Discovery: testDiscovery, Dependencies: NewDependencies()}, DynamicClusterRoleLink("test"), ClusterRole, "", RuleSpec{Inherit: inherit, Allow: test.allow, Deny: deny, Precedence: test.precedence})
+			if err != nil {
+				t.Fatalf("BuildPolicyRules() error = %v", err)
+			}
+			expectRules(t, *got, test.want)
+		})
+	}
+}
+
+func TestBuildPolicyRulesInheritance(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	dynamicClusterRole := func(name string, allowed string, inherits ...string) *v1alpha1.DynamicClusterRole {
+		inherit := []v1alpha1.InheritedRole{}
+		for _, inherited := range inherits {
+			inherit = append(inherit, v1alpha1.InheritedRole{Kind: "DynamicClusterRole", Name: inherited})
+		}
+		return &v1alpha1.DynamicClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1alpha1.DynamicClusterRoleSpec{
+				Inherit: &inherit,
+				Allow:   &[]v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{allowed}, Verbs: []string{"get"}}},
+			},
+		}
+	}
+	dynamicRole := func(name string, inherits ...string) *v1alpha1.DynamicRole {
+		inherit := []v1alpha1.InheritedRole{}
+		for _, inherited := range inherits {
+			inherit = append(inherit, v1alpha1.InheritedRole{Kind: "DynamicRole", Name: inherited})
+		}
+		return &v1alpha1.DynamicRole{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a"}, Spec: v1alpha1.DynamicRoleSpec{Inherit: &inherit}}
+	}
+	client := fake.NewFakeClientWithScheme(scheme,
+		dynamicClusterRole("base", "pods"),
+		dynamicClusterRole("developer", "configmaps", "base"),
+		dynamicClusterRole("oncall", "secrets", "developer"),
+		dynamicClusterRole("self", "pods", "self"),
+		dynamicClusterRole("ping", "pods", "pong"),
+		dynamicClusterRole("pong", "pods", "ping"),
+		dynamicClusterRole("caller", "pods", "ping"),
+		dynamicRole("left", "right"),
+		dynamicRole("right", "left"),
+	)
+
+	tests := []struct {
+		name      string
+		self      string
+		roleType  RoleType
+		namespace string
+		inherit   []v1alpha1.InheritedRole
+		want      []v1.PolicyRule
+		wantChain []string
+	}{
+		{
+			name:     "layered dynamic roles",
+			self:     DynamicClusterRoleLink("test"),
+			roleType: ClusterRole,
+			inherit:  []v1alpha1.InheritedRole{{Kind: "DynamicClusterRole", Name: "oncall"}},
+			want:     []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "configmaps", "secrets"}, Verbs: []string{"get"}}},
+		},
+		{
+			name:      "dynamic role inheriting from itself",
+			self:      DynamicClusterRoleLink("self"),
+			roleType:  ClusterRole,
+			inherit:   []v1alpha1.InheritedRole{{Kind: "DynamicClusterRole", Name: "self"}},
+			wantChain: []string{"DynamicClusterRole/self", "DynamicClusterRole/self"},
+		},
+		{
+			name:      "dynamic roles inheriting from each other",
+			self:      DynamicClusterRoleLink("ping"),
+			roleType:  ClusterRole,
+			inherit:   []v1alpha1.InheritedRole{{Kind: "DynamicClusterRole", Name: "pong"}},
+			wantChain: []string{"DynamicClusterRole/ping", "DynamicClusterRole/pong", "DynamicClusterRole/ping"},
+		},
+		{
+			name:      "cycle further down the chain",
+			self:      DynamicClusterRoleLink("caller"),
+			roleType:  ClusterRole,
+			inherit:   []v1alpha1.InheritedRole{{Kind: "DynamicClusterRole", Name: "ping"}},
+			wantChain: []string{"DynamicClusterRole/caller", "DynamicClusterRole/ping", "DynamicClusterRole/pong", "DynamicClusterRole/ping"},
+		},
+		{
+			name:      "cycle of DynamicRoles in the same namespace",
+			self:      DynamicRoleLink("team-a", "left"),
+			roleType:  Role,
+			namespace: "team-a",
+			inherit:   []v1alpha1.InheritedRole{{Kind: "DynamicRole", Name: "right"}},
+			wantChain: []string{"DynamicRole/team-a/left", "DynamicRole/team-a/right", "DynamicRole/team-a/left"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dependencies := NewDependencies()
+			got, _, err := BuildPolicyRules(BuildContext{Client: client, Discovery: testDiscovery, Dependencies: dependencies}, test.self, test.roleType, test.namespace, RuleSpec{Inherit: &test.inherit})
+			if test.wantChain == nil {
+				if err != nil {
+					t.Fatalf("BuildPolicyRules() error = %v", err)
+				}
+				expectRules(t, *got, test.want)
+				return
+			}
+			if !IsInheritanceCycle(err) {
+				t.Fatalf("BuildPolicyRules() error = %v, want an inheritance cycle", err)
+			}
+			if chain := err.(*InheritanceCycleError).Chain; !reflect.DeepEqual(chain, test.wantChain) {
+				t.Errorf("got chain %q, want %q", chain, test.wantChain)
+			}
+			if len(dependencies.DynamicClusterRoles)+len(dependencies.DynamicRoles) == 0 {
+				t.Errorf("the dynamic roles of the cycle were not recorded as dependencies, so fixing it would not trigger recomputation")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RulesHashAnnotation is set on every generated Role and ClusterRole to a hash of the rules the operator wrote
+// A role whose rules no longer match the hash has been changed outside of the operator
+const RulesHashAnnotation = "rbac.redhatcop.redhat.io/rules-hash"
+
+// RulesHash returns a hash identifying the permissions granted by a list of rules, regardless of their order or grouping
+func RulesHash(rules []v1.PolicyRule) string {
+	serialized, _ := json.Marshal(NormalizePolicyRules(rules))
+	sum := sha256.Sum256(serialized)
+	return hex.EncodeToString(sum[:])
+}
+
+// setRulesHash annotates a generated role with the hash of the rules about to be written
+func setRulesHash(meta *metav1.ObjectMeta, rules []v1.PolicyRule) {
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[RulesHashAnnotation] = RulesHash(rules)
+}
+
+// rulesDrifted returns true if the rules of a generated role differ from the ones the operator last wrote
+// Without the annotation, e.g. on a role written by a version of the operator predating it, whether the rules drifted is unknown,
+// so the role is rewritten without reporting drift; only a hash that is present and differs is reported
+func rulesDrifted(meta metav1.ObjectMeta, rules []v1.PolicyRule) bool {
+	hash, ok := meta.Annotations[RulesHashAnnotation]
+	return ok && hash != RulesHash(rules)
+}
+
+// mergeMetadata copies the labels and annotations of a generated object onto the object found in the cluster, leaving any others in place
+// It returns true if anything had to be changed
+func mergeMetadata(found *metav1.ObjectMeta, generated metav1.ObjectMeta) bool {
+	changed := false
+	for key, value := range generated.Labels {
+		if found.Labels == nil {
+			found.Labels = map[string]string{}
+		}
+		if current, ok := found.Labels[key]; !ok || current != value {
+			found.Labels[key] = value
+			changed = true
+		}
+	}
+	for key, value := range generated.Annotations {
+		if found.Annotations == nil {
+			found.Annotations = map[string]string{}
+		}
+		if current, ok := found.Annotations[key]; !ok || current != value {
+			found.Annotations[key] = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+// rulesUnchanged returns true if two rulesets hold the same rules, regardless of the order of the rules and of the values listed in each rule
+// Rules are not expanded first, so the same permissions grouped differently, e.g. after `compact` is switched on or off, count as a change
+func rulesUnchanged(previousRules []v1.PolicyRule, currentRules []v1.PolicyRule) bool {
+	if len(previousRules) != len(currentRules) {
+		return false
+	}
+	previous, current := canonicalRules(previousRules), canonicalRules(currentRules)
+	for i := range previous {
+		if compactedRuleLess(previous[i], current[i]) || compactedRuleLess(current[i], previous[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalRules returns a sorted copy of rules, with the values listed in each rule sorted as well
+func canonicalRules(rules []v1.PolicyRule) []v1.PolicyRule {
+	canonical := make([]v1.PolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		canonicalRule := v1.PolicyRule{}
+		for _, field := range []struct {
+			from []string
+			to   *[]string
+		}{
+			{rule.APIGroups, &canonicalRule.APIGroups},
+			{rule.Resources, &canonicalRule.Resources},
+			{rule.ResourceNames, &canonicalRule.ResourceNames},
+			{rule.NonResourceURLs, &canonicalRule.NonResourceURLs},
+			{rule.Verbs, &canonicalRule.Verbs},
+		} {
+			*field.to = append([]string{}, field.from...)
+			sort.Strings(*field.to)
+		}
+		canonical = append(canonical, canonicalRule)
+	}
+	sort.Slice(canonical, func(i, j int) bool {
+		return compactedRuleLess(canonical[i], canonical[j])
+	})
+	return canonical
+}
@@ -0,0 +1,88 @@
+package helpers
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRulesUnchanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []v1.PolicyRule
+		current  []v1.PolicyRule
+		want     bool
+	}{
+		{
+			name:     "same rules in another order",
+			previous: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}, {NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}},
+			current:  []v1.PolicyRule{{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}, {APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+			want:     true,
+		},
+		{
+			name:     "values listed in another order",
+			previous: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"list", "get"}}},
+			current:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets", "pods"}, Verbs: []string{"get", "list"}}},
+			want:     true,
+		},
+		{
+			name:     "same permissions grouped differently",
+			previous: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}, {APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+			current:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get"}}},
+			want:     false,
+		},
+		{
+			name:     "verb added",
+			previous: []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+			current:  []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}},
+			want:     false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := rulesUnchanged(test.previous, test.current); got != test.want {
+				t.Errorf("rulesUnchanged() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRulesHash(t *testing.T) {
+	grouped := []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get", "list"}}}
+	split := []v1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"list", "get"}},
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+	}
+	if RulesHash(grouped) != RulesHash(split) {
+		t.Errorf("RulesHash() differs for the same permissions grouped differently")
+	}
+	if RulesHash(grouped) == RulesHash(grouped[:0]) {
+		t.Errorf("RulesHash() is the same for different permissions")
+	}
+}
+
+func TestRulesDrifted(t *testing.T) {
+	rules := []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}}
+	annotated := metav1.ObjectMeta{}
+	setRulesHash(&annotated, rules)
+
+	tests := []struct {
+		name  string
+		meta  metav1.ObjectMeta
+		rules []v1.PolicyRule
+		want  bool
+	}{
+		{"rules as written", annotated, rules, false},
+		{"rules changed", annotated, []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "delete"}}}, true},
+		{"annotation missing", metav1.ObjectMeta{}, rules, false},
+		{"annotation missing and rules changed", metav1.ObjectMeta{}, []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "delete"}}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := rulesDrifted(test.meta, test.rules); got != test.want {
+				t.Errorf("rulesDrifted() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
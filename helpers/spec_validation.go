@@ -0,0 +1,151 @@
+package helpers
+
+import (
+	"fmt"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// InheritableKinds are the kinds of role that a dynamic role can inherit from
+var InheritableKinds = []string{"ClusterRole", "Role", "DynamicClusterRole", "DynamicRole"}
+
+// knownVerbs are the verbs understood by the API server for resources and nonResourceURLs, including the special verbs checked by RBAC itself
+// Verbs that custom resources and aggregated APIs declare in discovery are accepted as well
+var knownVerbs = []string{
+	"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection", "proxy",
+	"post", "put", "head", "options",
+	"use", "bind", "escalate", "impersonate", "approve", "sign",
+}
+
+// ValidateDynamicRoleSpec checks the spec of a dynamic role for mistakes that are otherwise only reported once it is reconciled, or silently ignored
+// Inherited roles and rules that can never be computed are returned as errors. API groups that no resource in discovery belongs to are returned
+// as warnings instead, because the CRD or APIService serving them may simply not have been installed yet
+func ValidateDynamicRoleSpec(roleType RoleType, specPath *field.Path, inherit *[]v1alpha1.InheritedRole, allow *[]v1.PolicyRule, deny *[]v1.PolicyRule, discovery *DiscoverySnapshot) ([]string, field.ErrorList) {
+	errs := field.ErrorList{}
+	if inherit != nil {
+		for i, roleToInherit := range *inherit {
+			errs = append(errs, validateInheritedRole(roleType, specPath.Child("inherit").Index(i), roleToInherit)...)
+		}
+	}
+
+	verbs := map[string]bool{"*": true}
+	for _, verb := range knownVerbs {
+		verbs[verb] = true
+	}
+	for alias := range verbAliases {
+		verbs[alias] = true
+	}
+	groups := map[string]bool{}
+	if discovery != nil {
+		for _, rule := range discovery.Rules {
+			for _, verb := range rule.Verbs {
+				verbs[verb] = true
+			}
+			for _, group := range rule.APIGroups {
+				groups[group] = true
+			}
+		}
+	}
+
+	warnings := []string{}
+	for _, ruleList := range []struct {
+		name  string
+		rules *[]v1.PolicyRule
+	}{{"allow", allow}, {"deny", deny}} {
+		if ruleList.rules == nil {
+			continue
+		}
+		for i, rule := range *ruleList.rules {
+			rulePath := specPath.Child(ruleList.name).Index(i)
+			errs = append(errs, validateRule(roleType, rulePath, rule, verbs)...)
+			if len(groups) > 0 {
+				warnings = append(warnings, missingAPIGroups(rulePath, rule, groups)...)
+			}
+		}
+	}
+	return warnings, errs
+}
+
+// validateInheritedRole reports the inherited roles that BuildPolicyRules would reject, or ignore because of an unknown kind
+func validateInheritedRole(roleType RoleType, path *field.Path, roleToInherit v1alpha1.InheritedRole) field.ErrorList {
+	errs := field.ErrorList{}
+	if !stringInSlice(InheritableKinds, roleToInherit.Kind) {
+		return append(errs, field.NotSupported(path.Child("kind"), roleToInherit.Kind, InheritableKinds))
+	}
+	selectable := roleToInherit.Kind == "ClusterRole" || roleToInherit.Kind == "Role"
+	switch {
+	case roleToInherit.LabelSelector != nil && !selectable:
+		errs = append(errs, field.Forbidden(path.Child("labelSelector"), "label selectors can only be used to inherit from Cluster Roles and Roles"))
+	case roleToInherit.LabelSelector != nil && roleToInherit.Name != "":
+		errs = append(errs, field.Forbidden(path.Child("name"), "name cannot be set together with labelSelector"))
+	case roleToInherit.LabelSelector == nil && roleToInherit.Name == "":
+		errs = append(errs, field.Required(path.Child("name"), "either name or labelSelector must be set"))
+	}
+	if roleToInherit.NamespaceSelector != nil && (roleToInherit.Kind != "Role" || roleToInherit.LabelSelector == nil) {
+		errs = append(errs, field.Forbidden(path.Child("namespaceSelector"), "namespace selectors can only be used together with a label selector to inherit from Roles"))
+	}
+	if roleType == ClusterRole && roleToInherit.Namespace == "" && roleToInherit.NamespaceSelector == nil && (roleToInherit.Kind == "Role" || roleToInherit.Kind == "DynamicRole") {
+		errs = append(errs, field.Required(path.Child("namespace"), fmt.Sprintf("a Cluster Role cannot inherit from a %s without a namespace specified", roleToInherit.Kind)))
+	}
+	return errs
+}
+
+// validateRule reports rules that grant or deny nothing, mix resources with nonResourceURLs, or use unknown verbs or invalid patterns
+// nonResourceURLs are cluster-scoped, so BuildPolicyRules strips them from the rules of a Role, which they are reported for as well
+func validateRule(roleType RoleType, path *field.Path, rule v1.PolicyRule, verbs map[string]bool) field.ErrorList {
+	errs := field.ErrorList{}
+	if len(rule.Verbs) == 0 {
+		errs = append(errs, field.Required(path.Child("verbs"), "a rule must list at least one verb"))
+	}
+	for i, verb := range rule.Verbs {
+		if !verbs[verb] {
+			errs = append(errs, field.Invalid(path.Child("verbs").Index(i), verb, "unknown verb, not supported by the API server or by any resource in discovery, and not a verb alias"))
+		}
+	}
+	switch {
+	case len(rule.NonResourceURLs) > 0 && roleType == Role:
+		errs = append(errs, field.Forbidden(path.Child("nonResourceURLs"), "a Role cannot apply to nonResourceURLs, which are cluster-scoped"))
+	case len(rule.NonResourceURLs) > 0 && (len(rule.Resources) > 0 || len(rule.APIGroups) > 0 || len(rule.ResourceNames) > 0):
+		errs = append(errs, field.Invalid(path.Child("nonResourceURLs"), rule.NonResourceURLs, "a rule cannot apply to both resources and nonResourceURLs"))
+	case len(rule.NonResourceURLs) == 0 && len(rule.Resources) == 0:
+		errs = append(errs, field.Required(path.Child("resources"), "a rule must list at least one resource or nonResourceURL"))
+	case len(rule.NonResourceURLs) == 0 && len(rule.APIGroups) == 0:
+		errs = append(errs, field.Required(path.Child("apiGroups"), "a rule must list at least one API group, \"\" for the core group"))
+	}
+	if err := ValidateRulePatterns([]v1.PolicyRule{{APIGroups: rule.APIGroups}}); err != nil {
+		errs = append(errs, field.Invalid(path.Child("apiGroups"), rule.APIGroups, err.Error()))
+	}
+	if err := ValidateRulePatterns([]v1.PolicyRule{{Resources: rule.Resources}}); err != nil {
+		errs = append(errs, field.Invalid(path.Child("resources"), rule.Resources, err.Error()))
+	}
+	return errs
+}
+
+// missingAPIGroups warns about the API groups and API group patterns of a rule that no API group in discovery matches
+// Patterns that cannot be parsed are already reported as errors by validateRule
+func missingAPIGroups(path *field.Path, rule v1.PolicyRule, groups map[string]bool) []string {
+	warnings := []string{}
+	for i, pattern := range rule.APIGroups {
+		groupPattern := pattern
+		if groupPattern == "v1" {
+			groupPattern = ""
+		}
+		matches, err := newPatternMatcher(groupPattern)
+		if groups[groupPattern] || err != nil {
+			continue
+		}
+		matched := false
+		for group := range groups {
+			if matches(group) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			warnings = append(warnings, fmt.Sprintf("%s: API group %q is not served by the cluster; the rule has no effect until it is", path.Child("apiGroups").Index(i), pattern))
+		}
+	}
+	return warnings
+}
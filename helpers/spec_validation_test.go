@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateDynamicRoleSpec(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	tests := []struct {
+		name         string
+		roleType     RoleType
+		inherit      []v1alpha1.InheritedRole
+		allow        []v1.PolicyRule
+		deny         []v1.PolicyRule
+		wantErrs     []string
+		wantWarnings []string
+	}{
+		{
+			name:     "valid",
+			roleType: ClusterRole,
+			inherit:  []v1alpha1.InheritedRole{{Kind: "ClusterRole", LabelSelector: selector}, {Kind: "Role", Namespace: "team-a", Name: "reader"}},
+			allow:    []v1.PolicyRule{{APIGroups: []string{"^app.*$"}, Resources: []string{"*/scale"}, Verbs: []string{"read"}}, {NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}},
+			deny:     []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"*"}}},
+		},
+		{
+			name:     "unknown inherited kind",
+			roleType: ClusterRole,
+			inherit:  []v1alpha1.InheritedRole{{Kind: "RoleBinding", Name: "reader"}},
+			wantErrs: []string{"spec.inherit[0].kind"},
+		},
+		{
+			name:     "inherited role without name or selector",
+			roleType: Role,
+			inherit:  []v1alpha1.InheritedRole{{Kind: "Role"}, {Kind: "DynamicRole", LabelSelector: selector}, {Kind: "ClusterRole", Name: "view", LabelSelector: selector}},
+			wantErrs: []string{"spec.inherit[0].name", "spec.inherit[1].labelSelector", "spec.inherit[2].name"},
+		},
+		{
+			name:     "Role inherited into a ClusterRole without a namespace",
+			roleType: ClusterRole,
+			inherit:  []v1alpha1.InheritedRole{{Kind: "Role", Name: "reader"}, {Kind: "Role", LabelSelector: selector, NamespaceSelector: selector}},
+			wantErrs: []string{"spec.inherit[0].namespace"},
+		},
+		{
+			name:     "namespace selector without a label selector",
+			roleType: ClusterRole,
+			inherit:  []v1alpha1.InheritedRole{{Kind: "Role", Name: "reader", NamespaceSelector: selector}},
+			wantErrs: []string{"spec.inherit[0].namespaceSelector"},
+		},
+		{
+			name:     "invalid regular expressions and globs",
+			roleType: Role,
+			allow:    []v1.PolicyRule{{APIGroups: []string{"^(apps"}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+			deny:     []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets["}, Verbs: []string{"get"}}},
+			wantErrs: []string{"spec.allow[0].apiGroups", "spec.deny[0].resources"},
+		},
+		{
+			name:     "nonResourceURLs in a Role",
+			roleType: Role,
+			allow:    []v1.PolicyRule{{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}}},
+			deny:     []v1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}},
+			wantErrs: []string{"spec.allow[0].nonResourceURLs", "spec.deny[0].nonResourceURLs"},
+		},
+		{
+			name:     "rules granting nothing or mixing resources with nonResourceURLs",
+			roleType: ClusterRole,
+			allow: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}},
+				{APIGroups: []string{""}, Verbs: []string{"get"}},
+				{Resources: []string{"pods"}, Verbs: []string{"get"}},
+				{APIGroups: []string{""}, Resources: []string{"pods"}, NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}},
+			},
+			wantErrs: []string{"spec.allow[0].verbs", "spec.allow[1].resources", "spec.allow[2].apiGroups", "spec.allow[3].nonResourceURLs"},
+		},
+		{
+			name:     "unknown verbs",
+			roleType: Role,
+			allow:    []v1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "fetch"}}},
+			wantErrs: []string{"spec.allow[0].verbs[1]"},
+		},
+		{
+			name:         "API groups missing from discovery",
+			roleType:     Role,
+			allow:        []v1.PolicyRule{{APIGroups: []string{"apps", "tekton.dev", "*.openshift.io", "^app.*$"}, Resources: []string{"*"}, Verbs: []string{"get"}}},
+			wantWarnings: []string{"spec.allow[0].apiGroups[1]", "spec.allow[0].apiGroups[2]"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings, errs := ValidateDynamicRoleSpec(test.roleType, field.NewPath("spec"), &test.inherit, &test.allow, &test.deny, testDiscovery)
+			fields := []string{}
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			expectSameStrings(t, "fields in error", fields, test.wantErrs)
+			if len(warnings) != len(test.wantWarnings) {
+				t.Fatalf("got warnings %q, want warnings about %q", warnings, test.wantWarnings)
+			}
+			for i, warning := range warnings {
+				if !strings.HasPrefix(warning, test.wantWarnings[i]+":") {
+					t.Errorf("got warning %q, want a warning about %s", warning, test.wantWarnings[i])
+				}
+			}
+		})
+	}
+}
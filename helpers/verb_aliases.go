@@ -0,0 +1,136 @@
+package helpers
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+// verbAliases are named sets of verbs that allow and deny rules can list in place of literal verbs
+var verbAliases = map[string][]string{
+	"read":      {"get", "list", "watch"},
+	"write":     {"create", "update", "patch", "delete", "deletecollection"},
+	"dangerous": {"escalate", "bind", "impersonate"},
+}
+
+// rbacResourceVerbs are the verbs that RBAC itself checks on some resources served by the API server, which those resources do not declare in discovery
+var rbacResourceVerbs = map[string][]string{
+	"rbac.authorization.k8s.io/roles":        {"escalate", "bind"},
+	"rbac.authorization.k8s.io/clusterroles": {"escalate", "bind"},
+	"/serviceaccounts":                       {"impersonate"},
+	"user.openshift.io/users":                {"impersonate"},
+	"user.openshift.io/groups":               {"impersonate"},
+}
+
+// rbacOnlyResources are the resources that only exist in RBAC rules, for impersonation, and are therefore never listed in discovery
+var rbacOnlyResources = []v1.PolicyRule{
+	{APIGroups: []string{""}, Resources: []string{"users"}, Verbs: []string{"impersonate"}},
+	{APIGroups: []string{""}, Resources: []string{"groups"}, Verbs: []string{"impersonate"}},
+	{APIGroups: []string{"authentication.k8s.io"}, Resources: []string{"uids"}, Verbs: []string{"impersonate"}},
+}
+
+// userExtrasGroup and userExtrasResource identify the extra keys of a user, which are impersonated as subresources of `userextras`, e.g. `userextras/scopes`
+// RBAC only matches a subresource exactly, or `*/<subresource>`, so there is no rule granting every extra key and each key must be listed by name
+const (
+	userExtrasGroup    = "authentication.k8s.io"
+	userExtrasResource = "userextras"
+)
+
+// expandVerbAliases replaces every verb alias with all of the verbs it stands for
+func expandVerbAliases(verbs []string) []string {
+	expanded := []string{}
+	for _, verb := range verbs {
+		if aliasedVerbs, ok := verbAliases[verb]; ok {
+			expanded = appendSet(expanded, aliasedVerbs...)
+		} else {
+			expanded = appendSet(expanded, verb)
+		}
+	}
+	return expanded
+}
+
+// resolveVerbAliases replaces every verb alias with the verbs it stands for that are also in supported, so that a resource is never granted a verb it does not serve
+// Literal verbs are kept as they are, and an alias is expanded in full when supported contains `*`
+func resolveVerbAliases(verbs []string, supported []string) []string {
+	resolved := []string{}
+	for _, verb := range verbs {
+		aliasedVerbs, ok := verbAliases[verb]
+		switch {
+		case !ok:
+			resolved = appendSet(resolved, verb)
+		case stringInSlice(supported, "*"):
+			resolved = appendSet(resolved, aliasedVerbs...)
+		default:
+			resolved = appendSet(resolved, intersectStringSlices(aliasedVerbs, supported)...)
+		}
+	}
+	return resolved
+}
+
+// supportedVerbs returns the verbs of a resource in discovery (see func `APIResourcesToExpandedRules`), along with the verbs RBAC checks on it
+func supportedVerbs(discoveredRule v1.PolicyRule) []string {
+	return appendSet(discoveredRule.Verbs, rbacResourceVerbs[discoveredRule.APIGroups[0]+"/"+discoveredRule.Resources[0]]...)
+}
+
+// wildcardVerbs returns the verbs a grant of `*` stands for on the resource or nonResourceURL of an expanded rule: the verbs the resource supports
+// in discovery along with the verbs RBAC checks on it, or every verb the API server knows for a resource that discovery does not list with its verbs
+func wildcardVerbs(key expandedPolicyKey, discovery *DiscoverySnapshot) []string {
+	if key.NonResourceURLs != "" {
+		return append([]string{}, nonResourceURLVerbs...)
+	}
+	for _, rbacOnlyRule := range rbacOnlyResources {
+		if key.APIGroup == rbacOnlyRule.APIGroups[0] && key.Resource == rbacOnlyRule.Resources[0] {
+			return append([]string{}, rbacOnlyRule.Verbs...)
+		}
+	}
+	if key.APIGroup == userExtrasGroup && isUserExtraKey(key.Resource) {
+		return []string{"impersonate"}
+	}
+	if discovery != nil {
+		for _, discoveredRule := range discovery.Rules {
+			if discoveredRule.APIGroups[0] == key.APIGroup && discoveredRule.Resources[0] == key.Resource && !stringInSlice(discoveredRule.Verbs, "*") {
+				return supportedVerbs(discoveredRule)
+			}
+		}
+	}
+	return append([]string{}, knownVerbs...)
+}
+
+// enumerateRBACOnlyResources returns the rules granting the verbs of a rule on the resources in rbacOnlyResources that it matches,
+// and on the extra keys it lists by name, e.g. `userextras/scopes`
+// Only verbs listed by name or through an alias are granted, as `*` is resolved against discovery, which does not list these resources
+func enumerateRBACOnlyResources(rule v1.PolicyRule) []v1.PolicyRule {
+	rules := []v1.PolicyRule{}
+	if stringInSlice(rule.Verbs, "*") {
+		return rules
+	}
+	for _, rbacOnlyRule := range rbacOnlyResources {
+		if !groupMatchesAnyPattern(rule.APIGroups, rbacOnlyRule.APIGroups[0]) || !resourceMatchesAnyPattern(rule.Resources, rbacOnlyRule.Resources[0]) {
+			continue
+		}
+		verbs := intersectStringSlices(resolveVerbAliases(rule.Verbs, rbacOnlyRule.Verbs), rbacOnlyRule.Verbs)
+		if len(verbs) == 0 {
+			continue
+		}
+		rules = append(rules, v1.PolicyRule{APIGroups: rbacOnlyRule.APIGroups, Resources: rbacOnlyRule.Resources, ResourceNames: rule.ResourceNames, Verbs: verbs})
+	}
+	if !groupMatchesAnyPattern(rule.APIGroups, userExtrasGroup) {
+		return rules
+	}
+	verbs := intersectStringSlices(resolveVerbAliases(rule.Verbs, []string{"impersonate"}), []string{"impersonate"})
+	if len(verbs) == 0 {
+		return rules
+	}
+	for _, resource := range rule.Resources {
+		if isUserExtraKey(resource) {
+			rules = append(rules, v1.PolicyRule{APIGroups: []string{userExtrasGroup}, Resources: []string{resource}, ResourceNames: rule.ResourceNames, Verbs: verbs})
+		}
+	}
+	return rules
+}
+
+// isUserExtraKey returns true for a single extra key named literally, e.g. `userextras/scopes`, as opposed to a pattern such as `userextras/*`
+func isUserExtraKey(resource string) bool {
+	key := strings.TrimPrefix(resource, userExtrasResource+"/")
+	return key != resource && key != "" && !strings.ContainsAny(key, "*?[")
+}
@@ -0,0 +1,131 @@
+package helpers
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+func TestExpandVerbAliases(t *testing.T) {
+	tests := []struct {
+		verbs []string
+		want  []string
+	}{
+		{[]string{"read"}, []string{"get", "list", "watch"}},
+		{[]string{"read", "get", "patch"}, []string{"get", "list", "patch", "watch"}},
+		{[]string{"dangerous"}, []string{"bind", "escalate", "impersonate"}},
+		{[]string{"*"}, []string{"*"}},
+		{[]string{"use"}, []string{"use"}},
+	}
+	for _, test := range tests {
+		got := expandVerbAliases(test.verbs)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("expandVerbAliases(%q) = %q, want %q", test.verbs, got, test.want)
+		}
+	}
+}
+
+func TestResolveVerbAliases(t *testing.T) {
+	tests := []struct {
+		verbs     []string
+		supported []string
+		want      []string
+	}{
+		{[]string{"read"}, []string{"get", "create"}, []string{"get"}},
+		{[]string{"write", "get"}, []string{"create", "update"}, []string{"create", "get", "update"}},
+		{[]string{"dangerous"}, []string{"get", "list"}, []string{}},
+		{[]string{"read"}, []string{"*"}, []string{"get", "list", "watch"}},
+		{[]string{"use"}, []string{"get"}, []string{"use"}},
+	}
+	for _, test := range tests {
+		got := resolveVerbAliases(test.verbs, test.supported)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("resolveVerbAliases(%q, %q) = %q, want %q", test.verbs, test.supported, got, test.want)
+		}
+	}
+}
+
+func TestEnumerateRBACOnlyResources(t *testing.T) {
+	tests := []struct {
+		name string
+		rule v1.PolicyRule
+		want []v1.PolicyRule
+	}{
+		{
+			name: "impersonate users and groups",
+			rule: v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"users", "groups", "pods"}, Verbs: []string{"impersonate", "get"}},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"users"}, Verbs: []string{"impersonate"}},
+				{APIGroups: []string{""}, Resources: []string{"groups"}, Verbs: []string{"impersonate"}},
+			},
+		},
+		{
+			name: "dangerous alias on every resource",
+			rule: v1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"dangerous"}},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"users"}, Verbs: []string{"impersonate"}},
+				{APIGroups: []string{""}, Resources: []string{"groups"}, Verbs: []string{"impersonate"}},
+				{APIGroups: []string{"authentication.k8s.io"}, Resources: []string{"uids"}, Verbs: []string{"impersonate"}},
+			},
+		},
+		{
+			name: "single extra key with resource names",
+			rule: v1.PolicyRule{APIGroups: []string{"authentication.k8s.io"}, Resources: []string{"userextras/scopes"}, ResourceNames: []string{"user:info"}, Verbs: []string{"impersonate"}},
+			want: []v1.PolicyRule{
+				{APIGroups: []string{"authentication.k8s.io"}, Resources: []string{"userextras/scopes"}, ResourceNames: []string{"user:info"}, Verbs: []string{"impersonate"}},
+			},
+		},
+		{
+			name: "extra key patterns are not granted",
+			rule: v1.PolicyRule{APIGroups: []string{"authentication.k8s.io"}, Resources: []string{"userextras/*", "userextras", "userextras/"}, Verbs: []string{"impersonate"}},
+			want: []v1.PolicyRule{},
+		},
+		{
+			name: "wildcard verb is not granted",
+			rule: v1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+			want: []v1.PolicyRule{},
+		},
+		{
+			name: "verbs other than impersonate",
+			rule: v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"users"}, Verbs: []string{"read"}},
+			want: []v1.PolicyRule{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := enumerateRBACOnlyResources(test.rule); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("enumerateRBACOnlyResources() =\n%s\nwant\n%s", describeRules(got), describeRules(test.want))
+			}
+		})
+	}
+}
+
+func TestRBACOnlyResourceStrings(t *testing.T) {
+	rules, err := EnumeratePolicyRules([]v1.PolicyRule{{
+		APIGroups: []string{"*"},
+		Resources: []string{"*", "userextras/scopes", "userextras/example.com/team", "userextras/*"},
+		Verbs:     []string{"dangerous"},
+	}}, testDiscovery)
+	if err != nil {
+		t.Fatalf("EnumeratePolicyRules() error = %v", err)
+	}
+	got := []string{}
+	for _, rule := range rules {
+		if !stringInSlice(rule.Verbs, "impersonate") {
+			continue
+		}
+		for _, resource := range rule.Resources {
+			got = append(got, rule.APIGroups[0]+"/"+resource)
+		}
+	}
+	sort.Strings(got)
+	// Only exact names are matched by RBAC, see func `isUserExtraKey`
+	want := []string{"/groups", "/users", "authentication.k8s.io/uids", "authentication.k8s.io/userextras/example.com/team", "authentication.k8s.io/userextras/scopes"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EnumeratePolicyRules() granted impersonate on %q, want %q", got, want)
+	}
+}
@@ -18,11 +18,11 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -33,10 +33,12 @@ import (
 
 	helpers "github.com/redhat-cop/dynamic-rbac-operator/helpers"
 
-	crdv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
 	"github.com/redhat-cop/dynamic-rbac-operator/controllers"
+	"github.com/redhat-cop/dynamic-rbac-operator/webhooks"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -47,7 +49,7 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
-	utilruntime.Must(crdv1beta1.AddToScheme(scheme))
+	utilruntime.Must(crdv1.AddToScheme(scheme))
 
 	utilruntime.Must(rbacv1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
@@ -56,10 +58,13 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var maxConcurrentReconciles int
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The number of DynamicRoles and DynamicClusterRoles that are computed concurrently.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
@@ -77,52 +82,124 @@ func main() {
 	}
 
 	cache := helpers.GetCacheInstance()
+	queue := controllers.NewRecomputeQueue()
 
 	if err = (&controllers.CustomResourceDefinitionReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("CustomResourceDefinition"),
-		Scheme: mgr.GetScheme(),
-		Cache:  cache,
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("CustomResourceDefinition"),
+		Scheme:   mgr.GetScheme(),
+		Cache:    cache,
+		Queue:    queue,
+		Recorder: mgr.GetEventRecorderFor("dynamic-rbac-operator"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CustomResourceDefinition")
 		os.Exit(1)
 	}
+	if err = (&controllers.APIServiceReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("APIService"),
+		Scheme:   mgr.GetScheme(),
+		Cache:    cache,
+		Queue:    queue,
+		Recorder: mgr.GetEventRecorderFor("dynamic-rbac-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "APIService")
+		os.Exit(1)
+	}
 	if err = (&controllers.DynamicRoleReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("DynamicRole"),
-		Scheme: mgr.GetScheme(),
-		Cache:  cache,
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("DynamicRole"),
+		Scheme:   mgr.GetScheme(),
+		Cache:    cache,
+		Queue:    queue,
+		Recorder: mgr.GetEventRecorderFor("dynamic-rbac-operator"),
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DynamicRole")
 		os.Exit(1)
 	}
 	if err = (&controllers.DynamicClusterRoleReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("DynamicClusterRole"),
-		Scheme: mgr.GetScheme(),
-		Cache:  cache,
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("DynamicClusterRole"),
+		Scheme:   mgr.GetScheme(),
+		Cache:    cache,
+		Queue:    queue,
+		Recorder: mgr.GetEventRecorderFor("dynamic-rbac-operator"),
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DynamicClusterRole")
 		os.Exit(1)
 	}
 	if err = (&controllers.RoleReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Role"),
-		Scheme: mgr.GetScheme(),
-		Cache:  cache,
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("Role"),
+		Scheme:   mgr.GetScheme(),
+		Cache:    cache,
+		Queue:    queue,
+		Recorder: mgr.GetEventRecorderFor("dynamic-rbac-operator"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Role")
 		os.Exit(1)
 	}
 	if err = (&controllers.ClusterRoleReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("ClusterRole"),
+		Scheme:   mgr.GetScheme(),
+		Cache:    cache,
+		Queue:    queue,
+		Recorder: mgr.GetEventRecorderFor("dynamic-rbac-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterRole")
+		os.Exit(1)
+	}
+	if err = (&controllers.DynamicRBACPolicyReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("ClusterRole"),
+		Log:    ctrl.Log.WithName("controllers").WithName("DynamicRBACPolicy"),
 		Scheme: mgr.GetScheme(),
 		Cache:  cache,
+		Queue:  queue,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "ClusterRole")
+		setupLog.Error(err, "unable to create controller", "controller", "DynamicRBACPolicy")
 		os.Exit(1)
 	}
+	if err = (&controllers.DynamicRoleBindingReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("DynamicRoleBinding"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("dynamic-rbac-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DynamicRoleBinding")
+		os.Exit(1)
+	}
+	if err = (&controllers.DynamicClusterRoleBindingReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("DynamicClusterRoleBinding"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("dynamic-rbac-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DynamicClusterRoleBinding")
+		os.Exit(1)
+	}
+	// The webhook server needs a serving certificate, which is only mounted when the webhook is deployed, see config/default
+	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
+		if err = (&webhooks.DynamicRoleValidator{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("webhooks").WithName("DynamicRole"),
+			Cache:  cache,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DynamicRole")
+			os.Exit(1)
+		}
+		if err = (&webhooks.DynamicRoleBindingValidator{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("webhooks").WithName("DynamicRoleBinding"),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DynamicRoleBinding")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	// Begin cache setup
@@ -139,24 +216,38 @@ func main() {
 		setupLog.Error(err, "could not instantiate a client for pre-controller setup processes")
 		os.Exit(1)
 	}
-	crdList := &crdv1beta1.CustomResourceDefinitionList{}
+	crdList := &crdv1.CustomResourceDefinitionList{}
 	err = client.List(context.TODO(), crdList)
-	for _, crd := range crdList.Items {
-		crdJSON, _ := json.Marshal(crd.Spec)
-		cache.CRDs[crd.Name] = string(crdJSON)
-		setupLog.Info(fmt.Sprintf("Added %s to the CRD cache", crd.Name))
+	for i := range crdList.Items {
+		cache.SetCRDFingerprint(crdList.Items[i].Name, helpers.CRDFingerprint(&crdList.Items[i]))
+		setupLog.Info(fmt.Sprintf("Added %s to the CRD cache", crdList.Items[i].Name))
 	}
 	if err != nil {
 		setupLog.Error(err, "could not build the CRD cache in the pre-controller setup phase")
 		os.Exit(1)
 	}
-	_, apiResourceList, err := helpers.DiscoverClusterResources(restConfig)
+	apiServiceList := &unstructured.UnstructuredList{}
+	apiServiceList.SetGroupVersionKind(helpers.APIServiceListGVK)
+	err = client.List(context.TODO(), apiServiceList)
+	if err != nil {
+		setupLog.Error(err, "could not build the APIService cache in the pre-controller setup phase")
+		os.Exit(1)
+	}
+	for i := range apiServiceList.Items {
+		cache.SetAPIServiceAvailable(apiServiceList.Items[i].GetName(), helpers.APIServiceAvailable(&apiServiceList.Items[i]))
+	}
+	setupLog.Info(fmt.Sprintf("Added %d APIServices to the APIService cache", len(apiServiceList.Items)))
+	_, discovery, err := cache.RefreshDiscovery(func() ([]rbacv1.PolicyRule, []string, error) {
+		return helpers.DiscoverPolicyRules(restConfig)
+	})
 	if err != nil {
 		setupLog.Error(err, "could not build the cluster policy cache in the pre-controller setup phase")
 		os.Exit(1)
 	}
-	allPossibleRules := helpers.APIResourcesToExpandedRules(apiResourceList)
-	cache.AllPolicies = &allPossibleRules
+	if len(discovery.StaleGroups) > 0 {
+		// Their resources will be added once the APIServices serving them become available
+		setupLog.Info("Some API groups could not be discovered", "groups", discovery.StaleGroups)
+	}
 	setupLog.Info("Successfully built the cluster policy cache")
 	setupLog.Info("Pre-controller setup is complete")
 	// End cache setup
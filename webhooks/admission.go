@@ -0,0 +1,66 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// validateFunc validates the object of an admission request, returning warnings to show to the user and an error rejecting the object
+type validateFunc func(request *admissionv1beta1.AdmissionRequest) ([]string, *metav1.Status)
+
+// admissionResponse adds the `warnings` field to the admission response, which the Kubernetes API version used here predates
+// API servers from 1.19 show warnings to the user, and older ones ignore them
+type admissionResponse struct {
+	admissionv1beta1.AdmissionResponse `json:",inline"`
+	Warnings                           []string `json:"warnings,omitempty"`
+}
+
+type admissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Response        *admissionResponse `json:"response,omitempty"`
+}
+
+// validatingHandler serves AdmissionReview requests for a validating webhook
+type validatingHandler struct {
+	log      logr.Logger
+	validate validateFunc
+}
+
+func (h *validatingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		h.log.Error(err, "could not read the admission request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review := &admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		if err == nil {
+			err = fmt.Errorf("the admission review holds no request")
+		}
+		h.log.Error(err, "could not decode the admission request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	warnings, status := h.validate(review.Request)
+	response := &admissionResponse{
+		AdmissionResponse: admissionv1beta1.AdmissionResponse{
+			UID:     review.Request.UID,
+			Allowed: status == nil,
+			Result:  status,
+		},
+		Warnings: warnings,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// The response must use the same apiVersion as the request, which can be either admission.k8s.io/v1beta1 or v1
+	if err := json.NewEncoder(w).Encode(&admissionReview{TypeMeta: review.TypeMeta, Response: response}); err != nil {
+		h.log.Error(err, "could not write the admission response")
+	}
+}
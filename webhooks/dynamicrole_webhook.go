@@ -0,0 +1,209 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// +kubebuilder:webhook:path=/validate-rbac-redhatcop-redhat-io-v1alpha1-dynamicrole,mutating=false,failurePolicy=fail,groups=rbac.redhatcop.redhat.io,resources=dynamicroles,verbs=create;update,versions=v1alpha1,name=vdynamicrole.kb.io
+// +kubebuilder:webhook:path=/validate-rbac-redhatcop-redhat-io-v1alpha1-dynamicclusterrole,mutating=false,failurePolicy=fail,groups=rbac.redhatcop.redhat.io,resources=dynamicclusterroles,verbs=create;update,versions=v1alpha1,name=vdynamicclusterrole.kb.io
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// DynamicRoleValidator rejects DynamicRoles and DynamicClusterRoles whose spec can never be computed, and warns about API groups missing from discovery
+// It also rejects dynamic roles that would grant permissions the requesting user does not hold, unless the user may escalate them, see checkEscalation
+type DynamicRoleValidator struct {
+	client.Client
+	Log   logr.Logger
+	Cache *helpers.ResourceCache
+}
+
+func (v *DynamicRoleValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	server := mgr.GetWebhookServer()
+	server.Register("/validate-rbac-redhatcop-redhat-io-v1alpha1-dynamicrole", &validatingHandler{log: v.Log, validate: v.validateDynamicRole})
+	server.Register("/validate-rbac-redhatcop-redhat-io-v1alpha1-dynamicclusterrole", &validatingHandler{log: v.Log, validate: v.validateDynamicClusterRole})
+	return nil
+}
+
+func (v *DynamicRoleValidator) validateDynamicRole(request *admissionv1beta1.AdmissionRequest) ([]string, *metav1.Status) {
+	dynamicRole := &rbacv1alpha1.DynamicRole{}
+	if err := json.Unmarshal(request.Object.Raw, dynamicRole); err != nil {
+		return nil, &apierrors.NewBadRequest(err.Error()).ErrStatus
+	}
+	if dynamicRole.Namespace == "" {
+		dynamicRole.Namespace = request.Namespace
+	}
+	spec := dynamicRole.Spec
+	discovery := v.Cache.Discovery()
+	warnings, errs := helpers.ValidateDynamicRoleSpec(helpers.Role, field.NewPath("spec"), spec.Inherit, spec.Allow, spec.Deny, discovery)
+	if len(errs) > 0 || spec.Mode == rbacv1alpha1.ModePreview {
+		return warnings, invalid("DynamicRole", dynamicRole.Name, errs)
+	}
+	rules, err := v.dynamicRoleRules(dynamicRole, discovery)
+	var previousRules []rbacv1.PolicyRule
+	var previousInherit *[]rbacv1alpha1.InheritedRole
+	previous := &rbacv1alpha1.DynamicRole{}
+	if request.OldObject.Raw != nil && json.Unmarshal(request.OldObject.Raw, previous) == nil && previous.Spec.Mode != rbacv1alpha1.ModePreview {
+		previous.Namespace = dynamicRole.Namespace
+		previousInherit = previous.Spec.Inherit
+		if granted, err := v.dynamicRoleRules(previous, discovery); err == nil {
+			previousRules = *granted
+		}
+	}
+	widening := widenableInherits(helpers.Role, dynamicRole.Namespace, spec.Inherit, previousInherit)
+	return warnings, v.checkEscalation(request, "dynamicroles", dynamicRole.Namespace, dynamicRole.Name, widening, previousRules, rules, err)
+}
+
+// dynamicRoleRules computes the rules a DynamicRole grants
+func (v *DynamicRoleValidator) dynamicRoleRules(dynamicRole *rbacv1alpha1.DynamicRole, discovery *helpers.DiscoverySnapshot) (*[]rbacv1.PolicyRule, error) {
+	rules, _, err := helpers.BuildPolicyRules(helpers.BuildContext{Client: v.Client, Discovery: discovery, Dependencies: helpers.NewDependencies()}, helpers.DynamicRoleLink(dynamicRole.Namespace, dynamicRole.Name), helpers.Role, dynamicRole.Namespace, helpers.DynamicRoleRuleSpec(&dynamicRole.Spec))
+	return rules, err
+}
+
+func (v *DynamicRoleValidator) validateDynamicClusterRole(request *admissionv1beta1.AdmissionRequest) ([]string, *metav1.Status) {
+	dynamicClusterRole := &rbacv1alpha1.DynamicClusterRole{}
+	if err := json.Unmarshal(request.Object.Raw, dynamicClusterRole); err != nil {
+		return nil, &apierrors.NewBadRequest(err.Error()).ErrStatus
+	}
+	spec := dynamicClusterRole.Spec
+	discovery := v.Cache.Discovery()
+	warnings, errs := helpers.ValidateDynamicRoleSpec(helpers.ClusterRole, field.NewPath("spec"), spec.Inherit, spec.Allow, spec.Deny, discovery)
+	if len(errs) > 0 || spec.Mode == rbacv1alpha1.ModePreview {
+		return warnings, invalid("DynamicClusterRole", dynamicClusterRole.Name, errs)
+	}
+	dependencies := helpers.NewDependencies()
+	rules, err := v.dynamicClusterRoleRules(dynamicClusterRole, discovery, dependencies)
+	if err == nil && spec.NamespaceSelector == nil {
+		for _, pattern := range dependencies.NarrowedURLs() {
+			warnings = append(warnings, fmt.Sprintf("spec.deny: nonResourceURL %s is only partly denied, so it is narrowed down to the URLs the API server serves; any other URL it matched must be allowed explicitly", pattern))
+		}
+	}
+	var previousRules []rbacv1.PolicyRule
+	var previousInherit *[]rbacv1alpha1.InheritedRole
+	previous := &rbacv1alpha1.DynamicClusterRole{}
+	if request.OldObject.Raw != nil && json.Unmarshal(request.OldObject.Raw, previous) == nil && previous.Spec.Mode != rbacv1alpha1.ModePreview {
+		previousInherit = previous.Spec.Inherit
+		if granted, err := v.dynamicClusterRoleRules(previous, discovery, helpers.NewDependencies()); err == nil {
+			previousRules = *granted
+		}
+	}
+	widening := widenableInherits(helpers.ClusterRole, "", spec.Inherit, previousInherit)
+	return warnings, v.checkEscalation(request, "dynamicclusterroles", "", dynamicClusterRole.Name, widening, previousRules, rules, err)
+}
+
+// dynamicClusterRoleRules computes the rules a DynamicClusterRole grants, without non-resource URLs when they are stamped into namespaces as Roles
+// What the rules were computed from is recorded in dependencies
+func (v *DynamicRoleValidator) dynamicClusterRoleRules(dynamicClusterRole *rbacv1alpha1.DynamicClusterRole, discovery *helpers.DiscoverySnapshot, dependencies *helpers.Dependencies) (*[]rbacv1.PolicyRule, error) {
+	spec := dynamicClusterRole.Spec
+	rules, _, err := helpers.BuildPolicyRules(helpers.BuildContext{Client: v.Client, Discovery: discovery, Dependencies: dependencies}, helpers.DynamicClusterRoleLink(dynamicClusterRole.Name), helpers.ClusterRole, "", helpers.DynamicClusterRoleRuleSpec(&spec))
+	if err == nil && spec.NamespaceSelector != nil {
+		stamped := helpers.StripNonResourceURLs(*rules)
+		rules = &stamped
+	}
+	return rules, err
+}
+
+// widenableInherits describes the inherited roles, new since the previous spec, that pull Roles or DynamicRoles from another namespace into a dynamic role
+// Whoever may change a Role or DynamicRole in that namespace could later widen the generated role beyond what was checked at admission,
+// and beyond the namespace they hold those permissions in, e.g. by creating a Role matching a labelSelector or adding rules to an inherited Role
+func widenableInherits(roleType helpers.RoleType, namespace string, inherit *[]rbacv1alpha1.InheritedRole, previousInherit *[]rbacv1alpha1.InheritedRole) []string {
+	widening := []string{}
+	if inherit == nil {
+		return widening
+	}
+	for i, roleToInherit := range *inherit {
+		if roleToInherit.Kind != "Role" && roleToInherit.Kind != "DynamicRole" {
+			continue
+		}
+		if roleType == helpers.Role && roleToInherit.NamespaceSelector == nil && (roleToInherit.Namespace == "" || roleToInherit.Namespace == namespace) {
+			continue
+		}
+		if inheritedBefore(roleToInherit, previousInherit) {
+			continue
+		}
+		widening = append(widening, field.NewPath("spec", "inherit").Index(i).String())
+	}
+	return widening
+}
+
+// inheritedBefore returns true if the previous spec already had the same inherit entry, which was admitted then
+func inheritedBefore(roleToInherit rbacv1alpha1.InheritedRole, previousInherit *[]rbacv1alpha1.InheritedRole) bool {
+	if previousInherit == nil {
+		return false
+	}
+	for _, previous := range *previousInherit {
+		if equality.Semantic.DeepEqual(previous, roleToInherit) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEscalation rejects a dynamic role unless the requesting user holds every permission it would grant
+// Platform admins can be exempted by allowing them the `escalate` verb on dynamicroles or dynamicclusterroles
+// Dynamic roles in Preview mode are not checked, since nothing is granted until they are switched to Enforce, which is checked then
+// A spec whose rules cannot be computed, e.g. because an inherited role does not exist yet or because of an inheritance cycle, is rejected,
+// because what it grants cannot be verified: an inherited role created after the check could grant anything its creator holds in its namespace
+// On update, only the permissions that the previous spec did not already grant are checked
+//
+// Unlike RBAC, which checks the rules of a Role once and for all, the permissions are checked against the cluster as it is at admission only.
+// A dynamic role can grow afterwards without any check: an allow pattern matches resources installed later, a labelSelector matches ClusterRoles
+// labelled later, and inherited roles and dynamic roles can be changed. Every one of those requires permissions in the scope the generated role
+// applies to, except for Roles and DynamicRoles inherited from another namespace, so those are only admitted for users allowed to escalate,
+// see func `widenableInherits`
+func (v *DynamicRoleValidator) checkEscalation(request *admissionv1beta1.AdmissionRequest, resource string, namespace string, name string, widening []string, previousRules []rbacv1.PolicyRule, rules *[]rbacv1.PolicyRule, buildErr error) *metav1.Status {
+	groupResource := schema.GroupResource{Group: rbacv1alpha1.GroupVersion.Group, Resource: resource}
+	exempt, err := helpers.UserCan(v.Client, request.UserInfo, authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "escalate", Group: groupResource.Group, Resource: resource, Name: name})
+	if err != nil {
+		return &apierrors.NewInternalError(err).ErrStatus
+	}
+	if exempt {
+		return nil
+	}
+	if len(widening) > 0 {
+		return &apierrors.NewForbidden(groupResource, name, fmt.Errorf("%s inherit Roles or DynamicRoles from another namespace, which anyone allowed to change them there could widen without being checked; only users allowed to escalate %s may do so", strings.Join(widening, ", "), resource)).ErrStatus
+	}
+	if apierrors.IsNotFound(buildErr) {
+		return &apierrors.NewForbidden(groupResource, name, fmt.Errorf("it inherits from a role that does not exist yet, whose permissions cannot be checked against those of user %q; create the inherited role first, or ask a user allowed to escalate %s: %v", request.UserInfo.Username, resource, buildErr)).ErrStatus
+	}
+	if buildErr != nil {
+		return &apierrors.NewForbidden(groupResource, name, fmt.Errorf("the permissions it would grant cannot be computed, so they cannot be checked against those of user %q: %v", request.UserInfo.Username, buildErr)).ErrStatus
+	}
+	added, _ := helpers.PolicyRuleChanges(previousRules, *rules)
+	missing, err := helpers.MissingPermissions(v.Client, request.UserInfo, namespace, added)
+	if err != nil {
+		return &apierrors.NewInternalError(err).ErrStatus
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	descriptions := []string{}
+	for _, rule := range missing {
+		descriptions = append(descriptions, helpers.DescribePolicyRule(rule))
+	}
+	v.Log.Info("rejected a dynamic role granting permissions not held by its requester", "resource", resource, "namespace", namespace, "name", name, "user", request.UserInfo.Username, "missing", len(missing))
+	return &apierrors.NewForbidden(groupResource, name, fmt.Errorf("user %q (groups=%q) is attempting to grant permissions not currently held:\n%s", request.UserInfo.Username, request.UserInfo.Groups, strings.Join(descriptions, "\n"))).ErrStatus
+}
+
+// invalid converts validation errors into the status rejecting an admission request, or nil if there are none
+func invalid(kind string, name string, errs field.ErrorList) *metav1.Status {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &apierrors.NewInvalid(schema.GroupKind{Group: rbacv1alpha1.GroupVersion.Group, Kind: kind}, name, errs).ErrStatus
+}
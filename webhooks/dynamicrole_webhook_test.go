@@ -0,0 +1,332 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// fakeReviewer allows the SubjectAccessReviews whose attributes are listed in allowed, e.g. `get /secrets`, `update apps/deployments/scale`,
+// `* */*` or `get /healthz`, and serves every other request from the embedded client
+type fakeReviewer struct {
+	client.Client
+	allowed []string
+	lock    sync.Mutex
+	reviews []string
+}
+
+func newFakeReviewer(allowed ...string) *fakeReviewer {
+	return &fakeReviewer{Client: fake.NewFakeClientWithScheme(newTestScheme()), allowed: allowed}
+}
+
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	clientgoscheme.AddToScheme(scheme)
+	rbacv1alpha1.AddToScheme(scheme)
+	return scheme
+}
+
+func (f *fakeReviewer) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authorizationv1.SubjectAccessReview)
+	if !ok {
+		return f.Client.Create(ctx, obj, opts...)
+	}
+	var attributes string
+	if review.Spec.NonResourceAttributes != nil {
+		attributes = fmt.Sprintf("%s %s", review.Spec.NonResourceAttributes.Verb, review.Spec.NonResourceAttributes.Path)
+	} else {
+		resource := review.Spec.ResourceAttributes
+		attributes = fmt.Sprintf("%s %s/%s", resource.Verb, resource.Group, resource.Resource)
+		if resource.Subresource != "" {
+			attributes += "/" + resource.Subresource
+		}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.reviews = append(f.reviews, attributes)
+	for _, allowed := range f.allowed {
+		if allowed == attributes {
+			review.Status.Allowed = true
+		}
+	}
+	return nil
+}
+
+func newTestValidator(c client.Client) *DynamicRoleValidator {
+	cache := helpers.NewResourceCache()
+	cache.RefreshDiscovery(func() ([]rbacv1.PolicyRule, []string, error) {
+		return []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "delete"}},
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "delete"}},
+		}, nil, nil
+	})
+	return &DynamicRoleValidator{Client: c, Log: ctrl.Log.WithName("test"), Cache: cache}
+}
+
+func expectStatus(t *testing.T, status *metav1.Status, wantCode int32, wantMessage string) {
+	t.Helper()
+	if wantCode == 0 {
+		if status != nil {
+			t.Errorf("got status %q, want the request to be allowed", status.Message)
+		}
+		return
+	}
+	if status == nil {
+		t.Errorf("the request was allowed, want status %d", wantCode)
+		return
+	}
+	if status.Code != wantCode || !strings.Contains(status.Message, wantMessage) {
+		t.Errorf("got status %d %q, want %d containing %q", status.Code, status.Message, wantCode, wantMessage)
+	}
+}
+
+func TestCheckEscalation(t *testing.T) {
+	secretsGet := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}
+	podsGet := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: rbacv1.GroupName, Resource: "roles"}, "missing")
+	tests := []struct {
+		name          string
+		allowed       []string
+		widening      []string
+		previousRules []rbacv1.PolicyRule
+		rules         []rbacv1.PolicyRule
+		buildErr      error
+		wantCode      int32
+		wantMessage   string
+	}{
+		{
+			name:    "permissions held",
+			allowed: []string{"get /secrets"},
+			rules:   []rbacv1.PolicyRule{secretsGet},
+		},
+		{
+			name:        "permissions not held",
+			allowed:     []string{"get /pods"},
+			rules:       []rbacv1.PolicyRule{secretsGet, podsGet},
+			wantCode:    http.StatusForbidden,
+			wantMessage: "secrets",
+		},
+		{
+			name:          "only permissions added since the previous spec are checked",
+			allowed:       []string{"get /pods"},
+			previousRules: []rbacv1.PolicyRule{secretsGet},
+			rules:         []rbacv1.PolicyRule{secretsGet, podsGet},
+		},
+		{
+			name:        "missing inherited role",
+			allowed:     []string{"get /secrets"},
+			rules:       []rbacv1.PolicyRule{secretsGet},
+			buildErr:    notFound,
+			wantCode:    http.StatusForbidden,
+			wantMessage: "does not exist yet",
+		},
+		{
+			name:        "rules that cannot be computed",
+			allowed:     []string{"* */*"},
+			buildErr:    fmt.Errorf("inheritance cycle"),
+			wantCode:    http.StatusForbidden,
+			wantMessage: "inheritance cycle",
+		},
+		{
+			name:        "widening inherits are rejected even for cluster admins",
+			allowed:     []string{"* */*", "get /secrets"},
+			widening:    []string{"spec.inherit[0]"},
+			rules:       []rbacv1.PolicyRule{secretsGet},
+			wantCode:    http.StatusForbidden,
+			wantMessage: "spec.inherit[0]",
+		},
+		{
+			name:     "users allowed to escalate are exempted",
+			allowed:  []string{"escalate rbac.redhatcop.redhat.io/dynamicroles"},
+			widening: []string{"spec.inherit[0]"},
+			rules:    []rbacv1.PolicyRule{secretsGet},
+			buildErr: notFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator := newTestValidator(newFakeReviewer(test.allowed...))
+			request := &admissionv1beta1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: "bob"}}
+			rules := test.rules
+			status := validator.checkEscalation(request, "dynamicroles", "team-a", "reader", test.widening, test.previousRules, &rules, test.buildErr)
+			expectStatus(t, status, test.wantCode, test.wantMessage)
+		})
+	}
+}
+
+func TestWidenableInherits(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	tests := []struct {
+		name     string
+		roleType helpers.RoleType
+		inherit  []rbacv1alpha1.InheritedRole
+		previous *[]rbacv1alpha1.InheritedRole
+		want     []string
+	}{
+		{
+			name:     "ClusterRoles never widen",
+			roleType: helpers.ClusterRole,
+			inherit:  []rbacv1alpha1.InheritedRole{{Kind: "ClusterRole", LabelSelector: selector}, {Kind: "DynamicClusterRole", Name: "reader"}},
+			want:     []string{},
+		},
+		{
+			name:     "Roles of the same namespace",
+			roleType: helpers.Role,
+			inherit:  []rbacv1alpha1.InheritedRole{{Kind: "Role", Name: "reader"}, {Kind: "DynamicRole", Namespace: "team-a", LabelSelector: selector}},
+			want:     []string{},
+		},
+		{
+			name:     "Roles of another namespace",
+			roleType: helpers.Role,
+			inherit:  []rbacv1alpha1.InheritedRole{{Kind: "Role", Name: "reader"}, {Kind: "Role", Namespace: "team-b", Name: "reader"}, {Kind: "DynamicRole", NamespaceSelector: selector}},
+			want:     []string{"spec.inherit[1]", "spec.inherit[2]"},
+		},
+		{
+			name:     "Roles inherited into a DynamicClusterRole",
+			roleType: helpers.ClusterRole,
+			inherit:  []rbacv1alpha1.InheritedRole{{Kind: "Role", Namespace: "team-a", LabelSelector: selector}},
+			want:     []string{"spec.inherit[0]"},
+		},
+		{
+			name:     "Roles inherited before",
+			roleType: helpers.ClusterRole,
+			inherit:  []rbacv1alpha1.InheritedRole{{Kind: "Role", Namespace: "team-a", LabelSelector: selector}, {Kind: "Role", Namespace: "team-a", Name: "reader"}},
+			previous: &[]rbacv1alpha1.InheritedRole{{Kind: "Role", Namespace: "team-a", LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}}},
+			want:     []string{"spec.inherit[1]"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := widenableInherits(test.roleType, "team-a", &test.inherit, test.previous)
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("widenableInherits() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func dynamicRoleRequest(t *testing.T, dynamicRole *rbacv1alpha1.DynamicRole, previous *rbacv1alpha1.DynamicRole) *admissionv1beta1.AdmissionRequest {
+	request := &admissionv1beta1.AdmissionRequest{Namespace: "team-a", UserInfo: authenticationv1.UserInfo{Username: "bob"}}
+	raw, err := json.Marshal(dynamicRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Object.Raw = raw
+	if previous != nil {
+		if request.OldObject.Raw, err = json.Marshal(previous); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return request
+}
+
+func TestValidateDynamicRole(t *testing.T) {
+	secretsGet := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}
+	podsGet := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}
+	dynamicRole := func(mode rbacv1alpha1.RoleMode, inherit *[]rbacv1alpha1.InheritedRole, allow ...rbacv1.PolicyRule) *rbacv1alpha1.DynamicRole {
+		return &rbacv1alpha1.DynamicRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "team-a"},
+			Spec:       rbacv1alpha1.DynamicRoleSpec{Mode: mode, Inherit: inherit, Allow: &allow},
+		}
+	}
+	tests := []struct {
+		name        string
+		dynamicRole *rbacv1alpha1.DynamicRole
+		previous    *rbacv1alpha1.DynamicRole
+		wantCode    int32
+		wantMessage string
+	}{
+		{
+			name:        "create granting permissions not held",
+			dynamicRole: dynamicRole(rbacv1alpha1.ModeEnforce, nil, secretsGet, podsGet),
+			wantCode:    http.StatusForbidden,
+			wantMessage: "secrets",
+		},
+		{
+			name:        "update keeping permissions not held",
+			dynamicRole: dynamicRole(rbacv1alpha1.ModeEnforce, nil, secretsGet, podsGet),
+			previous:    dynamicRole(rbacv1alpha1.ModeEnforce, nil, secretsGet),
+		},
+		{
+			name:        "update enforcing a previewed spec",
+			dynamicRole: dynamicRole(rbacv1alpha1.ModeEnforce, nil, secretsGet, podsGet),
+			previous:    dynamicRole(rbacv1alpha1.ModePreview, nil, secretsGet),
+			wantCode:    http.StatusForbidden,
+			wantMessage: "secrets",
+		},
+		{
+			name:        "preview is not checked",
+			dynamicRole: dynamicRole(rbacv1alpha1.ModePreview, nil, secretsGet),
+		},
+		{
+			name:        "missing inherited role",
+			dynamicRole: dynamicRole(rbacv1alpha1.ModeEnforce, &[]rbacv1alpha1.InheritedRole{{Kind: "Role", Name: "missing"}}, podsGet),
+			wantCode:    http.StatusForbidden,
+			wantMessage: "does not exist yet",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator := newTestValidator(newFakeReviewer("get /pods"))
+			_, status := validator.validateDynamicRole(dynamicRoleRequest(t, test.dynamicRole, test.previous))
+			expectStatus(t, status, test.wantCode, test.wantMessage)
+		})
+	}
+}
+
+func TestValidateDynamicClusterRoleWarnsAboutNarrowing(t *testing.T) {
+	tests := []struct {
+		name              string
+		deny              []rbacv1.PolicyRule
+		namespaceSelector *metav1.LabelSelector
+		wantWarnings      int
+	}{
+		{name: "deny covering part of a pattern", deny: []rbacv1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}}, wantWarnings: 1},
+		{name: "deny covering the whole pattern", deny: []rbacv1.PolicyRule{{NonResourceURLs: []string{"*"}, Verbs: []string{"get"}}}},
+		{name: "stamped into namespaces", deny: []rbacv1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}}, namespaceSelector: &metav1.LabelSelector{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allow := []rbacv1.PolicyRule{{NonResourceURLs: []string{"*"}, Verbs: []string{"get"}}}
+			dynamicClusterRole := &rbacv1alpha1.DynamicClusterRole{
+				ObjectMeta: metav1.ObjectMeta{Name: "monitoring"},
+				Spec:       rbacv1alpha1.DynamicClusterRoleSpec{Allow: &allow, Deny: &test.deny, Precedence: rbacv1alpha1.PrecedenceDenyOverrides, NamespaceSelector: test.namespaceSelector},
+			}
+			raw, err := json.Marshal(dynamicClusterRole)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := &admissionv1beta1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: "bob"}}
+			request.Object.Raw = raw
+			warnings, _ := newTestValidator(newFakeReviewer()).validateDynamicClusterRole(request)
+			if len(warnings) != test.wantWarnings {
+				t.Fatalf("got warnings %q, want %d", warnings, test.wantWarnings)
+			}
+			for _, warning := range warnings {
+				if !strings.HasPrefix(warning, "spec.deny: nonResourceURL * ") {
+					t.Errorf("got warning %q, want one about the narrowed pattern *", warning)
+				}
+			}
+		})
+	}
+}
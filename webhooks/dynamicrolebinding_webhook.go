@@ -0,0 +1,155 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+	"github.com/redhat-cop/dynamic-rbac-operator/helpers"
+)
+
+// +kubebuilder:webhook:path=/validate-rbac-redhatcop-redhat-io-v1alpha1-dynamicrolebinding,mutating=false,failurePolicy=fail,groups=rbac.redhatcop.redhat.io,resources=dynamicrolebindings,verbs=create;update,versions=v1alpha1,name=vdynamicrolebinding.kb.io
+// +kubebuilder:webhook:path=/validate-rbac-redhatcop-redhat-io-v1alpha1-dynamicclusterrolebinding,mutating=false,failurePolicy=fail,groups=rbac.redhatcop.redhat.io,resources=dynamicclusterrolebindings,verbs=create;update,versions=v1alpha1,name=vdynamicclusterrolebinding.kb.io
+
+// DynamicRoleBindingValidator rejects DynamicRoleBindings and DynamicClusterRoleBindings granting a role that the requesting user could not bind themselves
+// The operator writes the generated binding with its own privileges, so the check RBAC makes on RoleBindings and ClusterRoleBindings is made here instead, see checkBind
+type DynamicRoleBindingValidator struct {
+	client.Client
+	Log logr.Logger
+}
+
+func (v *DynamicRoleBindingValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	server := mgr.GetWebhookServer()
+	server.Register("/validate-rbac-redhatcop-redhat-io-v1alpha1-dynamicrolebinding", &validatingHandler{log: v.Log, validate: v.validateDynamicRoleBinding})
+	server.Register("/validate-rbac-redhatcop-redhat-io-v1alpha1-dynamicclusterrolebinding", &validatingHandler{log: v.Log, validate: v.validateDynamicClusterRoleBinding})
+	return nil
+}
+
+func (v *DynamicRoleBindingValidator) validateDynamicRoleBinding(request *admissionv1beta1.AdmissionRequest) ([]string, *metav1.Status) {
+	dynamicRoleBinding := &rbacv1alpha1.DynamicRoleBinding{}
+	if err := json.Unmarshal(request.Object.Raw, dynamicRoleBinding); err != nil {
+		return nil, &apierrors.NewBadRequest(err.Error()).ErrStatus
+	}
+	if dynamicRoleBinding.Namespace == "" {
+		dynamicRoleBinding.Namespace = request.Namespace
+	}
+	return nil, v.checkBind(request, "DynamicRoleBinding", dynamicRoleBinding.Namespace, dynamicRoleBinding.Name, dynamicRoleBinding.Spec.RoleRef)
+}
+
+func (v *DynamicRoleBindingValidator) validateDynamicClusterRoleBinding(request *admissionv1beta1.AdmissionRequest) ([]string, *metav1.Status) {
+	dynamicClusterRoleBinding := &rbacv1alpha1.DynamicClusterRoleBinding{}
+	if err := json.Unmarshal(request.Object.Raw, dynamicClusterRoleBinding); err != nil {
+		return nil, &apierrors.NewBadRequest(err.Error()).ErrStatus
+	}
+	previous := &rbacv1alpha1.DynamicClusterRoleBinding{}
+	if request.OldObject.Raw == nil || json.Unmarshal(request.OldObject.Raw, previous) != nil {
+		previous = &rbacv1alpha1.DynamicClusterRoleBinding{}
+	}
+	if status := v.checkUnscopedSubjects(request, dynamicClusterRoleBinding.Name, dynamicClusterRoleBinding.Spec.Subjects, previous.Spec.Subjects); status != nil {
+		return nil, status
+	}
+	return nil, v.checkBind(request, "DynamicClusterRoleBinding", "", dynamicClusterRoleBinding.Name, dynamicClusterRoleBinding.Spec.RoleRef)
+}
+
+// checkUnscopedSubjects rejects a DynamicClusterRoleBinding selecting ServiceAccounts by label in every namespace, unless the requesting user may bind any ClusterRole
+// Anyone allowed to label a ServiceAccount in any namespace would otherwise be granted the role, so such selectors must be limited with a namespace or namespaceSelector
+// Subjects that the previous spec already selected are not checked again
+func (v *DynamicRoleBindingValidator) checkUnscopedSubjects(request *admissionv1beta1.AdmissionRequest, name string, subjects []rbacv1alpha1.SubjectSelector, previousSubjects []rbacv1alpha1.SubjectSelector) *metav1.Status {
+	errs := field.ErrorList{}
+	for i, subject := range subjects {
+		if subject.Kind != rbacv1.ServiceAccountKind || subject.LabelSelector == nil || subject.Namespace != "" || subject.NamespaceSelector != nil {
+			continue
+		}
+		selectedBefore := false
+		for _, previous := range previousSubjects {
+			selectedBefore = selectedBefore || equality.Semantic.DeepEqual(previous, subject)
+		}
+		if !selectedBefore {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", "subjects").Index(i), "a ServiceAccount labelSelector must be limited with a namespace or namespaceSelector, unless the requesting user may bind any ClusterRole, because anyone allowed to label a ServiceAccount in any namespace would be granted the role"))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	allowed, err := helpers.UserCan(v.Client, request.UserInfo, authorizationv1.ResourceAttributes{Verb: "bind", Group: rbacv1.GroupName, Resource: "clusterroles"})
+	if err != nil {
+		return &apierrors.NewInternalError(err).ErrStatus
+	}
+	if allowed {
+		return nil
+	}
+	return invalid("DynamicClusterRoleBinding", name, errs)
+}
+
+// checkBind rejects a dynamic binding unless the requesting user may bind the role it grants, the same way RBAC guards RoleBindings and ClusterRoleBindings
+// The user must be allowed the `bind` verb on the generated role or on the dynamic role it is generated from, or hold every permission of the generated role
+// A dynamic role that has not generated its role yet can only be bound with the `bind` verb, because what it grants cannot be verified
+func (v *DynamicRoleBindingValidator) checkBind(request *admissionv1beta1.AdmissionRequest, kind string, namespace string, name string, roleRef rbacv1alpha1.RoleReference) *metav1.Status {
+	groupResource := schema.GroupResource{Group: rbacv1alpha1.GroupVersion.Group, Resource: strings.ToLower(kind) + "s"}
+	generatedRef, err := helpers.ResolveRoleRef(v.Client, roleRef, namespace)
+	if apierrors.IsNotFound(err) {
+		// The dynamic role may be created after its binding, e.g. by GitOps tooling applying both at once
+		generatedRef = rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: strings.TrimPrefix(roleRef.Kind, "Dynamic"), Name: roleRef.Name}
+	} else if err != nil {
+		return invalid(kind, name, field.ErrorList{field.Invalid(field.NewPath("spec", "roleRef"), roleRef, err.Error())})
+	}
+
+	dynamicRoleResource := schema.GroupResource{Group: rbacv1alpha1.GroupVersion.Group, Resource: strings.ToLower(roleRef.Kind) + "s"}
+	generatedRoleResource := schema.GroupResource{Group: rbacv1.GroupName, Resource: strings.ToLower(generatedRef.Kind) + "s"}
+	for _, bindable := range []schema.GroupResource{dynamicRoleResource, generatedRoleResource} {
+		allowed, err := helpers.UserCan(v.Client, request.UserInfo, authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "bind", Group: bindable.Group, Resource: bindable.Resource, Name: roleRef.Name})
+		if err != nil {
+			return &apierrors.NewInternalError(err).ErrStatus
+		}
+		if allowed {
+			return nil
+		}
+	}
+
+	rules, err := v.generatedRules(generatedRef, namespace)
+	if apierrors.IsNotFound(err) {
+		return &apierrors.NewForbidden(groupResource, name, fmt.Errorf("%s %s has not been generated yet, so its permissions cannot be checked against those of user %q, who is not allowed to bind it", generatedRef.Kind, generatedRef.Name, request.UserInfo.Username)).ErrStatus
+	} else if err != nil {
+		return &apierrors.NewInternalError(err).ErrStatus
+	}
+	missing, err := helpers.MissingPermissions(v.Client, request.UserInfo, namespace, rules)
+	if err != nil {
+		return &apierrors.NewInternalError(err).ErrStatus
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	descriptions := []string{}
+	for _, rule := range missing {
+		descriptions = append(descriptions, helpers.DescribePolicyRule(rule))
+	}
+	v.Log.Info("rejected a dynamic binding granting permissions not held by its requester", "kind", kind, "namespace", namespace, "name", name, "user", request.UserInfo.Username, "missing", len(missing))
+	return &apierrors.NewForbidden(groupResource, name, fmt.Errorf("user %q (groups=%q) is attempting to grant permissions not currently held:\n%s", request.UserInfo.Username, request.UserInfo.Groups, strings.Join(descriptions, "\n"))).ErrStatus
+}
+
+// generatedRules returns the rules of the role a dynamic binding grants, looked up in the binding's namespace for a Role
+func (v *DynamicRoleBindingValidator) generatedRules(roleRef rbacv1.RoleRef, namespace string) ([]rbacv1.PolicyRule, error) {
+	if roleRef.Kind == "Role" {
+		role := &rbacv1.Role{}
+		err := v.Client.Get(context.TODO(), types.NamespacedName{Name: roleRef.Name, Namespace: namespace}, role)
+		return role.Rules, err
+	}
+	clusterRole := &rbacv1.ClusterRole{}
+	err := v.Client.Get(context.TODO(), types.NamespacedName{Name: roleRef.Name}, clusterRole)
+	return clusterRole.Rules, err
+}
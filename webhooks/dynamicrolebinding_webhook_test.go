@@ -0,0 +1,136 @@
+package webhooks
+
+import (
+	"net/http"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	rbacv1alpha1 "github.com/redhat-cop/dynamic-rbac-operator/api/v1alpha1"
+)
+
+func TestCheckBind(t *testing.T) {
+	objects := fake.NewFakeClientWithScheme(newTestScheme(),
+		&rbacv1alpha1.DynamicRole{ObjectMeta: metav1.ObjectMeta{Name: "developer", Namespace: "team-a"}},
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "developer", Namespace: "team-a"},
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+		},
+		&rbacv1alpha1.DynamicClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "ungenerated"}},
+	)
+	tests := []struct {
+		name        string
+		allowed     []string
+		namespace   string
+		roleRef     rbacv1alpha1.RoleReference
+		wantCode    int32
+		wantMessage string
+	}{
+		{
+			name:      "bind on the dynamic role",
+			allowed:   []string{"bind rbac.redhatcop.redhat.io/dynamicroles"},
+			namespace: "team-a",
+			roleRef:   rbacv1alpha1.RoleReference{Kind: "DynamicRole", Name: "developer"},
+		},
+		{
+			name:      "bind on the generated role",
+			allowed:   []string{"bind rbac.authorization.k8s.io/roles"},
+			namespace: "team-a",
+			roleRef:   rbacv1alpha1.RoleReference{Kind: "DynamicRole", Name: "developer"},
+		},
+		{
+			name:      "every permission of the generated role held",
+			allowed:   []string{"get /pods"},
+			namespace: "team-a",
+			roleRef:   rbacv1alpha1.RoleReference{Kind: "DynamicRole", Name: "developer"},
+		},
+		{
+			name:        "permissions of the generated role not held",
+			allowed:     []string{"get /secrets"},
+			namespace:   "team-a",
+			roleRef:     rbacv1alpha1.RoleReference{Kind: "DynamicRole", Name: "developer"},
+			wantCode:    http.StatusForbidden,
+			wantMessage: "pods",
+		},
+		{
+			name:        "role not generated yet",
+			allowed:     []string{"* */*"},
+			roleRef:     rbacv1alpha1.RoleReference{Kind: "DynamicClusterRole", Name: "ungenerated"},
+			wantCode:    http.StatusForbidden,
+			wantMessage: "has not been generated yet",
+		},
+		{
+			name:    "dynamic role created after its binding, with bind",
+			allowed: []string{"bind rbac.authorization.k8s.io/clusterroles"},
+			roleRef: rbacv1alpha1.RoleReference{Kind: "DynamicClusterRole", Name: "later"},
+		},
+		{
+			name:        "DynamicRole in a cluster binding",
+			allowed:     []string{"bind rbac.authorization.k8s.io/clusterroles"},
+			roleRef:     rbacv1alpha1.RoleReference{Kind: "DynamicRole", Name: "developer"},
+			wantCode:    http.StatusUnprocessableEntity,
+			wantMessage: "spec.roleRef",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator := &DynamicRoleBindingValidator{Client: &fakeReviewer{Client: objects, allowed: test.allowed}, Log: ctrl.Log.WithName("test")}
+			request := &admissionv1beta1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: "bob"}}
+			kind := "DynamicClusterRoleBinding"
+			if test.namespace != "" {
+				kind = "DynamicRoleBinding"
+			}
+			expectStatus(t, validator.checkBind(request, kind, test.namespace, "binding", test.roleRef), test.wantCode, test.wantMessage)
+		})
+	}
+}
+
+func TestCheckUnscopedSubjects(t *testing.T) {
+	ci := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "ci"}}
+	unscoped := rbacv1alpha1.SubjectSelector{Kind: "ServiceAccount", LabelSelector: ci}
+	tests := []struct {
+		name        string
+		allowed     []string
+		subjects    []rbacv1alpha1.SubjectSelector
+		previous    []rbacv1alpha1.SubjectSelector
+		wantCode    int32
+		wantMessage string
+	}{
+		{
+			name: "scoped selectors",
+			subjects: []rbacv1alpha1.SubjectSelector{
+				{Kind: "User", Name: "bob"},
+				{Kind: "ServiceAccount", LabelSelector: ci, Namespace: "ci"},
+				{Kind: "ServiceAccount", LabelSelector: ci, NamespaceSelector: &metav1.LabelSelector{}},
+			},
+		},
+		{
+			name:        "ServiceAccounts selected by label in every namespace",
+			subjects:    []rbacv1alpha1.SubjectSelector{{Kind: "User", Name: "bob"}, unscoped},
+			wantCode:    http.StatusUnprocessableEntity,
+			wantMessage: "spec.subjects[1]",
+		},
+		{
+			name:     "by a user allowed to bind any ClusterRole",
+			allowed:  []string{"bind rbac.authorization.k8s.io/clusterroles"},
+			subjects: []rbacv1alpha1.SubjectSelector{unscoped},
+		},
+		{
+			name:     "selected by the previous spec",
+			subjects: []rbacv1alpha1.SubjectSelector{{Kind: "User", Name: "bob"}, unscoped},
+			previous: []rbacv1alpha1.SubjectSelector{unscoped},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator := &DynamicRoleBindingValidator{Client: newFakeReviewer(test.allowed...), Log: ctrl.Log.WithName("test")}
+			request := &admissionv1beta1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: "bob"}}
+			expectStatus(t, validator.checkUnscopedSubjects(request, "binding", test.subjects, test.previous), test.wantCode, test.wantMessage)
+		})
+	}
+}